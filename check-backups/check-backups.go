@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	// "github.com/c12h/errs" //???TO-DO: better name coming one day ...
 	"github.com/c12h/steam-stuff/steamfiles"
@@ -19,22 +23,36 @@ type AppNum = steamfiles.AppNum
 const VERSION = "0.4"
 
 const USAGEf = `Usage:
-  %s [options] [<Steam-library-folder> ...]
+  %s [options] [-b <backups-dir>]... [<Steam-library-folder> ...]
   %s (-h | --help  |  --version)
 
 Check for missing and outdated Steam backups. If no Steam library folders are
 specified as arguments, use those for the current user’s Steam installation.
 
+Backups can be spread over several directories (fx, on several disks): give -b
+once for each.  The backup checked for each app is its newest backup of just
+that app, or if it has none, its newest backup; when there is more than one
+backups directory, problems with a backup say which one it is in.
+With -R, apps without up-to-date backups on at least <copies> different devices
+(drives) are reported too.
+
+To check a Windows Steam installation from Linux (fx, on a dual-boot machine),
+give where its Steam directory is mounted with -H, and where the drives holding
+its other library folders are mounted with -w, fx "D=/mnt/games".
+
 Options:
   -b <backups-dir>  Scan this directory to search for backups instead of Steam’s default
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
   -r                Report backups with no appmanifest_<app#>.acf in <lib-dir>
+  -n <copies>       With -R, how many devices need up-to-date backups [default: 2]
+  -R                Report apps with too few up-to-date copies of their backups
   -s                Skip apps installed in user’s home Steam Library Folder
+  -w <mounts>       Map Windows drive letters to mount points (comma-separated)
   -v                Output progress reports
 `
 
 //???TO-DO:
-// steam-backups tidy ...???
-// steam-backups check [-s] [-g] [-r] [-v] [-a=<steam-lib-dir> ...] [-b=<backups-dir> ...]
+// steam-backups check [-s] [-g] [-r] [-R [-n=<copies>]] [-v] [-a=<steam-lib-dir> ...] [-b=<backups-dir> ...]
 //
 // Options:
 //	-g, --group-warnings      Group warnings by kind of problem
@@ -53,20 +71,100 @@ func main() {
 	reportBackupsNotInLib := optSpecified("-r", parsedArgs)
 	verbose := optSpecified("-v", parsedArgs)
 	skipHomeSLF := optSpecified("-s", parsedArgs)
+	copiesRequired := 0
+	if optSpecified("-R", parsedArgs) {
+		copiesRequired, err = strconv.Atoi(getArg("-n", parsedArgs))
+		if err != nil || copiesRequired < 1 {
+			Die2("usage", "invalid number of copies %q", getArg("-n", parsedArgs))
+		}
+	}
 
-	backupsDir := filepath.Clean(getArg("-b", parsedArgs))
-	steamLibDirs := getSteamLibDirs("<Steam-library-folder>", parsedArgs, &backupsDir)
-	p, err := filepath.EvalSymlinks(backupsDir)
-	DieIf(err, "cannot follow symlinks in %q: %s", backupsDir, err)
-	if p != backupsDir {
-		WriteMessage("", "backups directory %q symlinks to %q",
-			backupsDir, p)
-		backupsDir = p
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	if arg := getArg("-w", parsedArgs); arg != "" {
+		steamfiles.DriveMounts, err = steamfiles.ParseDriveMounts(arg)
+		DieIf2(err, "usage", "%s", err)
+	}
+	backupsDirs := getArgs("-b", parsedArgs)
+
+	// Scanning libraries on spinning disks or NAS mounts can be slow, so let
+	// the user interrupt it cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Cache what each library holds, so that libraries on drives that are
+	// not mounted can still be checked next time.
+	cacheDir, err := steamfiles.DefaultCacheDir()
+	WarnIf(err, "cannot cache library inventories: %s", err)
+
+	// Load the installed apps first, so that handleDupeBackup can use their
+	// names when reporting duplicate backups.
+	steamLibDirs := getSteamLibDirs("<Steam-library-folder>", parsedArgs)
+	inst, err := steamfiles.LoadInstallation(ctx, &steamfiles.LoadOptions{
+		LibraryDirs:      steamLibDirs,
+		SkipHomeLibrary:  skipHomeSLF,
+		NoBackups:        true,
+		CacheDir:         cacheDir,
+		ReportBadLibrary: warnBadSLF,
+		ReportProblem:    warnLoadProblem,
+		HandleDiff:       reportOldManifest})
+	DieIf(err, "")
+	installation = inst
+	if steamLibDirs != nil {
+		inst.Offline = nil
+	}
+	for _, lib := range inst.Offline {
+		WriteMessage("", "Steam library %q is offline as of %s;"+
+			" using its cached inventory of %s",
+			lib.Path, formatTime(lib.Scanned), countOf(len(lib.Apps), "app"))
+	}
+	if verbose {
+		reportLibraries(inst)
 	}
 
-	scanSteamLibraryDirs(steamLibDirs, skipHomeSLF, verbose)
+	if len(backupsDirs) == 0 {
+		backupsDir, err := steamfiles.DirectoryExists(inst.Home, "Backups")
+		DieIf(err, "cannot find default backups directory: %s", err)
+		backupsDirs = []string{backupsDir}
+	}
+	// A backups directory on a disk that is not plugged in should not stop
+	// the others being checked.
+	for _, backupsDir := range backupsDirs {
+		backupsDir = filepath.Clean(backupsDir)
+		p, err := filepath.EvalSymlinks(backupsDir)
+		if err != nil {
+			Warn("cannot follow symlinks in %q: %s", backupsDir, err)
+			continue
+		}
+		if p != backupsDir {
+			WriteMessage("", "backups directory %q symlinks to %q",
+				backupsDir, p)
+			backupsDir = p
+		}
+		nBefore := len(inst.AllBackups)
+		err = inst.AddBackupsDir(ctx, backupsDir, handleDupeBackup, nil)
+		if ctx.Err() != nil {
+			Die("interrupted")
+		}
+		if err != nil {
+			Warn("%s", err)
+			continue
+		}
+		if verbose {
+			reportCount(len(inst.AllBackups)-nBefore, "Steam backup", backupsDir)
+		}
+	}
+	if len(inst.BackupsDirs) == 0 {
+		Die("cannot find any backups to check")
+	}
+	if verbose {
+		if len(inst.BackupsDirs) > 1 {
+			reportCount(len(inst.Backups), "backed-up app",
+				fmt.Sprintf("in %d directories", len(inst.BackupsDirs)))
+		}
+		reportVolumes(inst)
+	}
 
-	check(backupsDir, reportBackupsNotInLib, verbose)
+	check(ctx, inst, reportBackupsNotInLib, copiesRequired, verbose)
 }
 
 func optSpecified(key string, parsedArgs docopt.Opts) bool {
@@ -92,7 +190,29 @@ func getArg(key string, parsedArgs docopt.Opts) string {
 	return string
 }
 
-func getSteamLibDirs(key string, parsedArgs docopt.Opts, backupsDir *string) []string {
+// getArgs returns the values of an option that can be given more than once.
+//
+func getArgs(key string, parsedArgs docopt.Opts) []string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	switch v := argsItem.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	return nil
+}
+
+// getSteamLibDirs returns the "steamapps" directories of the Steam Library
+// Folders given as arguments, or nil (meaning all of them) if there are none.
+//
+func getSteamLibDirs(key string, parsedArgs docopt.Opts) []string {
 	SLFargs := make([]string, 0, len(os.Args))
 	argsItem, haveItem := parsedArgs[key]
 	if !haveItem {
@@ -104,17 +224,8 @@ func getSteamLibDirs(key string, parsedArgs docopt.Opts, backupsDir *string) []s
 		Die2("BUG", "docopt[%q] == %#v", key, argsItem)
 	}
 
-	SteamDir, SLDsConfig, err := steamfiles.FindSteamLibraryDirs(warnBadSLF)
-	DieIf(err, "")
-
-	if *backupsDir == "" || *backupsDir == "." {
-		configBackupsDir, err := steamfiles.DirectoryExists(SteamDir, "Backups")
-		DieIf(err, "cannot find default backups directory: %s", err)
-		*backupsDir = configBackupsDir
-	}
-
 	if len(SLFargs) == 0 {
-		return SLDsConfig
+		return nil
 	}
 
 	// We expect/allow users to specifiy “Steam Library Folders” (the ones
@@ -142,76 +253,207 @@ func warnBadSLF(slfPath string, e error) {
 	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
 }
 
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
 //
-/*============ Scanning Steam Library Folders for installed apps =============*/
+/*========================= Checking the installation ========================*/
 //
 
-var manifestInfoForAppNum steamfiles.InstalledAppForAppNum
-
-func scanSteamLibraryDirs(dirList []string, skipHomeSLF, verbose bool) {
-	manifestInfoForAppNum = make(steamfiles.InstalledAppForAppNum)
-
-	nMappedApps := 0
-	if skipHomeSLF {
-		dirList = dirList[1:]
+// installation is the Steam installation being checked.
+//
+var installation *steamfiles.Installation
+
+func reportLibraries(inst *steamfiles.Installation) {
+	var appsTotal, workshopTotal int64
+	for _, lib := range inst.Libraries {
+		reportCount(len(lib.Apps), "valid appmanifest_$N.acf file", lib.Path)
+		var appsSize, workshopSize int64
+		for _, app := range lib.Apps {
+			appsSize += app.SizeOnDisk
+		}
+		for _, w := range lib.Workshops {
+			workshopSize += w.Size()
+		}
+		reportSizes(appsSize, workshopSize, len(lib.Workshops))
+		appsTotal, workshopTotal = appsTotal+appsSize, workshopTotal+workshopSize
 	}
-	for _, dirPath := range dirList {
-		err := steamfiles.ScanSteamLibDir(
-			dirPath, manifestInfoForAppNum, reportOldManifest)
-		DieIf(err, "")
-		if verbose {
-			nAdded := len(manifestInfoForAppNum) - nMappedApps
-			reportCount(nAdded, "valid appmanifest_$N.acf file", dirPath)
+	if len(inst.Libraries) > 1 {
+		reportCount(len(inst.Apps), "valid appmanifest_$N.acf file",
+			fmt.Sprintf("in %d directories", len(inst.Libraries)))
+		nWorkshops := 0
+		for _, lib := range inst.Libraries {
+			nWorkshops += len(lib.Workshops)
 		}
-		nMappedApps = len(manifestInfoForAppNum)
+		reportSizes(appsTotal, workshopTotal, nWorkshops)
 	}
-	if verbose && len(dirList) > 1 {
-		reportCount(nMappedApps, "valid appmanifest_$N.acf file",
-			fmt.Sprintf("in %d directories", len(dirList)))
+}
+
+// reportSizes reports how much space apps and their Workshop content take,
+// according to Steam.  Steam backups leave the Workshop content out.
+//
+func reportSizes(appsSize, workshopSize int64, nWorkshops int) {
+	if nWorkshops == 0 {
+		fmt.Printf("   (apps take %s)\n", formatSize(appsSize))
+		return
 	}
+	fmt.Printf("   (apps take %s, plus %s of Workshop content for %s)\n",
+		formatSize(appsSize), formatSize(workshopSize), countOf(nWorkshops, "app"))
 }
 
-/*======================= Scanning a backup directory ========================*/
+// reportVolumes reports how big and how full the file systems holding the
+// libraries and backups are.  Libraries and backups on the same file system
+// share its free space, so each file system is reported once.
+//
+func reportVolumes(inst *steamfiles.Installation) {
+	for _, v := range inst.Volumes() {
+		dirs := append(append([]string(nil), v.LibraryDirs...), v.BackupsDirs...)
+		if v.Capacity == 0 {
+			fmt.Printf(" Cannot tell the free space for %q\n", dirs)
+			continue
+		}
+		fmt.Printf(" %s of %s free (%.0f%% used) for %q\n",
+			formatSize(v.Available), formatSize(v.Capacity),
+			100*float64(v.Used())/float64(v.Capacity), dirs)
+	}
+}
 
-func check(steamBackupsDir string, reportUninstalled, verbose bool) {
-	backupInfoForAppNum := make(steamfiles.AppBackupForAppNum)
-	err := steamfiles.ScanBackupsDir(
-		steamBackupsDir, backupInfoForAppNum, handleDupeBackup)
-	DieIf(err, "")
-	if verbose {
-		reportCount(len(backupInfoForAppNum), "Steam backup", steamBackupsDir)
+func check(ctx context.Context, inst *steamfiles.Installation,
+	reportUninstalled bool, copiesRequired int, verbose bool,
+) {
+	// Backing up an app that Steam is part-way through updating gives a mix
+	// of old and new files, so those apps get their own category instead.
+	updates, err := steamfiles.FindPendingUpdates(ctx, inst, nil)
+	if ctx.Err() != nil {
+		Die("interrupted")
+	}
+	WarnIf(err, "")
+	updatePendingFor := make(map[AppNum]bool)
+	for _, u := range updates {
+		updatePendingFor[u.AppNumber] = true
 	}
 
-	for mAppNum, mInfo := range manifestInfoForAppNum {
-		bInfo, ok := backupInfoForAppNum[mAppNum]
-		if !ok {
+	for _, mInfo := range inst.SortedApps() {
+		bInfo, ok := inst.Backups[mInfo.AppNumber]
+		if updatePendingFor[mInfo.AppNumber] {
+			recordProblem(updatePending, mInfo.AppName, mInfo.AppNumber)
+		} else if !ok {
 			recordProblem(noBackup, mInfo.AppName, mInfo.AppNumber)
 		} else {
 			// ???TO-DO: compare mInfo.Name to bInfo.Name
+			note := whereIs(inst, bInfo)
 
 			if mInfo.ModTime.After(bInfo.ModTime) {
-				newer, err := steamfiles.AppNewerThan(
+				newer, err := steamfiles.AppNewerThanContext(ctx,
 					mInfo.LibraryFolders[0], mInfo.InstallDir,
-					bInfo.ModTime)
+					bInfo.ModTime, nil)
+				if ctx.Err() != nil {
+					Die("interrupted")
+				}
 				WarnIf(err, "")
 				if newer {
-					recordProblem(oldBackup, mInfo.AppName, mAppNum)
+					recordProblemNote(oldBackup, mInfo.AppName, mInfo.AppNumber, note)
+				}
+			}
+
+			// Steam backups leave out Workshop content, so any
+			// change to it since the backup is a change the
+			// backup cannot restore.
+			if w, ok := inst.Workshops[mInfo.AppNumber]; ok {
+				newer, err := steamfiles.WorkshopNewerThan(ctx, w,
+					bInfo.ModTime, nil)
+				if ctx.Err() != nil {
+					Die("interrupted")
+				}
+				WarnIf(err, "")
+				if newer {
+					recordProblemNote(workshopChanged, mInfo.AppName, mInfo.AppNumber, note)
 				}
 			}
 		}
 	}
 
-	if reportUninstalled {
-		for bAppNum, bInfo := range backupInfoForAppNum {
-			if _, ok := manifestInfoForAppNum[bAppNum]; !ok {
-				recordProblem(notInstalled, bInfo.BackupName, bAppNum)
+	// Apps in offline libraries can only be checked against their cached
+	// manifests, not their files.
+	for _, lib := range inst.Offline {
+		note := "in a library offline as of " + formatTime(lib.Scanned)
+		for _, mInfo := range lib.Apps {
+			if _, online := inst.Apps[mInfo.AppNumber]; online {
+				continue
+			}
+			bInfo, ok := inst.Backups[mInfo.AppNumber]
+			if !ok {
+				recordProblemNote(noBackup, mInfo.AppName, mInfo.AppNumber, note)
+			} else if mInfo.LastUpdated.After(bInfo.ModTime) {
+				recordProblemNote(oldBackup, mInfo.AppName, mInfo.AppNumber,
+					joinNotes(note, whereIs(inst, bInfo)))
 			}
 		}
 	}
 
+	if copiesRequired > 0 {
+		checkRedundancy(ctx, inst, copiesRequired, updatePendingFor)
+	}
+
+	if reportUninstalled {
+		for _, bAppNum := range inst.UninstalledBackups() {
+			bInfo := inst.Backups[bAppNum]
+			recordProblemNote(notInstalled, bInfo.BackupName, bAppNum,
+				whereIs(inst, bInfo))
+		}
+	}
+
 	reportProblems(verbose)
 }
 
+// checkRedundancy reports the apps (online or not) whose up-to-date backups
+// are on fewer than copies devices, including those whose backups are all out
+// of date.  Apps with no backups at all have already been reported as having
+// none, and apps with an update pending should not be backed up yet.
+//
+func checkRedundancy(ctx context.Context, inst *steamfiles.Installation,
+	copies int, updatePendingFor map[AppNum]bool,
+) {
+	statuses, err := steamfiles.CheckRedundancy(ctx, inst,
+		&steamfiles.RedundancyPolicy{Copies: copies}, nil)
+	if ctx.Err() != nil {
+		Die("interrupted")
+	}
+	WarnIf(err, "")
+	for _, st := range statuses {
+		WarnIf(st.Err, "")
+		if !st.UnderReplicated || len(st.Current)+len(st.Stale) == 0 ||
+			updatePendingFor[st.AppNumber] {
+			continue
+		}
+		note := fmt.Sprintf("on %d of %d devices", st.Devices, copies)
+		if len(st.Current) == 0 {
+			note = fmt.Sprintf("all %d out of date", len(st.Stale))
+		}
+		recordProblemNote(underReplicated, st.AppName, st.AppNumber, note)
+	}
+}
+
+// whereIs returns a note saying which backups directory a backup is in, or ""
+// if only one directory was scanned.
+//
+func whereIs(inst *steamfiles.Installation, b *steamfiles.AppBackup) string {
+	if len(inst.BackupsDirs) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("backup in %q", inst.BackupsDirOf(b))
+}
+
+// joinNotes combines two notes for a problem, either of which may be "".
+//
+func joinNotes(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "; " + b
+}
+
 /*---------------- Callback for reporting duplicate manifests ----------------*/
 
 // reportOldManifest is called by ScanSteamLibDir() when it finds a second or
@@ -288,9 +530,14 @@ func reportBackupChoice(appNum AppNum,
 	dText string, dInfo *steamfiles.AppBackup, // The one to be discarded
 	kText string, kInfo *steamfiles.AppBackup, // The one to be kept
 ) {
+	// Keeping copies of backups in different backups directories is the
+	// point of having several, so only duplicates within one are reported.
+	if filepath.Dir(dInfo.BackupPath) != filepath.Dir(kInfo.BackupPath) {
+		return
+	}
 
 	appName, suffix := kInfo.BackupName, "?"
-	if manifestInfo, haveManifest := manifestInfoForAppNum[appNum]; haveManifest {
+	if manifestInfo, haveManifest := installation.Apps[appNum]; haveManifest {
 		appName, suffix = manifestInfo.AppName, ""
 	}
 	fmt.Fprintf(os.Stderr,
@@ -309,27 +556,39 @@ type problemInfo struct {
 	kind      problemKind
 	appName   string
 	appNumber AppNum
+	note      string // Added to the end of the line, if not ""
 }
 
 const (
-	noBackup     = problemKind('N')
-	oldBackup    = problemKind('O')
-	notInstalled = problemKind('U')
+	noBackup        = problemKind('N')
+	oldBackup       = problemKind('O')
+	notInstalled    = problemKind('U')
+	workshopChanged = problemKind('W')
+	updatePending   = problemKind('P')
+	underReplicated = problemKind('R')
 )
 
 var formatForProblem = map[problemKind]string{
 	noBackup:     "  no backup here for %q (%d)\n",
 	oldBackup:    "  backup for %q (%d) may be out of date\n",
 	notInstalled: "  %q (%d) is not installed there\n", // "there"???
+	workshopChanged: "  Workshop content for %q (%d) has changed since its backup" +
+		" (backups leave it out)\n",
+	updatePending:   "  update pending for %q (%d), don’t back it up yet\n",
+	underReplicated: "  too few up-to-date copies of the backup for %q (%d)\n",
 }
 var problems []problemInfo
 
 func recordProblem(kind problemKind, appName string, appNumber AppNum) {
+	recordProblemNote(kind, appName, appNumber, "")
+}
+func recordProblemNote(kind problemKind, appName string, appNumber AppNum, note string) {
 	problems = append(problems,
 		problemInfo{
 			kind:      kind,
 			appName:   appName,
-			appNumber: appNumber})
+			appNumber: appNumber,
+			note:      note})
 }
 func reportProblems(verbose bool) {
 	if len(problems) == 0 {
@@ -347,7 +606,11 @@ func reportProblems(verbose bool) {
 		})
 
 	for _, p := range problems {
-		fmt.Printf(formatForProblem[p.kind], p.appName, p.appNumber)
+		line := fmt.Sprintf(formatForProblem[p.kind], p.appName, p.appNumber)
+		if p.note != "" {
+			line = strings.TrimSuffix(line, "\n") + " (" + p.note + ")\n"
+		}
+		fmt.Print(line)
 	}
 
 	// ??? For "problems by category", things would be different.
@@ -355,6 +618,34 @@ func reportProblems(verbose bool) {
 
 /*============================ Utility Functions =============================*/
 
+// formatTime formats a time for people to read.
+//
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "one " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func reportCount(n int, noun, where string) {
 	if strings.HasPrefix(where, "in ") {
 		where = " " + where
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+func TestHandleDupeBackup(t *testing.T) {
+	installation = &steamfiles.Installation{}
+	older := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	backup := func(path string, modTime time.Time, apps ...AppNum) *steamfiles.AppBackup {
+		return &steamfiles.AppBackup{BackupPath: path, BackupName: path,
+			AppNumbers: apps, ModTime: modTime}
+	}
+	for _, tc := range []struct {
+		name       string
+		prev, curr *steamfiles.AppBackup
+		useCurr    bool
+	}{
+		{"newer single-app backup in another directory",
+			backup("/disk1/backups/Ten", older, 10),
+			backup("/disk2/backups/Ten", newer, 10), true},
+		{"older single-app backup in another directory",
+			backup("/disk1/backups/Ten", newer, 10),
+			backup("/disk2/backups/Ten", older, 10), false},
+		{"older single-app backup beats newer multi-app one",
+			backup("/disk1/backups/Both", newer, 10, 20),
+			backup("/disk2/backups/Ten", older, 10), true},
+		{"newer multi-app backup loses to older single-app one",
+			backup("/disk1/backups/Ten", older, 10),
+			backup("/disk2/backups/Both", newer, 10, 20), false},
+		{"newer multi-app backup beats older multi-app one",
+			backup("/disk1/backups/Both", older, 10, 20),
+			backup("/disk1/backups/All", newer, 10, 20, 30), true},
+	} {
+		if got := handleDupeBackup(10, tc.prev, tc.curr); got != tc.useCurr {
+			t.Errorf("%s: handleDupeBackup = %v, want %v", tc.name, got, tc.useCurr)
+		}
+	}
+}
+
+func TestCheckRedundancyReportsStaleBackups(t *testing.T) {
+	updated := steamtest.DefaultTime.Add(48 * time.Hour)
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	for n, name := range map[AppNum]string{10: "Ten", 20: "Twenty", 30: "Thirty"} {
+		h.InitialLibrary().AddApp(n, name, name).SetManifestTime(updated).
+			AddFile("game", "#!game", updated)
+	}
+	b := h.AddBackupsDir("/backups")
+	b.AddBackup("Ten", 10).SetTime(updated.Add(time.Hour))
+	b.AddBackup("Twenty", 20).SetTime(steamtest.DefaultTime)
+	h.InstallFS(t)
+	inst, err := steamfiles.LoadInstallation(context.Background(),
+		&steamfiles.LoadOptions{BackupsDirs: []string{"/backups"}})
+	if err != nil {
+		t.Fatalf("LoadInstallation: %s", err)
+	}
+
+	problems = nil
+	checkRedundancy(context.Background(), inst, 1, nil)
+	if len(problems) != 1 || problems[0].appNumber != 20 ||
+		problems[0].kind != underReplicated ||
+		problems[0].note != "all 1 out of date" {
+		t.Errorf("got problems %+v, want app 20 under-replicated", problems)
+	}
+	problems = nil
+	checkRedundancy(context.Background(), inst, 1, map[AppNum]bool{20: true})
+	if len(problems) != 0 {
+		t.Errorf("with an update pending, got problems %+v, want none", problems)
+	}
+}
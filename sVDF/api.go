@@ -3,6 +3,7 @@ package sVDF
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -58,6 +59,7 @@ type File struct {
 	//Format Format
 	TopName  string
 	TopValue Value
+	Warnings []*Warning // Any oddities found while parsing the file
 }
 
 // FromFile() opens, reads and parses a ‘simple VDF’ file, returning a (pointer
@@ -71,6 +73,24 @@ func FromFile(filespec string, expectedTopNames ...string) (*File, error) {
 	if err != nil {
 		return nil, cannot(err, "open", filespec)
 	}
+	return fromOpenFile(fh, filespec, expectedTopNames)
+}
+
+// FromFS() is like FromFile(), but opens the file in a caller-supplied file
+// system.  (The name is passed to fsys.Open() unchanged, so it need only be
+// acceptable to fsys.)
+//
+func FromFS(fsys fs.FS, name string, expectedTopNames ...string) (*File, error) {
+	fh, err := fsys.Open(name)
+	if err != nil {
+		return nil, cannot(err, "open", name)
+	}
+	return fromOpenFile(fh, name, expectedTopNames)
+}
+
+// fromOpenFile() does the work for FromFile() and FromFS(), and closes fh.
+//
+func fromOpenFile(fh fs.File, filespec string, expectedTopNames []string) (*File, error) {
 	defer fh.Close()
 	fileInfo, err := fh.Stat()
 	if err != nil {
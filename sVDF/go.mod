@@ -1,6 +1,6 @@
 module github.com/c12h/steam-stuff/sVDF
 
-go 1.15
+go 1.16
 
 require (
 	github.com/c12h/steam-stuff v0.0.0-20210129084345-3b2a2d55e86f // indirect
@@ -3,6 +3,7 @@ package sVDF
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -12,7 +13,7 @@ import (
 const expectTabs = 0
 const expectNewline = 1
 
-func parseSimpleVDF(fr *os.File, fileInfo *File) error {
+func parseSimpleVDF(fr io.Reader, fileInfo *File) error {
 	// fileInfo has: .Path, .ModTime, .Size
 	// fileInfo needs: .TopName (a string), .TopValue (a string or NamesValuesList)
 	data, err := ioutil.ReadAll(fr)
@@ -28,6 +29,7 @@ func parseSimpleVDF(fr *os.File, fileInfo *File) error {
 	if err != nil {
 		return err
 	}
+	fileInfo.Warnings = p.warnings
 	return nil
 }
 
@@ -37,6 +39,7 @@ type parser struct {
 	pos         int
 	nIndentTabs int
 	nWarnings   int
+	warnings    []*Warning
 }
 
 // Parse a double-quoted string, which may be a name (=key) or a value.
@@ -287,9 +290,38 @@ func warnOddWS(p *parser, pos int, format string, args ...interface{}) {
 	} else {
 		diagnostic = fmt.Sprintf(format, args...)
 	}
-	fmt.Fprintf(os.Stderr, " Odd whitespace in %q at offset %d (line %d): %s\n",
-		p.filespec, pos, lineNum, diagnostic)
+	w := &Warning{
+		FilePath:   p.filespec,
+		FileOffset: pos,
+		LineNumber: lineNum,
+		Diagnostic: diagnostic}
+	p.warnings = append(p.warnings, w)
+	if PrintWarnings {
+		fmt.Fprintf(os.Stderr, " %s\n", w)
+	}
 }
+
+// A Warning describes something odd, but not bad enough to stop parsing, about
+// the whitespace in a VDF file.
+//
+type Warning struct {
+	FilePath   string // The file’s path
+	FileOffset int    // Where in the file the oddity is (zero-origin)
+	LineNumber int    // Which line that is in (one-origin)
+	Diagnostic string // A description of the oddity
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("Odd whitespace in %q at offset %d (line %d): %s",
+		w.FilePath, w.FileOffset, w.LineNumber, w.Diagnostic)
+}
+
+// PrintWarnings says whether parsing a file prints each Warning on stderr as
+// well as recording it in File.Warnings.  Programs that report the warnings
+// themselves can set it to false before parsing anything.
+//
+var PrintWarnings = true
+
 func plural(count int, noun string) string {
 	if count == 1 {
 		return "one " + noun
@@ -0,0 +1,87 @@
+package sVDF
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Write() writes a name and value in the layout Steam itself uses for simple
+// VDF files: names and string values in double quotes separated by two tabs,
+// nested NVLs in braces on lines of their own, and one tab of indentation per
+// level of nesting.  FromFile() can parse the result without warnings.
+//
+// The value must be a string or a NamesValuesList (whose values must in turn
+// be strings or NamesValuesLists).  Since a NamesValuesList is a map, Write()
+// cannot preserve the order the names had in any file they were read from; it
+// writes them in sorted order.
+//
+func Write(w io.Writer, topName string, topValue Value) error {
+	bw := bufio.NewWriter(w)
+	if err := writeNameValue(bw, 0, topName, topValue); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteFile() writes a VDF file via Write(), replacing any existing file.
+//
+func WriteFile(filespec string, topName string, topValue Value) error {
+	fh, err := os.Create(filespec)
+	if err != nil {
+		return cannot(err, "create", filespec)
+	}
+	err = Write(fh, topName, topValue)
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return cannot(err, "write", filespec)
+	}
+	return nil
+}
+
+// (f *File).Write() writes a parsed VDF file’s contents via Write().
+//
+func (f *File) Write(w io.Writer) error {
+	return Write(w, f.TopName, f.TopValue)
+}
+
+func writeNameValue(w *bufio.Writer, depth int, name string, value Value) error {
+	indent := strings.Repeat("\t", depth)
+	switch v := value.(type) {
+	case string:
+		fmt.Fprintf(w, "%s%s\t\t%s\n", indent, quote(name), quote(v))
+	case NamesValuesList:
+		fmt.Fprintf(w, "%s%s\n%s{\n", indent, quote(name), indent)
+		names := make([]string, 0, len(v))
+		for n := range v {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if err := writeNameValue(w, depth+1, n, v[n]); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s}\n", indent)
+	case *NamesValuesList:
+		return writeNameValue(w, depth, name, *v)
+	default:
+		return fmt.Errorf("cannot write %T value for %q as simple VDF", value, name)
+	}
+	return nil
+}
+
+var vdfEscaper = strings.NewReplacer(
+	`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// quote() puts double quotes around a string, escaping characters the way
+// parseString() expects.
+//
+func quote(s string) string {
+	return `"` + vdfEscaper.Replace(s) + `"`
+}
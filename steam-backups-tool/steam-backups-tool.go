@@ -23,15 +23,9 @@ const (
 	//
 	appsInstallRelPath = "common"
 	//
-	// Maybe one day ...???
-	steamLibsList = "~/.steam/debian-installation/steamapps/libraryfolders.vdf"
-	// Hmmm ....
-	//  steamRoot, err := filepath.EvalSymlinks("$HOME/.steam/root")
-	//  steamHome := filepath.Join(steamRoot, "steamapps")
-	//  libDirsList := []string{steamHome}
-	//  libFoldersSpec :=
-	//	ioutil.ReadFile(filepath.Join(steamHome, "libraryfolders.vdf"))
-	//  libPaths := []string{
+	// For finding the Steam installation (and its library folders) rather
+	// than using these defaults, see steamfiles.FindSteamHomes() and
+	// check-backups.
 )
 
 // An AppInfo represents the relevant details of an installed app (taken from its
@@ -71,7 +65,6 @@ Options:
 `
 
 //???TO-DO:
-// steam-backups tidy ...???
 // steam-backups check [-s] [-g] [-r] [-v] [-a=<steam-lib-dir> ...] [-b=<backups-dir> ...]
 //
 // Options:
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+type AppNum = steamfiles.AppNum
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s create [options] <app#> ...
+  %s restore [options] [--library <SLF>] <app#>
+  %s tidy [options] [--trash]
+  %s (-h | --help  |  --version)
+
+Make backups of installed Steam apps without Steam’s backup wizard.
+
+"create" writes a backup of each app as a gzipped tar archive of its manifest
+and files (<name>.steambackup.tar.gz), with a JSON index of its build, its
+depots and the checksums of its files beside it (<name>.steambackup.json).
+check-backups and the other programs here recognise these backups as well as
+Steam’s own.  Each backup is named for the app and the time it was made, so
+older backups of an app are kept.
+
+"restore" restores the newest of these backups of an app into a Steam library
+folder (by default, the one in the Steam home directory), checking its files
+against the index first.  If the library already has a directory with the
+app’s name, the app goes in "<name> (restored)".  The app’s manifest is
+written so that Steam checks (and if need be updates) its files before it next
+runs.  Steam must not be running.
+
+"tidy" works out which backups (Steam’s or these) are not wanted: those of
+apps given with -x, or missing from the list given with -o, and those beyond
+the newest few of each app, counting single-app backups ahead of multi-app
+ones unless -m is given.  It shows the plan, and with --trash moves those
+backups to the trash.
+
+Options:
+  -b <backups-dir>  Use this backups directory instead of Steam’s default
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -c                Include each app’s Proton prefix (compatdata)
+  -W                Include each app’s Workshop content
+  --library <SLF>   Restore into this Steam library folder
+  -k <N>            Keep this many backups of each app  [default: 1]
+  -m                Rank multi-app backups with single-app ones, by age alone
+  -o <owned-list>   Do not keep backups of apps missing from this file
+                    (app numbers, one per line; '#' starts a comment)
+  -x <app#s>        Do not keep backups of these apps (comma-separated)
+  --trash           Move unwanted backups to the trash, not just list them
+  -j                Output the tidy plan as JSON
+  -v                Output progress reports
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName, progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	verbose := optSpecified("-v", parsedArgs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	inst, err := steamfiles.LoadInstallation(ctx, &steamfiles.LoadOptions{
+		NoBackups:        true,
+		ReportBadLibrary: warnBadSLF,
+		ReportProblem:    warnLoadProblem})
+	DieIf(err, "")
+	backupsDir := getBackupsDir("-b", parsedArgs, inst)
+
+	if optSpecified("create", parsedArgs) {
+		opts := &steamfiles.ArchiveBackupOptions{
+			Compatdata: optSpecified("-c", parsedArgs),
+			Workshop:   optSpecified("-W", parsedArgs)}
+		create(ctx, inst, getAppNums("<app#>", parsedArgs), backupsDir, opts, verbose)
+	}
+	if optSpecified("restore", parsedArgs) {
+		appNums := getAppNums("<app#>", parsedArgs)
+		lib := inst.Libraries[0]
+		for _, l := range inst.Libraries {
+			if l.IsHome {
+				lib = l
+			}
+		}
+		if getArg("--library", parsedArgs) != "" {
+			lib = getLibrary("--library", parsedArgs, inst)
+		}
+		if steamfiles.SteamRunning(inst.Home) {
+			Die("Steam is running; please exit it first")
+		}
+		DieIf(inst.AddBackupsDir(ctx, backupsDir, nil, nil), "")
+		restore(ctx, inst, appNums[0], lib, verbose)
+	}
+	if optSpecified("tidy", parsedArgs) {
+		policy := getRetentionPolicy(parsedArgs)
+		DieIf(inst.AddBackupsDir(ctx, backupsDir, nil, nil), "")
+		tidy(inst, policy, optSpecified("--trash", parsedArgs),
+			optSpecified("-j", parsedArgs))
+	}
+	if nWarnings > 0 {
+		os.Exit(1)
+	}
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+func getAppNums(key string, parsedArgs docopt.Opts) []AppNum {
+	args, ok := parsedArgs[key].([]string)
+	if !ok {
+		Die2("BUG", "weird value %#v for %q in docopt result", parsedArgs[key], key)
+	}
+	var ret []AppNum
+	for _, arg := range args {
+		ret = append(ret, parseAppNum(arg))
+	}
+	return ret
+}
+
+func parseAppNum(arg string) AppNum {
+	n, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil || n <= 0 {
+		Die2("usage", "%q is not an app number", arg)
+	}
+	return AppNum(n)
+}
+
+// getRetentionPolicy builds a RetentionPolicy from the options for tidy.
+//
+func getRetentionPolicy(parsedArgs docopt.Opts) *steamfiles.RetentionPolicy {
+	policy := &steamfiles.RetentionPolicy{
+		PreferSingleApp: !optSpecified("-m", parsedArgs),
+		Unwanted:        make(map[AppNum]bool)}
+	n, err := strconv.Atoi(getArg("-k", parsedArgs))
+	if err != nil || n < 1 {
+		Die2("usage", "bad number of backups %q for -k", getArg("-k", parsedArgs))
+	}
+	policy.KeepNewest = n
+	if arg := getArg("-x", parsedArgs); arg != "" {
+		for _, word := range strings.Split(arg, ",") {
+			policy.Unwanted[parseAppNum(strings.TrimSpace(word))] = true
+		}
+	}
+	if path := getArg("-o", parsedArgs); path != "" {
+		data, err := os.ReadFile(path)
+		DieIf(err, "cannot read list of owned apps: %s", err)
+		policy.Owned = make(map[AppNum]bool)
+		for _, line := range strings.Split(string(data), "\n") {
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				policy.Owned[parseAppNum(line)] = true
+			}
+		}
+		if len(policy.Owned) == 0 {
+			Die("%q lists no apps, so tidy would not keep any backups", path)
+		}
+	}
+	return policy
+}
+
+// getBackupsDir returns the backups directory given as an option, or else
+// Steam’s default one.
+//
+func getBackupsDir(key string, parsedArgs docopt.Opts, inst *steamfiles.Installation,
+) string {
+	if arg := getArg(key, parsedArgs); arg != "" {
+		dir, err := steamfiles.DirectoryExists(filepath.Clean(arg))
+		DieIf(err, "cannot use %q: %s", arg, err)
+		return dir
+	}
+	dir, err := steamfiles.DirectoryExists(inst.Home, "Backups")
+	DieIf(err, "cannot find default backups directory: %s", err)
+	return dir
+}
+
+// getLibrary returns the Library for a Steam Library Folder given as an
+// argument.
+//
+func getLibrary(key string, parsedArgs docopt.Opts, inst *steamfiles.Installation,
+) *steamfiles.Library {
+	arg := getArg(key, parsedArgs)
+	if filepath.Base(arg) != "steamapps" {
+		subdir, err := steamfiles.DirectoryExists(arg, "steamapps")
+		DieIf(err, "cannot use %q: %s", arg, err)
+		arg = subdir
+	}
+	if lib := inst.Library(arg); lib != nil {
+		return lib
+	}
+	Die("%q is not one of Steam’s library folders", arg)
+	return nil
+}
+
+func warnBadSLF(slfPath string, e error) {
+	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
+}
+
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
+/*================================== create ==================================*/
+
+func create(ctx context.Context, inst *steamfiles.Installation, appNums []AppNum,
+	backupsDir string, opts *steamfiles.ArchiveBackupOptions, verbose bool,
+) {
+	if verbose {
+		opts.Progress = newProgressReporter("Archived")
+	}
+	for _, appNum := range appNums {
+		b, err := steamfiles.WriteArchiveBackup(ctx, inst, appNum, backupsDir, opts)
+		if verbose {
+			fmt.Fprintln(os.Stderr)
+		}
+		if ctx.Err() != nil {
+			Die("interrupted")
+		}
+		if err != nil {
+			Warn("%s", err)
+			continue
+		}
+		size := ""
+		if info, err := os.Stat(b.BackupPath); err == nil {
+			size = " (" + formatSize(info.Size()) + ")"
+		}
+		fmt.Printf(" Backed up app %d (%q) to %s%s\n",
+			appNum, b.BackupName, b.BackupPath, size)
+	}
+}
+
+/*================================= restore ==================================*/
+
+func restore(ctx context.Context, inst *steamfiles.Installation, appNum AppNum,
+	lib *steamfiles.Library, verbose bool,
+) {
+	var newest *steamfiles.AppBackup
+	for _, b := range inst.BackupsOf(appNum) {
+		if b.IsArchive() && (newest == nil || b.ModTime.After(newest.ModTime)) {
+			newest = b
+		}
+	}
+	if newest == nil {
+		Die("no archive backup of app %d (Steam’s own backups must be restored with Steam)",
+			appNum)
+	}
+	fmt.Printf(" Restoring app %d (%q) from %s into %s\n",
+		appNum, newest.BackupName, newest.BackupPath, lib.Path)
+
+	var opts *steamfiles.RestoreOptions
+	if verbose {
+		opts = &steamfiles.RestoreOptions{Progress: newProgressReporter("Checked")}
+	}
+	r, err := steamfiles.RestoreArchiveBackup(ctx, inst, newest, lib.Path, opts)
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	if ctx.Err() != nil {
+		Die("interrupted")
+	}
+	DieIf(err, "")
+	if r.Renamed {
+		WriteMessage("", "the library already had a directory of that name,"+
+			" so app %d went in %q", appNum, r.AppDir)
+	}
+	for _, p := range r.Skipped {
+		WriteMessage("", "kept the existing %q instead of the backup’s", p)
+	}
+	fmt.Printf(" Restored app %d to %s; Steam will check its files before it next runs\n",
+		appNum, r.AppDir)
+}
+
+/*=================================== tidy ===================================*/
+
+func tidy(inst *steamfiles.Installation, policy *steamfiles.RetentionPolicy,
+	trash, outputJSON bool,
+) {
+	plan, err := steamfiles.PlanTidy(inst, policy)
+	DieIf(err, "")
+	if outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		DieIf(enc.Encode(plan), "")
+	} else {
+		fmt.Printf(" Keeping %s:\n", countOf(len(plan.Keep), "backup"))
+		for _, item := range plan.Keep {
+			reportTidyItem(item)
+		}
+		verb := "Would move"
+		if trash {
+			verb = "Moving"
+		}
+		fmt.Printf(" %s %s to the trash, freeing %s:\n",
+			verb, countOf(len(plan.Delete), "backup"), formatSize(plan.Freed))
+		for _, item := range plan.Delete {
+			reportTidyItem(item)
+		}
+	}
+	if !trash {
+		return
+	}
+	// Stop trashing a backup’s files at the first failure: item.Paths puts
+	// the ones whose loss would spoil later scans first.
+	for _, item := range plan.Delete {
+		for _, p := range item.Paths {
+			if _, err := steamfiles.MoveToTrash(p); err != nil {
+				Warn("%s", err)
+				break
+			}
+		}
+	}
+}
+
+func reportTidyItem(item *steamfiles.TidyItem) {
+	fmt.Printf("  %s  (%s, %s)\n           %s\n",
+		item.Path, formatSize(item.Size),
+		item.ModTime.Local().Format("2006-01-02 15:04"), item.Reason)
+}
+
+/*============================ Utility Functions =============================*/
+
+// newProgressReporter returns a ScanProgressReporter that shows the progress
+// of a backup or restore on stderr, at most a few times a second.
+//
+func newProgressReporter(verb string) steamfiles.ScanProgressReporter {
+	var last time.Time
+	return func(p steamfiles.ScanProgress) {
+		if time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r %s %d files (%s)   ",
+			verb, p.Files, formatSize(p.Bytes))
+	}
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "one " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
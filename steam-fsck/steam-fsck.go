@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c12h/steam-stuff/sVDF"
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s [options]
+  %s (-h | --help  |  --version)
+
+Check a Steam installation for inconsistencies, and report what is found,
+grouped by check.  Nothing is changed.
+
+The checks are:
+  vdf             every VDF file parses, without odd whitespace
+  manifest        every appmanifest_<app#>.acf has the entries Steam needs
+  appid           every manifest’s "appid" matches its file name
+  duplicate       no app has manifests in more than one library
+  stateflags      every manifest’s "StateFlags" make sense
+  installdir      every manifest’s "installdir" exists (ignoring case if need be)
+  emptydir        no install directory is empty
+  libraryfolders  the "apps" lists in libraryfolders.vdf match the manifests
+
+Each finding is an error, a warning or just info.  The exit status is 1 if any
+errors are reported.
+
+Options:
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -w <mounts>       Map Windows drive letters to mount points (comma-separated)
+  -k <checks>       Only report these checks (comma-separated)
+  -m <severity>     Only report findings at least this severe
+                    [default: warning]
+  -j                Output JSON instead of text
+  -v                Output progress reports
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	if arg := getArg("-w", parsedArgs); arg != "" {
+		steamfiles.DriveMounts, err = steamfiles.ParseDriveMounts(arg)
+		DieIf2(err, "usage", "%s", err)
+	}
+	checks := getChecks(getArg("-k", parsedArgs))
+	minSeverity, err := steamfiles.ParseFsckSeverity(getArg("-m", parsedArgs))
+	DieIf2(err, "usage", "%s", err)
+	outputJSON := optSpecified("-j", parsedArgs)
+	verbose := optSpecified("-v", parsedArgs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Odd whitespace is reported as findings, not as it is parsed.
+	sVDF.PrintWarnings = false
+	var scanOpts *steamfiles.ScanOptions
+	if verbose {
+		scanOpts = &steamfiles.ScanOptions{Progress: newProgressReporter()}
+	}
+	findings, err := steamfiles.Fsck(ctx, scanOpts)
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	if ctx.Err() != nil {
+		Die("interrupted")
+	}
+	DieIf(err, "")
+
+	findings = selectFindings(findings, checks, minSeverity)
+	if outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		DieIf(enc.Encode(findings), "")
+	} else {
+		reportFindings(findings)
+	}
+	for _, f := range findings {
+		if f.Severity == steamfiles.FsckError {
+			os.Exit(1)
+		}
+	}
+	if nWarnings > 0 {
+		os.Exit(1)
+	}
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+// getChecks parses the -k option, returning nil (meaning all checks) if it was
+// not given.
+//
+func getChecks(arg string) map[steamfiles.FsckCheck]bool {
+	if arg == "" {
+		return nil
+	}
+	ret := make(map[steamfiles.FsckCheck]bool)
+	for _, word := range strings.Split(arg, ",") {
+		check, ok := steamfiles.FsckCheck(strings.TrimSpace(word)), false
+		for _, c := range steamfiles.FsckChecks {
+			ok = ok || c == check
+		}
+		if !ok {
+			Die2("usage", "unknown check %q (want one of %q)",
+				word, steamfiles.FsckChecks)
+		}
+		ret[check] = true
+	}
+	return ret
+}
+
+/*=============================== The findings ===============================*/
+
+func selectFindings(findings []*steamfiles.FsckFinding,
+	checks map[steamfiles.FsckCheck]bool, minSeverity steamfiles.FsckSeverity,
+) []*steamfiles.FsckFinding {
+	ret := make([]*steamfiles.FsckFinding, 0, len(findings))
+	for _, f := range findings {
+		if (checks == nil || checks[f.Check]) && f.Severity.AtLeast(minSeverity) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func reportFindings(findings []*steamfiles.FsckFinding) {
+	if len(findings) == 0 {
+		fmt.Printf(" No problems found\n")
+		return
+	}
+
+	count := make(map[steamfiles.FsckSeverity]int)
+	for i := 0; i < len(findings); {
+		check := findings[i].Check
+		j := i
+		for ; j < len(findings) && findings[j].Check == check; j++ {
+			count[findings[j].Severity]++
+		}
+		fmt.Printf("%s: %s\n", check, countOf(j-i, "finding"))
+		for _, f := range findings[i:j] {
+			app := ""
+			if f.AppNumber != 0 {
+				app = fmt.Sprintf(" (app %d)", f.AppNumber)
+			}
+			fmt.Printf("  %-7s  %s%s\n           %s\n",
+				f.Severity, f.Path, app, f.Message)
+		}
+		i = j
+	}
+	fmt.Printf(" Total: %s, %s, %s\n",
+		countOf(count[steamfiles.FsckError], "error"),
+		countOf(count[steamfiles.FsckWarning], "warning"),
+		countOf(count[steamfiles.FsckInfo], "info finding"))
+}
+
+/*============================ Utility Functions =============================*/
+
+// newProgressReporter returns a ScanProgressReporter that shows the progress
+// of the checks on stderr, at most a few times a second.
+//
+func newProgressReporter() steamfiles.ScanProgressReporter {
+	var last time.Time
+	return func(p steamfiles.ScanProgress) {
+		if time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r Checked %d manifests   ", p.Files)
+	}
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "one " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+type AppNum = steamfiles.AppNum
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s [options] <app#> <Steam-library-folder>
+  %s [options] --abort <app#> <Steam-library-folder>
+  %s [options] --list
+  %s (-h | --help  |  --version)
+
+Move an installed Steam app to another Steam library folder: its install
+directory, its appmanifest_<app#>.acf file and its entry in libraryfolders.vdf.
+The app’s files are copied and checked before anything is switched over, and
+the originals are only removed once the new copy is in use.
+
+If a move is interrupted, run the same command again to finish it, or use
+--abort to roll it back.  --list shows unfinished moves.
+
+Steam must not be running.
+
+Options:
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -m <GiB>          Leave at least this much space free in the destination
+                    [default: 1]
+  --abort           Roll back an unfinished move
+  --list            List unfinished moves
+  -v                Output progress reports
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName, progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	verbose := optSpecified("-v", parsedArgs)
+	minFreeGiB, err := strconv.ParseFloat(getArg("-m", parsedArgs), 64)
+	if err != nil || minFreeGiB < 0 {
+		Die2("usage", "bad free space %q for -m", getArg("-m", parsedArgs))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	inst, err := steamfiles.LoadInstallation(ctx, &steamfiles.LoadOptions{
+		NoBackups:        true,
+		ReportBadLibrary: warnBadSLF,
+		ReportProblem:    warnLoadProblem})
+	DieIf(err, "")
+
+	if optSpecified("--list", parsedArgs) {
+		listMoves(inst)
+		return
+	}
+
+	appNum := getAppNum("<app#>", parsedArgs)
+	lib := getLibrary("<Steam-library-folder>", parsedArgs, inst)
+	if steamfiles.SteamRunning(inst.Home) {
+		Die("Steam is running; please exit it first")
+	}
+
+	if optSpecified("--abort", parsedArgs) {
+		DieIf(steamfiles.AbortMove(inst, appNum, lib.Path), "")
+		fmt.Printf(" Rolled back the move of app %d to %s\n", appNum, lib.Path)
+		return
+	}
+
+	pending, err := steamfiles.ReadMoveJournal(lib.Path, appNum)
+	DieIf(err, "")
+	if pending != nil {
+		fmt.Printf(" Resuming the move of app %d (%q) from %s (%s)\n",
+			appNum, pending.AppName, pending.From, pending.Phase)
+	} else if app, ok := inst.Apps[appNum]; ok {
+		fmt.Printf(" Moving app %d (%q) from %s to %s\n",
+			appNum, app.AppName, app.LibraryFolders[0], lib.Path)
+	}
+
+	opts := &steamfiles.MoveOptions{MinFreeSpace: int64(minFreeGiB * (1 << 30))}
+	if verbose {
+		opts.Progress = newProgressReporter()
+	}
+	err = steamfiles.MoveApp(ctx, inst, appNum, lib.Path, opts)
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			Die("interrupted; run the same command again to finish the move," +
+				" or use --abort to roll it back")
+		}
+		Die("%s", err)
+	}
+	fmt.Printf(" Moved app %d to %s\n", appNum, lib.Path)
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+func getAppNum(key string, parsedArgs docopt.Opts) AppNum {
+	arg := getArg(key, parsedArgs)
+	n, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil || n <= 0 {
+		Die2("usage", "%q is not an app number", arg)
+	}
+	return AppNum(n)
+}
+
+// getLibrary returns the Library for a Steam Library Folder given as an
+// argument.
+//
+func getLibrary(key string, parsedArgs docopt.Opts, inst *steamfiles.Installation,
+) *steamfiles.Library {
+	arg := getArg(key, parsedArgs)
+	if filepath.Base(arg) != "steamapps" {
+		subdir, err := steamfiles.DirectoryExists(arg, "steamapps")
+		DieIf(err, "cannot use %q: %s", arg, err)
+		arg = subdir
+	}
+	if lib := inst.Library(arg); lib != nil {
+		return lib
+	}
+	Die("%q is not one of Steam’s library folders", arg)
+	return nil
+}
+
+func warnBadSLF(slfPath string, e error) {
+	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
+}
+
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
+func listMoves(inst *steamfiles.Installation) {
+	moves, err := steamfiles.PendingMoves(inst)
+	DieIf(err, "")
+	if len(moves) == 0 {
+		fmt.Printf(" No unfinished moves\n")
+		return
+	}
+	for _, m := range moves {
+		fmt.Printf("  app %d (%q): %s → %s, %s since %s\n",
+			m.AppNumber, m.AppName, m.From, m.To, m.Phase,
+			m.Started.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+/*============================ Utility Functions =============================*/
+
+// newProgressReporter returns a ScanProgressReporter that shows the progress
+// of a move on stderr, at most a few times a second.
+//
+func newProgressReporter() steamfiles.ScanProgressReporter {
+	var last time.Time
+	return func(p steamfiles.ScanProgress) {
+		if time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r Copied and checked %d files (%s)   ",
+			p.Files, formatSize(p.Bytes))
+	}
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s [options] [<Steam-library-folder> ...]
+  %s (-h | --help  |  --version)
+
+List the directories and files that uninstalled Steam apps have left behind
+(‘orphans’), with their sizes, for each Steam library folder.  If no Steam
+library folders are specified as arguments, report on all of them.
+
+The kinds of orphan are:
+  install-dir   steamapps/common/<dir> (or music/<dir>) that no manifest uses
+  shadercache   steamapps/shadercache/<app#>
+  compatdata    steamapps/compatdata/<app#> (Proton prefixes, with saved games!)
+  workshop      steamapps/workshop/…/<app#> and appworkshop_<app#>.acf
+
+Nothing is removed unless both --clean and --yes are given; --clean on its own
+shows what would be removed.  Orphans are moved to the trash, not deleted, and
+nothing is removed if any Steam library folder cannot be scanned.
+
+Options:
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -k <kinds>        Only look for these kinds of orphan (comma-separated)
+  -j                Output JSON instead of text
+  -c, --clean       Show what removing the orphans would do
+  --yes             With --clean, really remove them
+  -v                Output progress reports
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	kinds := getKinds(getArg("-k", parsedArgs))
+	outputJSON := optSpecified("-j", parsedArgs)
+	clean := optSpecified("--clean", parsedArgs)
+	really := optSpecified("--yes", parsedArgs)
+	verbose := optSpecified("-v", parsedArgs)
+	if really && !clean {
+		Die2("usage", "--yes only makes sense with --clean")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Load every library, even if only some are to be reported on, so that
+	// apps installed elsewhere are not mistaken for uninstalled ones.  Apps
+	// in libraries that cannot be scanned now (fx, on a drive that is not
+	// mounted) are known from their cached inventories, if any.
+	cacheDir, err := steamfiles.DefaultCacheDir()
+	WarnIf(err, "cannot use cached library inventories: %s", err)
+	inst, err := steamfiles.LoadInstallation(ctx, &steamfiles.LoadOptions{
+		NoBackups:        true,
+		CacheDir:         cacheDir,
+		ReportBadLibrary: warnBadSLF,
+		ReportProblem:    warnLoadProblem})
+	DieIf(err, "")
+	if really && nBadLibraries > 0 {
+		Die("not removing anything, since some libraries could not be scanned" +
+			" and their apps might look uninstalled")
+	}
+	libraries := getLibraries("<Steam-library-folder>", parsedArgs, inst)
+
+	var scanOpts *steamfiles.ScanOptions
+	if verbose {
+		scanOpts = &steamfiles.ScanOptions{Progress: newProgressReporter()}
+	}
+	orphans, err := steamfiles.FindOrphans(ctx, inst, scanOpts)
+	DieIf(err, "")
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	orphans = selectOrphans(orphans, kinds, libraries)
+
+	switch {
+	case outputJSON && !really:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		DieIf(enc.Encode(orphans), "")
+	case !really:
+		reportOrphans(orphans, inst, clean)
+	default:
+		removeOrphans(orphans)
+	}
+	if nWarnings > 0 {
+		os.Exit(1)
+	}
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+// getKinds parses the -k option, returning nil (meaning all kinds) if it was
+// not given.
+//
+func getKinds(arg string) map[steamfiles.OrphanKind]bool {
+	if arg == "" {
+		return nil
+	}
+	ret := make(map[steamfiles.OrphanKind]bool)
+	for _, word := range strings.Split(arg, ",") {
+		kind, ok := steamfiles.OrphanKind(strings.TrimSpace(word)), false
+		for _, k := range steamfiles.OrphanKinds {
+			ok = ok || k == kind
+		}
+		if !ok {
+			Die2("usage", "unknown kind of orphan %q (want one of %q)",
+				word, steamfiles.OrphanKinds)
+		}
+		ret[kind] = true
+	}
+	return ret
+}
+
+// getLibraries returns the libraries named as arguments, or nil (meaning all
+// of them) if there are none.
+//
+func getLibraries(key string, parsedArgs docopt.Opts, inst *steamfiles.Installation,
+) map[*steamfiles.Library]bool {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	SLFargs, ok := argsItem.([]string)
+	if !ok {
+		Die2("BUG", "docopt[%q] == %#v", key, argsItem)
+	}
+	if len(SLFargs) == 0 {
+		return nil
+	}
+
+	ret := make(map[*steamfiles.Library]bool)
+	for _, arg := range SLFargs {
+		if filepath.Base(arg) != "steamapps" {
+			subdir, err := steamfiles.DirectoryExists(arg, "steamapps")
+			if err != nil {
+				Warn("cannot scan %q: %s", arg, err)
+				continue
+			}
+			arg = subdir
+		}
+		if lib := inst.Library(arg); lib != nil {
+			ret[lib] = true
+		} else {
+			Warn("%q is not one of Steam’s library folders", arg)
+		}
+	}
+	if len(ret) == 0 {
+		Die("no library folders to report on")
+	}
+	return ret
+}
+
+// nBadLibraries counts the libraries that warnBadSLF has reported.
+//
+var nBadLibraries int
+
+func warnBadSLF(slfPath string, e error) {
+	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
+	nBadLibraries++
+}
+
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
+/*=============================== The orphans ================================*/
+
+func selectOrphans(orphans []*steamfiles.Orphan,
+	kinds map[steamfiles.OrphanKind]bool, libraries map[*steamfiles.Library]bool,
+) []*steamfiles.Orphan {
+	libPaths := make(map[string]bool)
+	for lib := range libraries {
+		libPaths[lib.Path] = true
+	}
+	ret := make([]*steamfiles.Orphan, 0, len(orphans))
+	for _, o := range orphans {
+		if (kinds == nil || kinds[o.Kind]) &&
+			(libraries == nil || libPaths[o.Library]) {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+func reportOrphans(orphans []*steamfiles.Orphan, inst *steamfiles.Installation,
+	clean bool,
+) {
+	if len(orphans) == 0 {
+		fmt.Printf(" No orphans found\n")
+		return
+	}
+
+	var total int64
+	for i := 0; i < len(orphans); {
+		lib := orphans[i].Library
+		j, libTotal := i, int64(0)
+		for ; j < len(orphans) && orphans[j].Library == lib; j++ {
+			libTotal += orphans[j].Size
+		}
+		fmt.Printf("%s: %s in %s\n",
+			lib, formatSize(libTotal), countOf(j-i, "orphan"))
+		for _, o := range orphans[i:j] {
+			rel, err := filepath.Rel(lib, o.Path)
+			if err != nil {
+				rel = o.Path
+			}
+			fmt.Printf("  %9s  %-11s  %s%s\n",
+				formatSize(o.Size), o.Kind, rel, appNote(o, inst))
+		}
+		total += libTotal
+		i = j
+	}
+	fmt.Printf(" Total: %s in %s\n", formatSize(total), countOf(len(orphans), "orphan"))
+
+	if clean {
+		fmt.Printf("\nWould remove %s, freeing %s.\n"+
+			"Check the list (compatdata directories hold Proton saved games),\n"+
+			"then run again with --clean --yes to move them to the trash.\n",
+			countOf(len(orphans), "orphan"), formatSize(total))
+	}
+}
+
+// appNote describes what an orphan belonged to, if that is known.
+//
+func appNote(o *steamfiles.Orphan, inst *steamfiles.Installation) string {
+	if o.AppNumber == 0 {
+		return ""
+	}
+	if b, ok := inst.Backups[o.AppNumber]; ok {
+		return fmt.Sprintf("  (app %d, %q)", o.AppNumber, b.BackupName)
+	}
+	return fmt.Sprintf("  (app %d)", o.AppNumber)
+}
+
+// removeOrphans moves orphans to the trash rather than deleting them, since
+// a mistake could lose saved games.
+//
+func removeOrphans(orphans []*steamfiles.Orphan) {
+	var freed int64
+	nRemoved := 0
+	for _, o := range orphans {
+		if _, err := steamfiles.MoveToTrash(o.Path); err != nil {
+			Warn("%s", err)
+			continue
+		}
+		fmt.Printf(" Trashed %s (%s)\n", o.Path, formatSize(o.Size))
+		freed += o.Size
+		nRemoved += 1
+	}
+	fmt.Printf(" Moved %s to the trash; emptying it will free %s\n",
+		countOf(nRemoved, "orphan"), formatSize(freed))
+}
+
+/*============================ Utility Functions =============================*/
+
+// newProgressReporter returns a ScanProgressReporter that shows the progress
+// of a scan on stderr, at most a few times a second.
+//
+func newProgressReporter() steamfiles.ScanProgressReporter {
+	var last time.Time
+	return func(p steamfiles.ScanProgress) {
+		if time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r Examined %d files (%s)   ",
+			p.Files, formatSize(p.Bytes))
+	}
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "one " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
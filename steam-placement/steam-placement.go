@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s [options] [<fast-Steam-library-folder> ...]
+  %s (-h | --help  |  --version)
+
+Plan where installed Steam apps should live: apps played recently in the fast
+Steam library folders (on SSDs) named as arguments, and the others in the
+remaining, slow ones (on HDDs), while keeping some space free in every library.
+With no arguments, only the free space is balanced.
+
+The plan goes by the SizeOnDisk and LastPlayed values in the apps’ manifests.
+Nothing is moved: review the plan, then carry it out with steam-move (-s
+outputs a shell script that does that) or by hand.
+
+Options:
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -d <days>         Apps played within this many days count as recent
+                    [default: 30]
+  -m <GiB>          Keep at least this much space free in every library
+                    [default: 10]
+  -j                Output JSON instead of text
+  -s                Output a shell script of steam-move commands
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	days, err := strconv.ParseFloat(getArg("-d", parsedArgs), 64)
+	if err != nil || days < 0 {
+		Die2("usage", "bad number of days %q for -d", getArg("-d", parsedArgs))
+	}
+	minFreeGiB, err := strconv.ParseFloat(getArg("-m", parsedArgs), 64)
+	if err != nil || minFreeGiB < 0 {
+		Die2("usage", "bad free space %q for -m", getArg("-m", parsedArgs))
+	}
+	outputJSON := optSpecified("-j", parsedArgs)
+	outputScript := optSpecified("-s", parsedArgs)
+	if outputJSON && outputScript {
+		Die2("usage", "-j and -s cannot be used together")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	inst, err := steamfiles.LoadInstallation(ctx, &steamfiles.LoadOptions{
+		NoBackups:        true,
+		ReportBadLibrary: warnBadSLF,
+		ReportProblem:    warnLoadProblem})
+	DieIf(err, "")
+
+	policy := &steamfiles.PlacementPolicy{
+		FastLibraries:  getFastLibraries("<fast-Steam-library-folder>", parsedArgs, inst),
+		RecentlyPlayed: time.Duration(days * 24 * float64(time.Hour)),
+		MinFreeSpace:   int64(minFreeGiB * (1 << 30)),
+	}
+	plan, err := steamfiles.PlanPlacement(inst, policy)
+	DieIf(err, "")
+
+	switch {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		DieIf(enc.Encode(plan), "")
+	case outputScript:
+		writeScript(plan)
+	default:
+		reportPlan(plan)
+	}
+	if nWarnings > 0 {
+		os.Exit(1)
+	}
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+// getFastLibraries returns the "steamapps" directories of the libraries named
+// as arguments.
+//
+func getFastLibraries(key string, parsedArgs docopt.Opts, inst *steamfiles.Installation,
+) []string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	SLFargs, ok := argsItem.([]string)
+	if !ok {
+		Die2("BUG", "docopt[%q] == %#v", key, argsItem)
+	}
+
+	var ret []string
+	for _, arg := range SLFargs {
+		if filepath.Base(arg) != "steamapps" {
+			subdir, err := steamfiles.DirectoryExists(arg, "steamapps")
+			DieIf(err, "cannot use %q: %s", arg, err)
+			arg = subdir
+		}
+		lib := inst.Library(arg)
+		if lib == nil {
+			Die("%q is not one of Steam’s library folders", arg)
+		}
+		ret = append(ret, lib.Path)
+	}
+	return ret
+}
+
+func warnBadSLF(slfPath string, e error) {
+	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
+}
+
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
+/*================================= The plan =================================*/
+
+func reportPlan(plan *steamfiles.PlacementPlan) {
+	for _, ls := range plan.Space {
+		speed := "slow"
+		if ls.Fast {
+			speed = "fast"
+		}
+		fmt.Printf("%s (%s): %s free, %s after the moves\n",
+			filepath.Dir(ls.Library), speed,
+			formatSize(ls.Free), formatSize(ls.FreeAfter))
+	}
+
+	if len(plan.Moves) == 0 {
+		fmt.Printf(" No moves needed\n")
+	} else {
+		var total int64
+		fmt.Printf("Moves, in order:\n")
+		for i, m := range plan.Moves {
+			fmt.Printf("  %2d. app %d (%q), %s: %s → %s — %s\n",
+				i+1, m.AppNumber, m.AppName, formatSize(m.Size),
+				filepath.Dir(m.From), filepath.Dir(m.To), m.Reason)
+			total += m.Size
+		}
+		fmt.Printf(" Total: %s, moving %s\n",
+			countOf(len(plan.Moves), "move"), formatSize(total))
+	}
+
+	for _, m := range plan.Unplaced {
+		fmt.Printf(" No room to move app %d (%q), %s, out of %s — %s\n",
+			m.AppNumber, m.AppName, formatSize(m.Size),
+			filepath.Dir(m.From), m.Reason)
+	}
+	for _, m := range plan.Skipped {
+		fmt.Printf(" Not moving app %d (%q) from %s — %s\n",
+			m.AppNumber, m.AppName, filepath.Dir(m.From), m.Reason)
+	}
+}
+
+// writeScript outputs a plan as a shell script that runs steam-move for each
+// move, stopping at the first failure.
+//
+func writeScript(plan *steamfiles.PlacementPlan) {
+	fmt.Printf("#!/bin/sh\n# Written by steam-placement on %s\nset -e\n",
+		time.Now().Format("2006-01-02 15:04"))
+	for _, m := range plan.Moves {
+		fmt.Printf("\n# %q, %s — %s\nsteam-move %d %s\n",
+			m.AppName, formatSize(m.Size), m.Reason,
+			m.AppNumber, shellQuote(filepath.Dir(m.To)))
+	}
+}
+
+// shellQuote quotes a string for sh.
+//
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+/*============================ Utility Functions =============================*/
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "one " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
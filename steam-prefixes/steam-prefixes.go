@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/docopt/docopt-go"
+)
+
+type AppNum = steamfiles.AppNum
+
+/*=================================== CLI ====================================*/
+
+const VERSION = "0.1"
+
+const USAGEf = `Usage:
+  %s [options] [-b <backups-dir>]... [list]
+  %s [options] [-b <backups-dir>]... archive <app#>...
+  %s [options] [-b <backups-dir>]... restore [--force] <app#>...
+  %s (-h | --help  |  --version)
+
+List, archive or restore the Proton prefixes (steamapps/compatdata/<app#>) of
+Steam apps.  Many Windows games keep their saved games and settings in their
+prefix, and Steam’s backups do not include it.
+
+  list     Show each prefix with its size, when it last changed, the app it
+           belongs to and the compatibility tool the app uses
+  archive  Save each app’s prefix as <backup>.compatdata_<app#>.tar.gz, next
+           to the app’s Steam backup (so the app must have a backup)
+  restore  Unpack such an archive into the app’s library (or, if the app is
+           not installed, the Steam home directory’s library).  An existing
+           prefix is only replaced if --force is given, and is then kept as
+           <app#>.replaced-<time>.
+
+Do not restore a prefix while Steam is running the app.
+
+Options:
+  -b <backups-dir>  Look for backups here instead of in Steam’s default place
+                    (give it once for each backups directory)
+  -H <steam-home>   Use this Steam installation (overrides $STEAM_DIR)
+  -j                With list, output JSON instead of text
+  -v                Output progress reports
+`
+
+func main() {
+	progName := filepath.Base(os.Args[0])
+	usageText := fmt.Sprintf(USAGEf,
+		progName, progName, progName, progName)
+	parsedArgs, err :=
+		docopt.ParseArgs(usageText, os.Args[1:], VERSION)
+	DieIf2(err, "BUG", "docopt failed: %s", err)
+
+	steamfiles.SteamHomeOverride = getArg("-H", parsedArgs)
+	backupsDirs := getArgs("-b", parsedArgs)
+	outputJSON := optSpecified("-j", parsedArgs)
+	verbose := optSpecified("-v", parsedArgs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	loadOpts := &steamfiles.LoadOptions{ReportBadLibrary: warnBadSLF,
+		ReportProblem: warnLoadProblem}
+	for _, dir := range backupsDirs {
+		loadOpts.BackupsDirs = append(loadOpts.BackupsDirs, filepath.Clean(dir))
+	}
+	inst, err := steamfiles.LoadInstallation(ctx, loadOpts)
+	DieIf(err, "")
+
+	var scanOpts *steamfiles.ScanOptions
+	if verbose {
+		scanOpts = &steamfiles.ScanOptions{Progress: newProgressReporter()}
+	}
+
+	switch {
+	case optSpecified("archive", parsedArgs):
+		prefixes := findPrefixes(ctx, inst, scanOpts, verbose)
+		for _, appNum := range getAppNums("<app#>", parsedArgs) {
+			archivePrefix(ctx, inst, prefixes, appNum, scanOpts, verbose)
+		}
+	case optSpecified("restore", parsedArgs):
+		force := optSpecified("--force", parsedArgs)
+		for _, appNum := range getAppNums("<app#>", parsedArgs) {
+			restorePrefix(ctx, inst, appNum, force)
+		}
+	default:
+		prefixes := findPrefixes(ctx, inst, scanOpts, verbose)
+		if outputJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			DieIf(enc.Encode(prefixes), "")
+		} else {
+			listPrefixes(inst, prefixes)
+		}
+	}
+	if nWarnings > 0 {
+		os.Exit(1)
+	}
+}
+
+func optSpecified(key string, parsedArgs docopt.Opts) bool {
+	val, err := parsedArgs.Bool(key)
+	if err != nil {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	return val
+}
+
+func getArg(key string, parsedArgs docopt.Opts) string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	if argsItem == nil {
+		return ""
+	}
+	string, haveString := argsItem.(string)
+	if !haveString {
+		Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	}
+	return string
+}
+
+// getArgs returns the values of an option that can be given more than once.
+//
+func getArgs(key string, parsedArgs docopt.Opts) []string {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	switch v := argsItem.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	Die2("BUG", "weird value %#v for %q in docopt result", argsItem, key)
+	return nil
+}
+
+func getAppNums(key string, parsedArgs docopt.Opts) []AppNum {
+	argsItem, haveItem := parsedArgs[key]
+	if !haveItem {
+		Die2("BUG", "no key %q in docopt result %+#v", key, parsedArgs)
+	}
+	args, ok := argsItem.([]string)
+	if !ok {
+		Die2("BUG", "docopt[%q] == %#v", key, argsItem)
+	}
+	var ret []AppNum
+	for _, arg := range args {
+		n, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil || n <= 0 {
+			Die2("usage", "%q is not an app number", arg)
+		}
+		ret = append(ret, AppNum(n))
+	}
+	return ret
+}
+
+func warnBadSLF(slfPath string, e error) {
+	Warn("invalid Steam Library Folder %q: %s", slfPath, e)
+}
+
+func warnLoadProblem(e error) {
+	Warn("%s", e)
+}
+
+/*================================= Listing ==================================*/
+
+func findPrefixes(ctx context.Context, inst *steamfiles.Installation,
+	scanOpts *steamfiles.ScanOptions, verbose bool,
+) []*steamfiles.CompatPrefix {
+	prefixes, err := steamfiles.FindCompatPrefixes(ctx, inst, scanOpts)
+	DieIf(err, "")
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	return prefixes
+}
+
+func listPrefixes(inst *steamfiles.Installation,
+	prefixes []*steamfiles.CompatPrefix,
+) {
+	if len(prefixes) == 0 {
+		fmt.Printf(" No Proton prefixes found\n")
+		return
+	}
+	tools, err := steamfiles.ReadCompatToolMapping(inst.Home)
+	DieIf(err, "")
+	if t, ok := tools[0]; ok && t.Name != "" {
+		fmt.Printf("Default compatibility tool: %s\n", t.Name)
+	}
+
+	var total int64
+	for i := 0; i < len(prefixes); {
+		lib := prefixes[i].Library
+		j, libTotal := i, int64(0)
+		for ; j < len(prefixes) && prefixes[j].Library == lib; j++ {
+			libTotal += prefixes[j].Size
+		}
+		fmt.Printf("%s: %s in %s\n",
+			lib, formatSize(libTotal), countOf(j-i, "prefix"))
+		for _, p := range prefixes[i:j] {
+			fmt.Printf("  %9s  %s  %8d  %s%s%s\n",
+				formatSize(p.Size), formatTime(p.ModTime), p.AppNumber,
+				appDesc(p, inst), toolNote(p), archiveNote(p, inst))
+		}
+		total += libTotal
+		i = j
+	}
+	fmt.Printf(" Total: %s in %s\n", formatSize(total), countOf(len(prefixes), "prefix"))
+}
+
+// appDesc describes the app a prefix belongs to.
+//
+func appDesc(p *steamfiles.CompatPrefix, inst *steamfiles.Installation) string {
+	switch {
+	case p.AppName != "":
+		return fmt.Sprintf("%q", p.AppName)
+	case inst.Backups[p.AppNumber] != nil:
+		return fmt.Sprintf("%q (not installed)", inst.Backups[p.AppNumber].BackupName)
+	default:
+		return "(not installed)"
+	}
+}
+
+func toolNote(p *steamfiles.CompatPrefix) string {
+	switch {
+	case p.CompatTool != "" && p.ProtonVersion != "":
+		return fmt.Sprintf(", uses %s (prefix from %s)", p.CompatTool, p.ProtonVersion)
+	case p.CompatTool != "":
+		return ", uses " + p.CompatTool
+	case p.ProtonVersion != "":
+		return fmt.Sprintf(", prefix from %s", p.ProtonVersion)
+	}
+	return ""
+}
+
+// archiveNote says whether there is an archive of a prefix, and whether the
+// prefix has changed since.
+//
+func archiveNote(p *steamfiles.CompatPrefix, inst *steamfiles.Installation) string {
+	b := inst.Backups[p.AppNumber]
+	if b == nil {
+		return ""
+	}
+	info, err := os.Stat(steamfiles.CompatArchivePath(b, p.AppNumber))
+	switch {
+	case err != nil:
+		return ""
+	case p.ModTime.After(info.ModTime()):
+		return ", archive is older"
+	default:
+		return ", archived"
+	}
+}
+
+/*========================= Archiving and Restoring ==========================*/
+
+func archivePrefix(ctx context.Context, inst *steamfiles.Installation,
+	prefixes []*steamfiles.CompatPrefix, appNum AppNum,
+	scanOpts *steamfiles.ScanOptions, verbose bool,
+) {
+	p := steamfiles.CompatPrefixFor(prefixes, inst.Apps[appNum], appNum)
+	if p == nil {
+		Warn("app %d has no Proton prefix", appNum)
+		return
+	}
+	b := inst.Backups[appNum]
+	if b == nil {
+		Warn("app %d has no Steam backup to archive its prefix next to", appNum)
+		return
+	}
+	archivePath := steamfiles.CompatArchivePath(b, appNum)
+
+	// Write to a temporary file, so that an interrupted run does not
+	// clobber an older archive.
+	tmpPath := archivePath + ".tmp"
+	fh, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		Warn("cannot create %q: %s", tmpPath, err)
+		return
+	}
+	err = steamfiles.WriteTreeArchive(ctx, fh, p.Path, scanOpts)
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, archivePath)
+	}
+	if verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		DieIf(ctx.Err(), "interrupted")
+		Warn("cannot archive %q: %s", p.Path, err)
+		return
+	}
+	info, err := os.Stat(archivePath)
+	DieIf(err, "")
+	fmt.Printf(" Archived %s (%s) as %s (%s)\n",
+		p.Path, formatSize(p.Size), archivePath, formatSize(info.Size()))
+}
+
+func restorePrefix(ctx context.Context, inst *steamfiles.Installation,
+	appNum AppNum, force bool,
+) {
+	var archivePath string
+	for _, b := range inst.BackupsOf(appNum) {
+		path := steamfiles.CompatArchivePath(b, appNum)
+		if _, err := os.Stat(path); err == nil {
+			archivePath = path
+			break
+		}
+	}
+	if archivePath == "" {
+		Warn("found no archived prefix for app %d", appNum)
+		return
+	}
+
+	libPath := inst.Libraries[0].Path
+	for _, lib := range inst.Libraries {
+		if lib.IsHome {
+			libPath = lib.Path
+		}
+	}
+	if app, ok := inst.Apps[appNum]; ok && inst.LibraryOf(app) != nil {
+		libPath = inst.LibraryOf(app).Path
+	}
+	compatDir := filepath.Join(libPath, "compatdata")
+	prefixPath := filepath.Join(compatDir, strconv.Itoa(int(appNum)))
+	_, err := os.Lstat(prefixPath)
+	exists := err == nil
+	if exists && !force {
+		Warn("%q already exists (use --force to replace it)", prefixPath)
+		return
+	}
+
+	// Unpack beside the prefix, then swap it in, so that a failure leaves
+	// the existing prefix alone.
+	if err := os.MkdirAll(compatDir, 0755); err != nil {
+		Warn("cannot create %q: %s", compatDir, err)
+		return
+	}
+	stamp := time.Now().Format("20060102-150405")
+	newPath := prefixPath + ".restoring-" + stamp
+	fh, err := os.Open(archivePath)
+	if err != nil {
+		Warn("cannot open %q: %s", archivePath, err)
+		return
+	}
+	err = steamfiles.ExtractArchive(ctx, fh, newPath)
+	fh.Close()
+	if err != nil {
+		os.RemoveAll(newPath)
+		DieIf(ctx.Err(), "interrupted")
+		Warn("cannot restore %q: %s", archivePath, err)
+		return
+	}
+	oldPath := prefixPath + ".replaced-" + stamp
+	if exists {
+		if err := os.Rename(prefixPath, oldPath); err != nil {
+			os.RemoveAll(newPath)
+			Warn("cannot move %q aside: %s", prefixPath, err)
+			return
+		}
+	}
+	if err := os.Rename(newPath, prefixPath); err != nil {
+		// Put the old prefix back, so that the app still has one.
+		if exists {
+			if err2 := os.Rename(oldPath, prefixPath); err2 != nil {
+				Die("cannot rename %q to %q: %s\n"+
+					"\tand cannot put the old prefix back from %q: %s",
+					newPath, prefixPath, err, oldPath, err2)
+			}
+		}
+		os.RemoveAll(newPath)
+		Warn("cannot rename %q to %q: %s", newPath, prefixPath, err)
+		return
+	}
+	if exists {
+		fmt.Printf(" Kept the old prefix as %s\n", oldPath)
+	}
+	fmt.Printf(" Restored %s from %s\n", prefixPath, archivePath)
+}
+
+/*============================ Utility Functions =============================*/
+
+// newProgressReporter returns a ScanProgressReporter that shows the progress
+// of a scan on stderr, at most a few times a second.
+//
+func newProgressReporter() steamfiles.ScanProgressReporter {
+	var last time.Time
+	return func(p steamfiles.ScanProgress) {
+		if time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r Examined %d files (%s)   ",
+			p.Files, formatSize(p.Bytes))
+	}
+}
+
+func countOf(n int, noun string) string {
+	switch {
+	case n == 1:
+		return "one " + noun
+	case noun == "prefix":
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "(empty)         "
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatSize formats a number of bytes for people to read.
+//
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
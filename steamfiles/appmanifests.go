@@ -4,9 +4,13 @@
 package steamfiles
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,11 +28,113 @@ import (
 // and ensures that .LibraryFolders[0] is the directory holding that file.
 //
 type InstalledApp struct {
-	AppNumber      AppNum    // The app’s identifier
-	AppName        string    // The app’s name
-	LibraryFolders []string  // Which Steam library folders the app was found in
-	InstallDir     string    // Its files go in/under <LibraryDir>/common/<InstallDir>
-	ModTime        time.Time // When the manifest file was last modified
+	AppNumber       AppNum        // The app’s identifier
+	AppName         string        // The app’s name
+	LibraryFolders  []string      // Which Steam library folders the app was found in
+	InstallDir      string        // Its files go in/under <LibraryDir>/common/<InstallDir>
+	ModTime         time.Time     // When the manifest file was last modified
+	StateFlags      AppStateFlags // What state Steam thinks the app is in
+	SizeOnDisk      int64         // How many bytes Steam thinks the app’s files take
+	LastUpdated     time.Time     // When Steam last updated the app (zero if unknown)
+	LastPlayed      time.Time     // When the app was last played (zero if never)
+	BytesToDownload int64         // Size of the current or last update’s download
+	BytesDownloaded int64         // How much of that has been downloaded
+	BytesToStage    int64         // Size of the current or last update’s staged files
+	BytesStaged     int64         // How much of that has been staged
+	BuildID         int64         // Which build of the app is installed (zero if unknown)
+	InstalledDepots map[DepotNum]InstalledDepot
+}
+
+// AppStateFlags holds the "StateFlags" value from an app’s manifest, a set of
+// bits that say what Steam thinks of the installed app.  Valve does not
+// document them, but their names are well known from Steam’s own strings.
+//
+type AppStateFlags uint32
+
+const (
+	AppStateUninstalled    AppStateFlags = 1 << 0
+	AppStateUpdateRequired AppStateFlags = 1 << 1
+	AppStateFullyInstalled AppStateFlags = 1 << 2
+	AppStateEncrypted      AppStateFlags = 1 << 3
+	AppStateLocked         AppStateFlags = 1 << 4
+	AppStateFilesMissing   AppStateFlags = 1 << 5
+	AppStateAppRunning     AppStateFlags = 1 << 6
+	AppStateFilesCorrupt   AppStateFlags = 1 << 7
+	AppStateUpdateRunning  AppStateFlags = 1 << 8
+	AppStateUpdatePaused   AppStateFlags = 1 << 9
+	AppStateUpdateStarted  AppStateFlags = 1 << 10
+	AppStateUninstalling   AppStateFlags = 1 << 11
+	AppStateBackupRunning  AppStateFlags = 1 << 12
+	AppStateReconfiguring  AppStateFlags = 1 << 16
+	AppStateValidating     AppStateFlags = 1 << 17
+	AppStateAddingFiles    AppStateFlags = 1 << 18
+	AppStatePreallocating  AppStateFlags = 1 << 19
+	AppStateDownloading    AppStateFlags = 1 << 20
+	AppStateStaging        AppStateFlags = 1 << 21
+	AppStateCommitting     AppStateFlags = 1 << 22
+	AppStateUpdateStopping AppStateFlags = 1 << 23
+)
+
+var appStateNames = []struct {
+	flag AppStateFlags
+	name string
+}{
+	{AppStateUninstalled, "Uninstalled"},
+	{AppStateUpdateRequired, "UpdateRequired"},
+	{AppStateFullyInstalled, "FullyInstalled"},
+	{AppStateEncrypted, "Encrypted"},
+	{AppStateLocked, "Locked"},
+	{AppStateFilesMissing, "FilesMissing"},
+	{AppStateAppRunning, "AppRunning"},
+	{AppStateFilesCorrupt, "FilesCorrupt"},
+	{AppStateUpdateRunning, "UpdateRunning"},
+	{AppStateUpdatePaused, "UpdatePaused"},
+	{AppStateUpdateStarted, "UpdateStarted"},
+	{AppStateUninstalling, "Uninstalling"},
+	{AppStateBackupRunning, "BackupRunning"},
+	{AppStateReconfiguring, "Reconfiguring"},
+	{AppStateValidating, "Validating"},
+	{AppStateAddingFiles, "AddingFiles"},
+	{AppStatePreallocating, "Preallocating"},
+	{AppStateDownloading, "Downloading"},
+	{AppStateStaging, "Staging"},
+	{AppStateCommitting, "Committing"},
+	{AppStateUpdateStopping, "UpdateStopping"},
+}
+
+// Has reports whether all of the flags in g are set in f.
+//
+func (f AppStateFlags) Has(g AppStateFlags) bool {
+	return f&g == g
+}
+
+// String returns the names of the flags that are set, separated by '|', fx
+// "FullyInstalled|UpdateRequired".  Unknown bits are shown in hex.
+//
+func (f AppStateFlags) String() string {
+	if f == 0 {
+		return "Invalid"
+	}
+	var names []string
+	for _, sn := range appStateNames {
+		if f&sn.flag != 0 {
+			names = append(names, sn.name)
+			f &^= sn.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// An InstalledDepot holds the details of a depot from the "InstalledDepots"
+// section of an appmanifest_<AppNum>.acf file.
+//
+type InstalledDepot struct {
+	Manifest  ManifestID // Which version of the depot is installed
+	Size      int64      // The total size of the depot’s files
+	DLCAppNum AppNum     // The DLC the depot belongs to, or zero
 }
 
 // ScanSteamLibDir adds InstalledApp values to a map indexed by AppNum.
@@ -63,67 +169,147 @@ type OldManifestReporter func(prev, curr *InstalledApp, usingCurr bool)
 func ScanSteamLibDir(
 	libPath string, theMap map[AppNum]*InstalledApp, handleDiff OldManifestReporter,
 ) error {
-	if handleDiff == nil {
-		handleDiff = ignoreDiff
-	}
-	dh, err := os.Open(libPath)
+	return std.ScanSteamLibDir(libPath, theMap, handleDiff)
+}
+
+// ScanSteamLibDir is the Scanner method behind the ScanSteamLibDir function.
+//
+func (s *Scanner) ScanSteamLibDir(
+	libPath string, theMap map[AppNum]*InstalledApp, handleDiff OldManifestReporter,
+) error {
+	return s.ScanSteamLibDirContext(context.Background(),
+		libPath, theMap, handleDiff, nil)
+}
+
+// ScanSteamLibDirContext is like ScanSteamLibDir, but reads manifests
+// concurrently (as opts allows), reports progress and stops early if ctx is
+// done, in which case it returns ctx.Err() and leaves theMap unchanged.
+//
+// The results do not depend on the order in which the manifests get read:
+// ScanSteamLibDirContext updates theMap and calls handleDiff in the same order
+// ScanSteamLibDir does, and if several manifests are bad, it reports the one
+// whose name sorts first.
+//
+func ScanSteamLibDirContext(ctx context.Context,
+	libPath string, theMap map[AppNum]*InstalledApp, handleDiff OldManifestReporter,
+	opts *ScanOptions,
+) error {
+	return std.ScanSteamLibDirContext(ctx, libPath, theMap, handleDiff, opts)
+}
+
+// ScanSteamLibDirContext is the Scanner method behind the
+// ScanSteamLibDirContext function.
+//
+func (s *Scanner) ScanSteamLibDirContext(ctx context.Context,
+	libPath string, theMap map[AppNum]*InstalledApp, handleDiff OldManifestReporter,
+	opts *ScanOptions,
+) error {
+	apps, err := s.readManifests(ctx, libPath, opts)
 	if err != nil {
-		return cannot("open", "Steam library folder", libPath, err)
+		return err
+	}
+	if len(apps) == 0 {
+		return errs.Cannot("see any appmanifest_<N>.acf files in", "",
+			libPath, true, " — not a Steam library folder?", nil)
 	}
+	mergeInstalledApps(theMap, libPath, apps, handleDiff)
+	return nil
+}
 
-	allNames, err := dh.Readdirnames(-1)
-	dh.Close()
+// readManifests parses all the appmanifest_<app#>.acf files in a Steam library
+// directory (concurrently, as opts allows), and returns the results sorted by
+// file name, each with .LibraryFolders = {libPath}.  If several manifests are
+// bad, it reports the one whose name sorts first.
+//
+func (s *Scanner) readManifests(ctx context.Context,
+	libPath string, opts *ScanOptions,
+) ([]*InstalledApp, error) {
+	entries, err := s.fsys.ReadDir(libPath)
 	if err != nil {
-		return cannot("read", "directory", libPath, err)
+		return nil, cannot("read", "directory", libPath, err)
 	}
 
-	nFound := 0
-	for _, n := range allNames {
-		if match := reManifestFile.FindStringSubmatch(n); match != nil {
-			currInfo, err :=
-				parseManifest(filepath.Join(libPath, n))
-			if err != nil {
-				return err
-			}
-			appNum := currInfo.AppNumber
-			if strconv.Itoa(int(appNum)) != match[1] {
-				return fileError(n, "appid",
-					"wrong appid %d for file name", appNum)
+	type manifestFile struct {
+		name       string
+		appNumText string
+		size       int64
+		info       *InstalledApp
+		err        error
+	}
+	var found []*manifestFile
+	for _, e := range entries {
+		if match := reManifestFile.FindStringSubmatch(e.Name()); match != nil {
+			mf := &manifestFile{name: e.Name(), appNumText: match[1]}
+			if info, err := e.Info(); err == nil {
+				mf.size = info.Size()
 			}
+			found = append(found, mf)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].name < found[j].name })
+
+	scan := newScanState(ctx, opts)
+	err = scan.forEach(len(found), func(i int) {
+		mf := found[i]
+		mf.info, mf.err = s.parseManifest(filepath.Join(libPath, mf.name))
+		scan.visited(1, mf.size)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*InstalledApp, len(found))
+	for i, mf := range found {
+		if mf.err != nil {
+			return nil, mf.err
+		}
+		appNum := mf.info.AppNumber
+		if strconv.Itoa(int(appNum)) != mf.appNumText {
+			return nil, fileError(mf.name, "appid",
+				"wrong appid %d for file name", appNum)
+		}
+		mf.info.LibraryFolders = []string{libPath}
+		ret[i] = mf.info
+	}
+	return ret, nil
+}
 
-			prev, havePrev := theMap[appNum]
-			if havePrev {
-				// Assume that this manifest file is newer ...
-				newInfo, oldInfo, usingCurr :=
-					currInfo, prev, true
-				SLFlist := append(
-					[]string{libPath}, prev.LibraryFolders...)
-				if newInfo.ModTime.Before(oldInfo.ModTime) {
-					// ... or perhaps not.
-					newInfo, oldInfo, usingCurr =
-						prev, currInfo, false
-					SLFlist = append(
-						prev.LibraryFolders, libPath)
-				}
-				currInfo.LibraryFolders = []string{libPath}
-				handleDiff(prev, currInfo, usingCurr)
-				//
-				currInfo = newInfo
-				currInfo.LibraryFolders = SLFlist
-
-			} else {
-				currInfo.LibraryFolders = []string{libPath}
+// mergeInstalledApps adds the apps found in one Steam library directory to a
+// map, resolving duplicates as ScanSteamLibDir describes.
+//
+func mergeInstalledApps(theMap map[AppNum]*InstalledApp,
+	libPath string, apps []*InstalledApp, handleDiff OldManifestReporter,
+) {
+	if handleDiff == nil {
+		handleDiff = ignoreDiff
+	}
+	for _, currInfo := range apps {
+		appNum := currInfo.AppNumber
+		prev, havePrev := theMap[appNum]
+		if havePrev {
+			// Assume that this manifest file is newer ...
+			newInfo, oldInfo, usingCurr :=
+				currInfo, prev, true
+			SLFlist := append(
+				[]string{libPath}, prev.LibraryFolders...)
+			if newInfo.ModTime.Before(oldInfo.ModTime) {
+				// ... or perhaps not.
+				newInfo, oldInfo, usingCurr =
+					prev, currInfo, false
+				SLFlist = append(
+					prev.LibraryFolders, libPath)
 			}
-			theMap[appNum] = currInfo
-			nFound += 1
+			currInfo.LibraryFolders = []string{libPath}
+			handleDiff(prev, currInfo, usingCurr)
 			//
+			currInfo = newInfo
+			currInfo.LibraryFolders = SLFlist
+
+		} else {
+			currInfo.LibraryFolders = []string{libPath}
 		}
+		theMap[appNum] = currInfo
 	}
-	if nFound == 0 {
-		return errs.Cannot("see any appmanifest_<N>.acf files in", "",
-			libPath, true, " — not a Steam library folder?", nil)
-	}
-	return nil
 }
 
 // ignoreDiff is the default OldManifestReporter.
@@ -135,12 +321,18 @@ var reManifestFile = regexp.MustCompile(`^appmanifest_(\d+)\.acf$`)
 // parseManifest carefully (ie., with lots of checking) extracts details from an
 // appmanifest_<app#>.acf file.
 //
-func parseManifest(mfPath string) (*InstalledApp, error) {
-	mfInfo, err := sVDF.FromFile(mfPath, "AppState")
+func (s *Scanner) parseManifest(mfPath string) (*InstalledApp, error) {
+	mfInfo, err := sVDF.FromFS(s.fsys, mfPath, "AppState")
 	if err != nil {
 		return nil, err
 	}
+	return manifestFromVDF(mfInfo)
+}
 
+// manifestFromVDF does the work of parseManifest once the file is parsed.
+//
+func manifestFromVDF(mfInfo *sVDF.File) (*InstalledApp, error) {
+	mfPath := mfInfo.Path
 	idText, err := mfInfo.Lookup("appid")
 	if err != nil {
 		return nil, cannot("get app ID from", "", mfPath, err)
@@ -160,12 +352,100 @@ func parseManifest(mfPath string) (*InstalledApp, error) {
 		return nil, cannot(`get "installdir" from`, "", mfPath, err)
 	}
 
+	installedDepots, err := parseInstalledDepots(mfInfo)
+	if err != nil {
+		return nil, err
+	}
+
 	ret := &InstalledApp{
 		AppNumber: appNum,
 		AppName:   appName,
 		// ret.LibraryFolders is set by the caller, ScanSteamLibDir.
-		InstallDir: installDir,
-		ModTime:    mfInfo.ModTime}
+		InstallDir:      installDir,
+		ModTime:         mfInfo.ModTime,
+		InstalledDepots: installedDepots}
+
+	// The remaining fields are optional, since Steam has not always written
+	// them, and a bad value is not worth rejecting the manifest over.
+	if text, err := mfInfo.Lookup("StateFlags"); err == nil {
+		if n, err := strconv.ParseUint(text, 10, 32); err == nil {
+			ret.StateFlags = AppStateFlags(n)
+		}
+	}
+	for _, f := range []struct {
+		name string
+		ptr  *int64
+	}{
+		{"SizeOnDisk", &ret.SizeOnDisk},
+		{"BytesToDownload", &ret.BytesToDownload},
+		{"BytesDownloaded", &ret.BytesDownloaded},
+		{"BytesToStage", &ret.BytesToStage},
+		{"BytesStaged", &ret.BytesStaged},
+		{"buildid", &ret.BuildID},
+	} {
+		if text, err := mfInfo.Lookup(f.name); err == nil {
+			*f.ptr, _ = strconv.ParseInt(text, 10, 64)
+		}
+	}
+	ret.LastUpdated = manifestTime(mfInfo, "LastUpdated")
+	ret.LastPlayed = manifestTime(mfInfo, "LastPlayed")
+	return ret, nil
+}
+
+// manifestTime gets an optional timestamp (in seconds since the Unix epoch)
+// from an appmanifest_<app#>.acf file, returning the zero time if the field is
+// missing, zero or invalid.
+//
+func manifestTime(mfInfo *sVDF.File, name string) time.Time {
+	text, err := mfInfo.Lookup(name)
+	if err != nil {
+		return time.Time{}
+	}
+	secs, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
+// parseInstalledDepots extracts the (optional) "InstalledDepots" section from
+// an appmanifest_<app#>.acf file.
+//
+func parseInstalledDepots(mfInfo *sVDF.File) (map[DepotNum]InstalledDepot, error) {
+	ret := make(map[DepotNum]InstalledDepot)
+	if !mfInfo.HaveNVL("InstalledDepots") {
+		return ret, nil
+	}
+	nvl, err := mfInfo.LookupNVL("InstalledDepots")
+	if err != nil {
+		return nil, cannot(`get "InstalledDepots" from`, "", mfInfo.Path, err)
+	}
+	for _, depotText := range nvl.Names() {
+		depotNum, err := parseDepotNum(depotText, mfInfo.Path)
+		if err != nil {
+			return nil, err
+		}
+		manifestText, err := mfInfo.Lookup("InstalledDepots", depotText, "manifest")
+		if err != nil {
+			return nil, cannot("get depot manifest ID from", "", mfInfo.Path, err)
+		}
+		manifestID, err := strconv.ParseUint(manifestText, 10, 64)
+		if err != nil {
+			return nil, fileError(mfInfo.Path, "manifest",
+				"bad manifest ID %q for depot %d", manifestText, depotNum)
+		}
+		depot := InstalledDepot{Manifest: ManifestID(manifestID)}
+		if text, err := mfInfo.Lookup("InstalledDepots", depotText, "size"); err == nil {
+			depot.Size, _ = strconv.ParseInt(text, 10, 64)
+		}
+		if text, err := mfInfo.Lookup("InstalledDepots", depotText, "dlcappid"); err == nil {
+			depot.DLCAppNum, err = parseAppNum(text, mfInfo.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret[depotNum] = depot
+	}
 	return ret, nil
 }
 
@@ -191,148 +471,114 @@ func parseManifest(mfPath string) (*InstalledApp, error) {
 // dozen lines of code and a millisecond or so, so we do that.
 //
 func AppNewerThan(steamLibDir, appInstallDir string, skuTime time.Time) (bool, error) {
+	return std.AppNewerThan(steamLibDir, appInstallDir, skuTime)
+}
+
+// AppNewerThan is the Scanner method behind the AppNewerThan function.
+//
+func (s *Scanner) AppNewerThan(steamLibDir, appInstallDir string, skuTime time.Time) (bool, error) {
+	return s.AppNewerThanContext(context.Background(),
+		steamLibDir, appInstallDir, skuTime, nil)
+}
+
+// AppNewerThanContext is like AppNewerThan, but examines directories
+// concurrently (as opts allows), reports progress and gives up if ctx is done.
+//
+// It stops as soon as it finds a newer file.  If it finds none but cannot read
+// some directories, it reports the error for the directory that sorts first,
+// so its result does not depend on the order in which directories get read.
+//
+func AppNewerThanContext(ctx context.Context,
+	steamLibDir, appInstallDir string, skuTime time.Time, opts *ScanOptions,
+) (bool, error) {
+	return std.AppNewerThanContext(ctx, steamLibDir, appInstallDir, skuTime, opts)
+}
+
+// AppNewerThanContext is the Scanner method behind the AppNewerThanContext
+// function.
+//
+func (s *Scanner) AppNewerThanContext(ctx context.Context,
+	steamLibDir, appInstallDir string, skuTime time.Time, opts *ScanOptions,
+) (bool, error) {
+	appDir, err := s.findAppDir(steamLibDir, appInstallDir)
+	if err != nil {
+		return false, err
+	}
+	scan := newScanState(ctx, opts)
+	return scan.walkTreeParallel(appDir, func(dirPath string) ([]string, bool, error) {
+		return s.dirNewerThan(scan, dirPath, skuTime)
+	})
+}
+
+// findAppDir finds the directory that holds an installed app’s files, looking
+// in …/common then …/music, and correcting the case of appInstallDir if
+// necessary.  (See AppNewerThan for why.)
+//
+func (s *Scanner) findAppDir(steamLibDir, appInstallDir string) (string, error) {
 	installsDir := filepath.Join(steamLibDir, "common")
 	appDir := filepath.Join(installsDir, appInstallDir)
-	_, err := os.Lstat(appDir)
+	_, err := s.fsys.Lstat(appDir)
 	if err != nil && os.IsNotExist(err) {
-		appDir, err = findIgnoringCase(installsDir, appInstallDir)
+		appDir, err = s.findIgnoringCase(installsDir, appInstallDir)
 		if err != nil {
 			appMusicDir := filepath.Join(steamLibDir, "music")
-			appDir = filepath.Join(appMusicDir, appInstallDir)
-			_, err := os.Lstat(appDir)
-			if err != nil && os.IsNotExist(err) {
-				appDir, err = findIgnoringCase(appMusicDir, appInstallDir)
+			musicDir := filepath.Join(appMusicDir, appInstallDir)
+			_, musicErr := s.fsys.Lstat(musicDir)
+			if musicErr != nil && os.IsNotExist(musicErr) {
+				musicDir, musicErr =
+					s.findIgnoringCase(appMusicDir, appInstallDir)
+			}
+			if musicErr == nil {
+				appDir, err = musicDir, nil
 			}
 		}
 		if err != nil {
-			return false, err
+			return "", err
 		}
 	}
-	return anyFileNewerThan(appDir, skuTime)
+	return appDir, nil
 }
 
-// anyFileNewerThan is a helper function for appNewerThan. It checks the files in
-// a particular directory, then recurses to check subdirectories.
+// dirNewerThan is a helper function for AppNewerThanContext.  It checks the
+// files in a particular directory, and returns its subdirectories for checking
+// next, plus whether it found a newer file.
 //
-func anyFileNewerThan(dirPath string, t time.Time) (bool, error) {
-	dh, err := os.Open(dirPath)
-	if err != nil {
-		return false, cannot("open", "directory", dirPath, err)
-	}
-
-	nodes, err := dh.Readdir(-1)
-	dh.Close()
+func (s *Scanner) dirNewerThan(scan *scanState, dirPath string, t time.Time,
+) ([]string, bool, error) {
+	entries, err := s.fsys.ReadDir(dirPath)
 	if err != nil {
-		return false, cannot("read", "directory", dirPath, err)
+		return nil, false, cannot("read", "directory", dirPath, err)
 	}
 
-	subdirs := make([]string, 0, len(nodes))
-	for _, node := range nodes {
-		if node.IsDir() {
-			subdirs = append(subdirs, node.Name())
-		} else if isRegFile(node) {
+	var nFiles, nBytes int64
+	defer func() { scan.visited(nFiles, nBytes) }()
+	subdirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdirs = append(subdirs, filepath.Join(dirPath, entry.Name()))
+		} else if entry.Type().IsRegular() {
+			node, err := entry.Info()
+			if err != nil {
+				return nil, false, cannot("examine", "",
+					filepath.Join(dirPath, entry.Name()), err)
+			}
+			nFiles, nBytes = nFiles+1, nBytes+node.Size()
 			if node.ModTime().After(t) {
 				//D// fmt.Printf(" #D# file %q has mtime %s > %s\n",
 				//D//	filepath.Join(dirPath, node.Name()),
 				//D//	node.ModTime().Format("2006-01-02t15:04:05"),
 				//D//	t.Format("2006-01-02t15:04:05"))
-				return true, nil
+				return nil, true, nil
 			}
 		}
 	}
-
-	for _, subdir := range subdirs {
-		newer, err := anyFileNewerThan(filepath.Join(dirPath, subdir), t)
-		if err != nil {
-			return false, err
-		}
-		if newer {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return subdirs, false, nil
 }
 
-// isRegFile() is an oft-written one-liner to report whether an os.FileInfo
-// describes a regular file. If the FileInfo came from os.Stat(), a symlink to a
-// regular file will also count. (os.File.Readdir() uses os.Lstat().)
+// isRegFile() is an oft-written one-liner to report whether an fs.FileInfo
+// describes a regular file. If the FileInfo came from Stat(), a symlink to a
+// regular file will also count. (ReadDir() and Lstat() do not follow symlinks.)
 //
-func isRegFile(nodeInfo os.FileInfo) bool {
+func isRegFile(nodeInfo fs.FileInfo) bool {
 	return nodeInfo.Mode()&os.ModeType == 0
 }
-
-// On Linux, we cache the entry names in each "<SLF>/steamapps/common" directory
-// we encounter in namesCacheForDir, which maps each "…/common" directory path
-// to a second-level map from monocase(entryName) to entryName.
-//
-// On Windows and Mac, findIgnoringCase() never gets called (unless something is
-// badly amiss with the files in …/steamapps/ or …/music), so this variable
-// never becomes non-nil.
-//
-var namesCacheForDir map[string]map[string]string
-
-// findIgnoringCase(dirPath, wrongName) uses the name-case-correction-map for dirPath
-// (which must be of the form "/…/steamapps/common/") to find the correct form of
-// a wrongly-cased name, building the maps as necessary.
-//
-func findIgnoringCase(dirPath, wrongName string) (string, error) {
-	var err error
-	if namesCacheForDir == nil {
-		namesCacheForDir = make(map[string]map[string]string)
-	}
-
-	mapForDir, haveScannedDir := namesCacheForDir[dirPath]
-	if !haveScannedDir {
-		mapForDir, err = scanDirIgnoringCase(dirPath)
-		if err != nil {
-			return "", err
-		}
-		namesCacheForDir[dirPath] = mapForDir
-	}
-	mappedName, haveMappedName := mapForDir[monocase(wrongName)]
-	if !haveMappedName {
-		return "", cannot("find app, even ignoring case", "",
-			filepath.Join(dirPath, wrongName), os.ErrNotExist)
-	}
-	//D// fmt.Printf("#D# namesCacheForDir[%q][%q] = %q\n",
-	//D//	dirPath, monocase(wrongName), mappedName)
-	return filepath.Join(dirPath, mappedName), nil
-}
-
-// scanDirIgnoringCase is the recursive directory scanner for findIgnoringCase.
-//
-func scanDirIgnoringCase(dirPath string) (map[string]string, error) {
-	ret := make(map[string]string)
-
-	dh, err := os.Open(dirPath)
-	if err != nil {
-		return nil, cannot("open", "directory", dirPath, err)
-	}
-
-	names, err := dh.Readdirnames(-1)
-	dh.Close()
-	if err != nil {
-		return nil, cannot("read", "directory", dirPath, err)
-	}
-
-	//B// startTime := time.Now()
-	for _, n := range names {
-		ret[monocase(n)] = n
-	}
-	//B// duration := time.Since(startTime)
-	//B// fmt.Printf("#B# monocasing %d names in dir %q took %s\n",
-	//B//	len(names), dirPath, duration)
-	return ret, nil
-}
-
-// I considered making this faster by only upcasing ASCII a-z, since non-ASCII
-// letters are not found (or at least very rare) in app install directory names.
-// But a little benchmarking showed that using strings.ToUpper() took < 1ms with
-// over 500 titles, which is plenty good enough.
-
-// monocase(s) returns the uppercased form of s.
-//
-func monocase(s string) string {
-	return strings.ToUpper(s)
-}
@@ -0,0 +1,668 @@
+// Functions for making and restoring the package’s own backups of Steam apps,
+// which need neither Steam’s backup wizard nor Steam itself.
+
+package steamfiles
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c12h/errs"
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// An archive backup is a gzipped tar archive of one app, named
+// <name>.steambackup.tar.gz, with an index beside it named
+// <name>.steambackup.json.  ScanBackupsDir recognises the index.
+//
+const (
+	ArchiveBackupSuffix = ".steambackup.tar.gz"
+	ArchiveIndexSuffix  = ".steambackup.json"
+)
+
+// archiveBackupFormat is the BackupIndex.Format this package writes.
+const archiveBackupFormat = 1
+
+// A BackupIndex describes an archive backup.  Pathnames in the archive are
+// slash-separated and relative to the app’s "steamapps" directory, except for
+// depot manifests, which are under "depotcache/" (as in the Steam home
+// directory):
+//
+//	appmanifest_<AppNum>.acf
+//	common/<installdir>/…          (or music/<installdir>/…)
+//	workshop/appworkshop_<AppNum>.acf  and  workshop/content/<AppNum>/…
+//	compatdata/<AppNum>/…
+//	depotcache/<DepotNum>_<ManifestID>.manifest
+//
+type BackupIndex struct {
+	Format     int           `json:"format"`
+	Created    time.Time     `json:"created"`
+	AppNumber  AppNum        `json:"appid"`
+	AppName    string        `json:"name"`
+	InstallDir string        `json:"installdir"` // The "installdir" from the manifest
+	Subdir     string        `json:"subdir"`     // "common" or "music"
+	DirName    string        `json:"dirname"`    // The install directory’s actual name
+	BuildID    int64         `json:"buildid"`
+	Depots     []BackupDepot `json:"depots"`     // Sorted by DepotNum
+	Workshop   bool          `json:"workshop"`   // Whether Workshop content is included
+	Compatdata bool          `json:"compatdata"` // Whether the Proton prefix is included
+	Size       int64         `json:"size"`       // The total size of Files
+	Files      []BackupFile  `json:"files"`      // Every regular file, in archive order
+}
+
+// A BackupDepot is one of the depots an archive backup’s app had installed.
+//
+type BackupDepot struct {
+	Depot        DepotNum   `json:"depot"`
+	Manifest     ManifestID `json:"manifest"`
+	Size         int64      `json:"size"`
+	DLCAppNum    AppNum     `json:"dlc_appid,omitempty"`
+	HaveManifest bool       `json:"have_manifest"` // Whether depotcache/… is in the archive
+}
+
+// A BackupFile is a regular file in an archive backup.
+//
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // Hex-encoded
+}
+
+// IsArchive reports whether a backup is an archive backup, rather than one of
+// Steam’s.
+//
+func (b *AppBackup) IsArchive() bool {
+	return b.IndexPath != ""
+}
+
+// ArchiveBackupOptions controls WriteArchiveBackup.  A nil
+// *ArchiveBackupOptions means use the defaults.
+//
+type ArchiveBackupOptions struct {
+	Workshop   bool                 // Include the app’s Workshop content, if any
+	Compatdata bool                 // Include the app’s Proton prefix, if any
+	Progress   ScanProgressReporter // Called as files are archived, if not nil
+}
+
+// WriteArchiveBackup writes an archive backup of one of an Installation’s apps
+// into backupsDir: its manifest, its install directory, the depot manifests of
+// its installed depots (if Steam still has them) and, if opts says so, its
+// Workshop content and Proton prefix.  The archive is named after the app and
+// the time, so that several backups of an app can sit side by side.
+//
+// WriteArchiveBackup refuses to back up an app that Steam is part-way through
+// updating.  The index is written last, so an interrupted backup is ignored by
+// ScanBackupsDir.  It reads the app’s files through the Installation’s Scanner,
+// but writes the archive to the real file system.
+//
+func WriteArchiveBackup(ctx context.Context, inst *Installation, appNum AppNum,
+	backupsDir string, opts *ArchiveBackupOptions,
+) (*AppBackup, error) {
+	if opts == nil {
+		opts = &ArchiveBackupOptions{}
+	}
+	s := inst.scanner
+	app, ok := inst.Apps[appNum]
+	if !ok {
+		return nil, cannotFind(fmt.Sprintf("installed app %d", appNum), nil)
+	}
+	what := fmt.Sprintf("app %d (%q)", appNum, app.AppName)
+	if app.UpdatePending() {
+		return nil, errs.Cannot("back up", "", what, false,
+			"— Steam has not finished updating it", nil)
+	}
+	steamLibDir := app.LibraryFolders[0]
+	appDir, err := s.findAppDir(steamLibDir, app.InstallDir)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &BackupIndex{
+		Format:     archiveBackupFormat,
+		Created:    time.Now().UTC().Truncate(time.Second),
+		AppNumber:  appNum,
+		AppName:    app.AppName,
+		InstallDir: app.InstallDir,
+		Subdir:     filepath.Base(filepath.Dir(appDir)),
+		DirName:    filepath.Base(appDir),
+		BuildID:    app.BuildID,
+	}
+	base := filepath.Join(backupsDir, archiveBackupName(app, idx.Created))
+	archivePath, indexPath := base+ArchiveBackupSuffix, base+ArchiveIndexSuffix
+	if _, err := os.Lstat(archivePath); err == nil {
+		return nil, errs.Cannot("back up", "", what, false,
+			fmt.Sprintf("— %q already exists", archivePath), nil)
+	}
+
+	tmp := archivePath + ".steamfiles-tmp"
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, cannot("create", "file", tmp, err)
+	}
+	aw := s.newArchiveWriter(newScanState(ctx, &ScanOptions{Progress: opts.Progress}), fh)
+	err = writeArchiveBackup(aw, inst, app, idx, appDir, opts)
+	if err == nil {
+		err = aw.close(what)
+	}
+	if err == nil {
+		if err = fh.Sync(); err != nil {
+			err = cannot("write", "file", tmp, err)
+		}
+	}
+	if closeErr := fh.Close(); err == nil && closeErr != nil {
+		err = cannot("write", "file", tmp, closeErr)
+	}
+	if err == nil {
+		if err = os.Rename(tmp, archivePath); err != nil {
+			err = cannot("rename", "file", tmp, err)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	idx.Files = aw.files
+	for _, f := range idx.Files {
+		idx.Size += f.Size
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return nil, cannot("encode", "index for", archivePath, err)
+	}
+	if err := writeFileAtomically(indexPath, data); err != nil {
+		return nil, err
+	}
+	return &AppBackup{
+		AppNumbers: []AppNum{appNum},
+		BackupName: app.AppName,
+		BackupPath: archivePath,
+		ModTime:    idx.Created,
+		IndexPath:  indexPath}, nil
+}
+
+// writeArchiveBackup adds an app’s files to an archive backup, filling in the
+// index’s Depots, Workshop and Compatdata fields.
+//
+func writeArchiveBackup(aw *archiveWriter, inst *Installation, app *InstalledApp,
+	idx *BackupIndex, appDir string, opts *ArchiveBackupOptions,
+) error {
+	s, appNum := aw.s, app.AppNumber
+	appText := strconv.Itoa(int(appNum))
+	steamLibDir := app.LibraryFolders[0]
+
+	if err := aw.addFile(manifestPath(steamLibDir, appNum),
+		"appmanifest_"+appText+".acf"); err != nil {
+		return err
+	}
+	if err := aw.addDir(appDir, idx.Subdir+"/"+idx.DirName); err != nil {
+		return err
+	}
+
+	if w := inst.Workshops[appNum]; opts.Workshop && w != nil {
+		if err := aw.addFile(w.Path, "workshop/appworkshop_"+appText+".acf"); err != nil {
+			return err
+		}
+		if _, err := s.fsys.Lstat(w.ContentDir()); err == nil {
+			if err := aw.addDir(w.ContentDir(), "workshop/content/"+appText); err != nil {
+				return err
+			}
+		}
+		idx.Workshop = true
+	}
+
+	if opts.Compatdata {
+		// The prefix is usually in the app’s own library, but need not be.
+		libs := []string{steamLibDir}
+		for _, lib := range inst.Libraries {
+			libs = append(libs, lib.Path)
+		}
+		for _, lib := range libs {
+			prefix := filepath.Join(lib, "compatdata", appText)
+			if info, err := s.fsys.Lstat(prefix); err == nil && info.IsDir() {
+				if err := aw.addDir(prefix, "compatdata/"+appText); err != nil {
+					return err
+				}
+				idx.Compatdata = true
+				break
+			}
+		}
+	}
+
+	depotcache := filepath.Join(inst.Home, "depotcache")
+	for depot, d := range app.InstalledDepots {
+		bd := BackupDepot{Depot: depot, Manifest: d.Manifest, Size: d.Size,
+			DLCAppNum: d.DLCAppNum}
+		mp := DepotManifestPath(depotcache, depot, d.Manifest)
+		if _, err := s.fsys.Lstat(mp); err == nil {
+			if err := aw.addFile(mp, "depotcache/"+filepath.Base(mp)); err != nil {
+				return err
+			}
+			bd.HaveManifest = true
+		}
+		idx.Depots = append(idx.Depots, bd)
+	}
+	sort.Slice(idx.Depots, func(i, j int) bool {
+		return idx.Depots[i].Depot < idx.Depots[j].Depot
+	})
+	return nil
+}
+
+// addDir adds a directory and everything under it to an archive as name.  If
+// dir is a symlink (fx, an install directory moved to another disk), it adds
+// the directory the symlink leads to, since ExtractArchive will not extract
+// anything under a symlink.
+//
+func (aw *archiveWriter) addDir(dir, name string) error {
+	if resolved, err := aw.s.evalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if err := aw.addFile(dir, name); err != nil {
+		return err
+	}
+	return aw.addTree(dir, name)
+}
+
+// archiveBackupName returns the name (without suffix) for an archive backup of
+// an app made at time t: the app’s name, made safe for a file name, its
+// AppNum and the time, fx "Portal 2 (620) 20240102T030405Z".
+//
+func archiveBackupName(app *InstalledApp, t time.Time) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, app.AppName)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "app"
+	}
+	return fmt.Sprintf("%s (%d) %s", name, app.AppNumber,
+		t.UTC().Format("20060102T150405Z"))
+}
+
+// ReadBackupIndex reads the index of an archive backup (AppBackup.IndexPath).
+//
+func ReadBackupIndex(indexPath string) (*BackupIndex, error) {
+	return std.ReadBackupIndex(indexPath)
+}
+
+// ReadBackupIndex is the Scanner method behind the ReadBackupIndex function.
+//
+func (s *Scanner) ReadBackupIndex(indexPath string) (*BackupIndex, error) {
+	data, err := s.readFile(indexPath)
+	if err != nil {
+		return nil, cannot("read", "backup index", indexPath, err)
+	}
+	idx := &BackupIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fileError(indexPath, "", "is not a valid backup index: %s", err)
+	}
+	if err := checkBackupIndex(indexPath, idx.Format, idx.AppNumber); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func checkBackupIndex(indexPath string, format int, appNum AppNum) error {
+	if format != archiveBackupFormat {
+		return fileError(indexPath, "format", "has unknown format %d", format)
+	}
+	if appNum <= 0 {
+		return fileError(indexPath, "appid", "has appid %d!?", appNum)
+	}
+	return nil
+}
+
+// readArchiveBackup reads the index of an archive backup for ScanBackupsDir,
+// skipping the list of files, and returning nil (and no error) if the archive
+// itself does not exist.  It also returns the size of the index, for progress
+// reports.
+//
+func (s *Scanner) readArchiveBackup(indexPath string) (*AppBackup, int64, error) {
+	data, err := s.readFile(indexPath)
+	if err != nil {
+		return nil, 0, cannot("read", "backup index", indexPath, err)
+	}
+	var idx struct {
+		Format    int       `json:"format"`
+		Created   time.Time `json:"created"`
+		AppNumber AppNum    `json:"appid"`
+		AppName   string    `json:"name"`
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, 0, fileError(indexPath, "", "is not a valid backup index: %s", err)
+	}
+	if err := checkBackupIndex(indexPath, idx.Format, idx.AppNumber); err != nil {
+		return nil, 0, err
+	}
+	archivePath := strings.TrimSuffix(indexPath, ArchiveIndexSuffix) + ArchiveBackupSuffix
+	if _, err := s.fsys.Lstat(archivePath); os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, cannot("find archive for", "backup index", indexPath, err)
+	}
+	return &AppBackup{
+		AppNumbers: []AppNum{idx.AppNumber},
+		BackupName: idx.AppName,
+		BackupPath: archivePath,
+		ModTime:    idx.Created,
+		IndexPath:  indexPath}, int64(len(data)), nil
+}
+
+/*------------------------------- Restoring ---------------------------------*/
+
+// RestoredStateFlags are the StateFlags that RestoreArchiveBackup gives a
+// restored app’s manifest: they make Steam check the app’s files against its
+// depots (and fetch anything newer) before the app next runs.
+//
+const RestoredStateFlags = AppStateFullyInstalled | AppStateUpdateRequired
+
+// RestoreOptions controls RestoreArchiveBackup.  A nil *RestoreOptions means
+// use the defaults.
+//
+type RestoreOptions struct {
+	// Progress (if not nil) is called as the restored files are checked.
+	Progress ScanProgressReporter
+}
+
+// A RestoredApp describes what RestoreArchiveBackup did.
+//
+type RestoredApp struct {
+	App     *InstalledApp // The app, as its new manifest describes it
+	AppDir  string        // Where its files went
+	Renamed bool          // Whether AppDir’s name differs from the backup’s, to avoid a clash
+	Skipped []string      // Things from the backup left out because they already exist
+}
+
+// RestoreArchiveBackup restores an archive backup into one of an
+// Installation’s Steam library directories.  It extracts the archive into a
+// temporary directory there (steamapps/steamfiles-restore_<AppNum>), checks
+// every file against the index’s checksums, then moves the app’s install
+// directory into place, followed by its Workshop content, Proton prefix and
+// depot manifests where the library (or Steam home) lacks them.  Only then
+// does it write the app’s manifest, with RestoredStateFlags, and add the app to
+// libraryfolders.vdf.
+//
+// If the library already has a directory with the app’s install directory’s
+// name (even ignoring case), the app goes in "<name> (restored)" instead, and
+// its manifest’s "installdir" says so.  RestoreArchiveBackup refuses to run
+// while Steam is running, or if the app is installed already.  The
+// Installation is not updated, so callers should load it again afterwards.
+//
+// Like MoveApp, RestoreArchiveBackup always uses the real file system.  If it
+// fails part-way, it moves back into the temporary directory whatever it had
+// moved out, and removes the depot manifests and app manifest it had written,
+// so that the library is as it was.  It leaves the temporary directory in
+// place; the next attempt replaces it.
+//
+func RestoreArchiveBackup(ctx context.Context, inst *Installation,
+	backup *AppBackup, steamLibDir string, opts *RestoreOptions,
+) (*RestoredApp, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+	if !backup.IsArchive() {
+		return nil, errs.Cannot("restore", "backup", backup.BackupPath, true,
+			"— only Steam can restore its own backups", nil)
+	}
+	if SteamRunning(inst.Home) {
+		return nil, errs.Cannot("restore", "backup", backup.BackupPath, true, "",
+			ErrSteamRunning)
+	}
+	s := NewScanner(OSFileSystem)
+	idx, err := s.ReadBackupIndex(backup.IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	appNum, appText := idx.AppNumber, strconv.Itoa(int(idx.AppNumber))
+	what := fmt.Sprintf("app %d (%q)", appNum, idx.AppName)
+	lib := inst.Library(steamLibDir)
+	if lib == nil {
+		return nil, cannotFind(fmt.Sprintf("Steam library directory %q", steamLibDir), nil)
+	}
+	if app, ok := inst.Apps[appNum]; ok {
+		return nil, errs.Cannot("restore", "", what, false,
+			"— it is already installed in "+app.LibraryFolders[0], nil)
+	}
+	if _, err := os.Lstat(manifestPath(lib.Path, appNum)); err == nil {
+		return nil, errs.Cannot("restore", "", what, false,
+			fmt.Sprintf("— %q already exists", manifestPath(lib.Path, appNum)), nil)
+	}
+
+	// Extract and check everything before changing the library.
+	tmpDir := filepath.Join(lib.Path, "steamfiles-restore_"+appText)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, cannot("remove", "directory", tmpDir, err)
+	}
+	fh, err := os.Open(backup.BackupPath)
+	if err != nil {
+		return nil, cannot("open", "archive", backup.BackupPath, err)
+	}
+	err = ExtractArchive(ctx, fh, tmpDir)
+	fh.Close()
+	if err != nil {
+		return nil, err
+	}
+	scan := newScanState(ctx, &ScanOptions{Progress: opts.Progress})
+	if err := checkRestoredFiles(scan, tmpDir, idx); err != nil {
+		return nil, err
+	}
+
+	ret := &RestoredApp{}
+	dirName, err := freeInstallDir(filepath.Join(lib.Path, idx.Subdir), idx.DirName)
+	if err != nil {
+		return nil, err
+	}
+	ret.AppDir = filepath.Join(lib.Path, idx.Subdir, dirName)
+	ret.Renamed = dirName != idx.DirName
+
+	// From here on, a failure undoes what has been done, so that a retry
+	// does not find the install directory taken by a copy with no manifest.
+	var undo restoreUndo
+	finished := false
+	defer func() {
+		if !finished {
+			undo.undo()
+		}
+	}()
+	if _, err := undo.moveIfAbsent(filepath.Join(tmpDir, idx.Subdir, idx.DirName),
+		ret.AppDir); err != nil {
+		return nil, err
+	}
+	for _, rel := range []string{
+		filepath.Join("workshop", "appworkshop_"+appText+".acf"),
+		filepath.Join("workshop", "content", appText),
+		filepath.Join("compatdata", appText),
+	} {
+		moved, err := undo.moveIfAbsent(filepath.Join(tmpDir, rel),
+			filepath.Join(lib.Path, rel))
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			ret.Skipped = append(ret.Skipped, filepath.Join(lib.Path, rel))
+		}
+	}
+	// The depot manifests go in the Steam home directory, which may be on
+	// another file system, so they are copied.
+	depotcache := filepath.Join(inst.Home, "depotcache")
+	for _, d := range idx.Depots {
+		if !d.HaveManifest {
+			continue
+		}
+		dest := DepotManifestPath(depotcache, d.Depot, d.Manifest)
+		src := filepath.Join(tmpDir, "depotcache", filepath.Base(dest))
+		if _, err := os.Lstat(dest); err == nil {
+			continue
+		}
+		info, err := os.Lstat(src)
+		if err != nil {
+			return nil, cannot("examine", "", src, err)
+		}
+		if err := os.MkdirAll(depotcache, 0755); err != nil {
+			return nil, cannot("create", "directory", depotcache, err)
+		}
+		undo.written = append(undo.written, dest)
+		if err := copyFile(src, dest, info); err != nil {
+			return nil, err
+		}
+	}
+
+	undo.written = append(undo.written, manifestPath(lib.Path, appNum))
+	ret.App, err = writeRestoredManifest(tmpDir, lib.Path, idx, dirName)
+	if err != nil {
+		return nil, err
+	}
+	// This changes both libraryfolders.vdf files or neither, so undo need
+	// not put them back.
+	if err := updateLibraryFoldersApps(s, inst.Home, "", lib.Path, appNum,
+		ret.App.SizeOnDisk); err != nil {
+		return nil, err
+	}
+	finished = true
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, cannot("remove", "directory", tmpDir, err)
+	}
+	return ret, nil
+}
+
+// A restoreUndo records what RestoreArchiveBackup has done to a library, so
+// that it can be undone if a later step fails.
+//
+type restoreUndo struct {
+	moved   [][2]string // Each thing moved, as {from, to}
+	written []string    // Files written (or being written) that did not exist
+}
+
+// undo moves everything back, newest first, and removes the files written,
+// as far as it can.
+//
+func (u *restoreUndo) undo() {
+	for _, p := range u.written {
+		os.Remove(p)
+	}
+	for i := len(u.moved) - 1; i >= 0; i-- {
+		os.Rename(u.moved[i][1], u.moved[i][0])
+	}
+}
+
+// checkRestoredFiles checks the files extracted from an archive backup against
+// the sizes and SHA-256 checksums in its index.
+//
+func checkRestoredFiles(scan *scanState, tmpDir string, idx *BackupIndex) error {
+	for _, f := range idx.Files {
+		if err := scan.ctx.Err(); err != nil {
+			return err
+		}
+		p := filepath.Join(tmpDir, filepath.FromSlash(f.Path))
+		fh, err := os.Open(p)
+		if err != nil {
+			return cannot("open", "restored file", p, err)
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, fh)
+		fh.Close()
+		if err != nil {
+			return cannot("read", "restored file", p, err)
+		}
+		if n != f.Size || hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+			return fileError(p, "", "does not match the backup’s index")
+		}
+		scan.visited(1, n)
+	}
+	return nil
+}
+
+// freeInstallDir returns a name for an app’s install directory in dir that
+// nothing there has, even ignoring case: want itself if possible, or else
+// "<want> (restored)", "<want> (restored 2)" and so on.
+//
+func freeInstallDir(dir, want string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", cannot("read", "directory", dir, err)
+	}
+	taken := make(map[string]bool)
+	for _, e := range entries {
+		taken[strings.ToLower(e.Name())] = true
+	}
+	name := want
+	for n := 1; taken[strings.ToLower(name)]; n++ {
+		name = want + " (restored)"
+		if n > 1 {
+			name = fmt.Sprintf("%s (restored %d)", want, n)
+		}
+	}
+	return name, nil
+}
+
+// moveIfAbsent renames src to dest if src exists and dest does not, recording
+// the move.  It reports false if it skipped src because dest exists.
+//
+func (u *restoreUndo) moveIfAbsent(src, dest string) (bool, error) {
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		return true, nil // Nothing to move, so nothing skipped
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, cannot("create", "directory", filepath.Dir(dest), err)
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return false, cannot("rename", "", src, err)
+	}
+	u.moved = append(u.moved, [2]string{src, dest})
+	return true, nil
+}
+
+// writeRestoredManifest writes the manifest for a restored app into a library,
+// with RestoredStateFlags and the install directory’s name, and returns the
+// InstalledApp it describes.
+//
+func writeRestoredManifest(tmpDir, steamLibDir string, idx *BackupIndex,
+	dirName string,
+) (*InstalledApp, error) {
+	appText := strconv.Itoa(int(idx.AppNumber))
+	src := filepath.Join(tmpDir, "appmanifest_"+appText+".acf")
+	info, err := sVDF.FromFile(src, "AppState")
+	if err != nil {
+		return nil, err
+	}
+	top, ok := info.TopValue.(sVDF.NamesValuesList)
+	if !ok {
+		return nil, fileError(src, "AppState", "is not a list")
+	}
+	top["StateFlags"] = strconv.FormatUint(uint64(RestoredStateFlags), 10)
+	top["FullValidateAfterNextUpdate"] = "1"
+	if !strings.EqualFold(dirName, idx.InstallDir) {
+		top["installdir"] = dirName
+	}
+	app, err := manifestFromVDF(info)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := sVDF.Write(&buf, info.TopName, top); err != nil {
+		return nil, cannot("write", "", src, err)
+	}
+	dest := manifestPath(steamLibDir, idx.AppNumber)
+	if err := writeFileAtomically(dest, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	app.LibraryFolders = []string{steamLibDir}
+	return app, nil
+}
@@ -0,0 +1,333 @@
+package steamfiles_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c12h/steam-stuff/sVDF"
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+// archiveFixture installs a home library with app 10 (with files, a depot and
+// a Proton prefix) and a backups directory holding a Steam backup of app 20,
+// then writes an archive backup of app 10 there, returning the temporary root,
+// the library and the archive backup.
+//
+func archiveFixture(t *testing.T) (root, lib string, b *steamfiles.AppBackup) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime).
+		AddFile("data/a.pak", "aaaa", steamtest.DefaultTime).
+		AddDepot(11, 777, 7)
+	h.AddFile("/home/me/.steam/steam/steamapps/compatdata/10/pfx/user.reg", "saves",
+		steamtest.DefaultTime)
+	h.AddFile("/home/me/.steam/steam/depotcache/11_777.manifest", "manifest",
+		steamtest.DefaultTime)
+	h.AddBackupsDir("/backups").AddBackup("Twenty", 20)
+	root = h.Install(t)
+	lib = filepath.Join(root, "home/me/.steam/steam/steamapps")
+
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+	b, err := steamfiles.WriteArchiveBackup(context.Background(), inst, 10,
+		filepath.Join(root, "backups"),
+		&steamfiles.ArchiveBackupOptions{Compatdata: true})
+	if err != nil {
+		t.Fatalf("WriteArchiveBackup: %s", err)
+	}
+	return root, lib, b
+}
+
+// uninstall removes app 10 and everything that restoring it would bring back.
+//
+func uninstall(t *testing.T, root, lib string) {
+	for _, p := range []string{
+		filepath.Join(lib, "appmanifest_10.acf"),
+		filepath.Join(lib, "common", "Ten"),
+		filepath.Join(lib, "compatdata", "10"),
+		filepath.Join(root, "home/me/.steam/steam/depotcache/11_777.manifest"),
+	} {
+		if err := os.RemoveAll(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteArchiveBackup(t *testing.T) {
+	root, _, b := archiveFixture(t)
+	if !b.IsArchive() || !exists(b.BackupPath) || !exists(b.IndexPath) {
+		t.Fatalf("backup %+v is not a complete archive backup", b)
+	}
+	backups := make(steamfiles.AppBackupForAppNum)
+	if err := steamfiles.ScanBackupsDir(filepath.Join(root, "backups"), backups, nil); err != nil {
+		t.Fatalf("ScanBackupsDir: %s", err)
+	}
+	if got := backups[10]; got == nil || got.BackupPath != b.BackupPath {
+		t.Fatalf("ScanBackupsDir found %+v, want %q", got, b.BackupPath)
+	}
+
+	idx, err := steamfiles.ReadBackupIndex(b.IndexPath)
+	if err != nil {
+		t.Fatalf("ReadBackupIndex: %s", err)
+	}
+	if idx.AppNumber != 10 || idx.Subdir != "common" || idx.DirName != "Ten" ||
+		!idx.Compatdata || len(idx.Depots) != 1 || !idx.Depots[0].HaveManifest {
+		t.Errorf("the index is %+v", idx)
+	}
+
+	fh, err := os.Open(b.BackupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	dest := filepath.Join(t.TempDir(), "extracted")
+	if err := steamfiles.ExtractArchive(context.Background(), fh, dest); err != nil {
+		t.Fatalf("ExtractArchive: %s", err)
+	}
+	for rel, want := range map[string]string{
+		"common/Ten/game":            "#!game",
+		"common/Ten/data/a.pak":      "aaaa",
+		"compatdata/10/pfx/user.reg": "saves",
+		"depotcache/11_777.manifest": "manifest",
+	} {
+		if got := readFile(t, filepath.Join(dest, rel)); got != want {
+			t.Errorf("archived %s holds %q, want %q", rel, got, want)
+		}
+	}
+	if !exists(filepath.Join(dest, "appmanifest_10.acf")) {
+		t.Errorf("the archive has no app manifest")
+	}
+	if len(idx.Files) != 5 {
+		t.Errorf("the index lists %d files, want 5", len(idx.Files))
+	}
+}
+
+func TestRestoreArchiveBackup(t *testing.T) {
+	root, lib, _ := archiveFixture(t)
+	uninstall(t, root, lib)
+	inst := load(t, &steamfiles.LoadOptions{BackupsDirs: []string{filepath.Join(root, "backups")}})
+	restored, err := steamfiles.RestoreArchiveBackup(context.Background(), inst,
+		inst.Backups[10], lib, nil)
+	if err != nil {
+		t.Fatalf("RestoreArchiveBackup: %s", err)
+	}
+	if restored.Renamed || len(restored.Skipped) != 0 {
+		t.Errorf("restore renamed %v, skipped %q; want neither", restored.Renamed,
+			restored.Skipped)
+	}
+	for rel, want := range map[string]string{
+		"common/Ten/game":               "#!game",
+		"common/Ten/data/a.pak":         "aaaa",
+		"compatdata/10/pfx/user.reg":    "saves",
+		"../depotcache/11_777.manifest": "manifest",
+	} {
+		if got := readFile(t, filepath.Join(lib, rel)); got != want {
+			t.Errorf("restored %s holds %q, want %q", rel, got, want)
+		}
+	}
+	if exists(filepath.Join(lib, "steamfiles-restore_10")) {
+		t.Errorf("the temporary directory was left behind")
+	}
+	manifest, err := sVDF.FromFile(filepath.Join(lib, "appmanifest_10.acf"), "AppState")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags, _ := manifest.Lookup("StateFlags"); flags != "6" {
+		t.Errorf("restored StateFlags = %q, want %q", flags, "6")
+	}
+
+	// The app is installed again, so a second restore must refuse.
+	inst = load(t, &steamfiles.LoadOptions{BackupsDirs: []string{filepath.Join(root, "backups")}})
+	if inst.Apps[10] == nil {
+		t.Fatalf("the restored app is not installed")
+	}
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst,
+		inst.Backups[10], lib, nil); err == nil {
+		t.Errorf("restoring an installed app did not fail")
+	}
+}
+
+func TestRestoreArchiveBackupKeepsLibraryFoldersInStep(t *testing.T) {
+	root, lib, b := archiveFixture(t)
+	uninstall(t, root, lib)
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+	steamHome := filepath.Join(root, "home/me/.steam/steam")
+	lfPaths := []string{filepath.Join(steamHome, "steamapps/libraryfolders.vdf"),
+		filepath.Join(steamHome, "config/libraryfolders.vdf")}
+	// Uninstalling the app via Steam would take it off the apps list.
+	lf, err := sVDF.FromFile(lfPaths[0], "libraryfolders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := lf.TopValue.(sVDF.NamesValuesList)
+	delete(top["0"].(sVDF.NamesValuesList)["apps"].(sVDF.NamesValuesList), "10")
+	if err := os.Mkdir(filepath.Dir(lfPaths[1]), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range lfPaths {
+		if err := sVDF.WriteFile(p, lf.TopName, top); err != nil {
+			t.Fatal(err)
+		}
+	}
+	original := readFile(t, lfPaths[0])
+
+	// Make writing config/libraryfolders.vdf fail, after the other one could
+	// have been written.
+	blocker := lfPaths[1] + ".steamfiles-tmp"
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b, lib,
+		nil); err == nil {
+		t.Fatalf("RestoreArchiveBackup did not fail when it could not update libraryfolders.vdf")
+	}
+	for _, p := range lfPaths {
+		if readFile(t, p) != original {
+			t.Errorf("the failed restore changed %s", p)
+		}
+	}
+	for _, rel := range []string{"common/Ten", "appmanifest_10.acf"} {
+		if exists(filepath.Join(lib, rel)) {
+			t.Errorf("the failed restore left %s behind", rel)
+		}
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b, lib,
+		nil); err != nil {
+		t.Fatalf("retried RestoreArchiveBackup: %s", err)
+	}
+	for _, p := range lfPaths {
+		lf, err := sVDF.FromFile(p, "libraryfolders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lf.HaveString("0", "apps", "10") {
+			t.Errorf("%s does not list the restored app", p)
+		}
+	}
+}
+
+func TestRestoreArchiveBackupRefusesWhileSteamRuns(t *testing.T) {
+	root, lib, b := archiveFixture(t)
+	uninstall(t, root, lib)
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+	steamfiles.FakeSteamRunning(t, true)
+	_, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b, lib, nil)
+	if !errors.Is(err, steamfiles.ErrSteamRunning) {
+		t.Fatalf("RestoreArchiveBackup while Steam runs gave %v, want ErrSteamRunning",
+			err)
+	}
+	for _, rel := range []string{"common/Ten", "appmanifest_10.acf",
+		"steamfiles-restore_10"} {
+		if exists(filepath.Join(lib, rel)) {
+			t.Errorf("the refused restore made %s", rel)
+		}
+	}
+
+	steamfiles.FakeSteamRunning(t, false)
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b, lib,
+		nil); err != nil {
+		t.Fatalf("RestoreArchiveBackup once Steam has gone: %s", err)
+	}
+}
+
+func TestArchiveBackupOfSymlinkedInstallDir(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddBackupsDir("/backups").AddBackup("Twenty", 20)
+	root := h.Install(t)
+	lib := filepath.Join(root, "home/me/.steam/steam/steamapps")
+	appDir := filepath.Join(lib, "common", "Ten")
+	elsewhere := filepath.Join(root, "ssd", "Ten")
+	if err := os.Mkdir(filepath.Dir(elsewhere), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(appDir, elsewhere); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, elsewhere, appDir)
+
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+	if _, err := steamfiles.WriteArchiveBackup(context.Background(), inst, 10,
+		filepath.Join(root, "backups"), nil); err != nil {
+		t.Fatalf("WriteArchiveBackup: %s", err)
+	}
+	for _, p := range []string{appDir, filepath.Join(lib, "appmanifest_10.acf")} {
+		if err := os.Remove(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inst = load(t, &steamfiles.LoadOptions{BackupsDirs: []string{filepath.Join(root, "backups")}})
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst,
+		inst.Backups[10], lib, nil); err != nil {
+		t.Fatalf("RestoreArchiveBackup: %s", err)
+	}
+	if info, err := os.Lstat(appDir); err != nil || !info.IsDir() {
+		t.Errorf("the restored install directory is not a directory: %v", err)
+	}
+	if got := readFile(t, filepath.Join(appDir, "game")); got != "#!game" {
+		t.Errorf("restored game holds %q, want %q", got, "#!game")
+	}
+	if got := readFile(t, filepath.Join(elsewhere, "game")); got != "#!game" {
+		t.Errorf("the symlink’s target was changed")
+	}
+}
+
+func TestRestoreArchiveBackupUndoesFailure(t *testing.T) {
+	root, lib, b := archiveFixture(t)
+	uninstall(t, root, lib)
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+
+	// Spoil libraryfolders.vdf, so that the last step fails.
+	lfPath := filepath.Join(lib, "libraryfolders.vdf")
+	good := readFile(t, lfPath)
+	if err := os.WriteFile(lfPath, []byte("garbage {"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b, lib,
+		nil); err == nil {
+		t.Fatalf("RestoreArchiveBackup with a bad libraryfolders.vdf did not fail")
+	}
+	for _, rel := range []string{"common/Ten", "appmanifest_10.acf", "compatdata/10",
+		"../depotcache/11_777.manifest"} {
+		if exists(filepath.Join(lib, rel)) {
+			t.Errorf("the failed restore left %s behind", rel)
+		}
+	}
+
+	// A retry must use the same install directory, not "Ten (restored)".
+	if err := os.WriteFile(lfPath, []byte(good), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := steamfiles.RestoreArchiveBackup(context.Background(), inst, b,
+		lib, nil)
+	if err != nil {
+		t.Fatalf("retried RestoreArchiveBackup: %s", err)
+	}
+	if restored.Renamed || restored.AppDir != filepath.Join(lib, "common", "Ten") {
+		t.Errorf("the retry restored to %q (renamed %v)", restored.AppDir,
+			restored.Renamed)
+	}
+}
+
+func TestScanBackupsDirSkipsStrayIndex(t *testing.T) {
+	root, _, b := archiveFixture(t)
+	if err := os.Remove(b.BackupPath); err != nil {
+		t.Fatal(err)
+	}
+	backups := make(steamfiles.AppBackupForAppNum)
+	if err := steamfiles.ScanBackupsDir(filepath.Join(root, "backups"), backups, nil); err != nil {
+		t.Fatalf("ScanBackupsDir with an index but no archive: %s", err)
+	}
+	if len(backups) != 1 || backups[10] != nil {
+		t.Errorf("ScanBackupsDir found %v, want only the backup of app 20", backups)
+	}
+}
@@ -0,0 +1,262 @@
+// Functions for gzipped tar archives of directory trees, for keeping copies of
+// the things that Steam’s own backups leave out.
+
+package steamfiles
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WriteTreeArchive writes a gzipped tar archive of the directory tree at root
+// to w.  Pathnames in the archive are slash-separated and relative to root.
+// Regular files, directories and symlinks are archived, with their permissions
+// and modification times; anything else (such as a socket) is skipped.
+// Progress reports (via opts) count the files archived.
+//
+func WriteTreeArchive(ctx context.Context, w io.Writer, root string,
+	opts *ScanOptions,
+) error {
+	return std.WriteTreeArchive(ctx, w, root, opts)
+}
+
+// WriteTreeArchive is the Scanner method behind the WriteTreeArchive function.
+//
+func (s *Scanner) WriteTreeArchive(ctx context.Context, w io.Writer, root string,
+	opts *ScanOptions,
+) error {
+	aw := s.newArchiveWriter(newScanState(ctx, opts), w)
+	if err := aw.addTree(root, ""); err != nil {
+		return err
+	}
+	return aw.close(root)
+}
+
+// An archiveWriter writes a gzipped tar archive, noting the size and SHA-256
+// checksum of each regular file it adds.
+//
+type archiveWriter struct {
+	s     *Scanner
+	scan  *scanState
+	gzw   *gzip.Writer
+	tw    *tar.Writer
+	files []BackupFile
+}
+
+func (s *Scanner) newArchiveWriter(scan *scanState, w io.Writer) *archiveWriter {
+	gzw := gzip.NewWriter(w)
+	return &archiveWriter{s: s, scan: scan, gzw: gzw, tw: tar.NewWriter(gzw)}
+}
+
+// addTree adds the directory tree at root to the archive, under the
+// slash-separated pathname prefix (or at the top, if prefix is "").
+//
+func (aw *archiveWriter) addTree(root, prefix string) error {
+	return aw.s.walkTree(root, func(p string, d fs.DirEntry) error {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return cannot("archive", "", p, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return cannot("examine", "", p, err)
+		}
+		return aw.addEntry(p, info, path.Join(prefix, filepath.ToSlash(rel)))
+	})
+}
+
+// addFile adds a single file to the archive as name.
+//
+func (aw *archiveWriter) addFile(p, name string) error {
+	info, err := aw.s.fsys.Lstat(p)
+	if err != nil {
+		return cannot("examine", "", p, err)
+	}
+	return aw.addEntry(p, info, name)
+}
+
+// addEntry adds a file, directory or symlink to the archive as name, skipping
+// anything else (such as a socket).
+//
+func (aw *archiveWriter) addEntry(p string, info fs.FileInfo, name string) error {
+	if err := aw.scan.ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	link := ""
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		if link, err = aw.s.readlink(p); err != nil {
+			return cannot("read", "symlink", p, err)
+		}
+	case !info.IsDir() && !isRegFile(info):
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return cannot("archive", "", p, err)
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uname, hdr.Gname = "", ""
+	if err := aw.tw.WriteHeader(hdr); err != nil {
+		return cannot("archive", "", p, err)
+	}
+	if isRegFile(info) {
+		h := sha256.New()
+		if err := aw.s.copyFileTo(io.MultiWriter(aw.tw, h), p); err != nil {
+			return err
+		}
+		aw.files = append(aw.files, BackupFile{
+			Path: name, Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))})
+		aw.scan.visited(1, info.Size())
+	}
+	return nil
+}
+
+// close finishes the archive (of what, for error messages).
+//
+func (aw *archiveWriter) close(what string) error {
+	if err := aw.tw.Close(); err != nil {
+		return cannot("finish", "archive of", what, err)
+	}
+	if err := aw.gzw.Close(); err != nil {
+		return cannot("finish", "archive of", what, err)
+	}
+	return nil
+}
+
+// copyFileTo copies the contents of a file to w.
+//
+func (s *Scanner) copyFileTo(w io.Writer, p string) error {
+	fh, err := s.fsys.Open(p)
+	if err != nil {
+		return cannot("open", "file", p, err)
+	}
+	defer fh.Close()
+	if _, err := io.Copy(w, fh); err != nil {
+		return cannot("archive", "file", p, err)
+	}
+	return nil
+}
+
+// ExtractArchive unpacks a gzipped tar archive that WriteTreeArchive wrote into
+// destDir, which must not exist yet.  It refuses entries that would end up
+// outside destDir, whether by their names or through symlinks earlier in the
+// archive, and skips entries that are not files, directories or symlinks.
+//
+// Unlike the rest of this package, ExtractArchive always uses the real file
+// system.  If it fails, it leaves whatever it has extracted in place.
+//
+func ExtractArchive(ctx context.Context, r io.Reader, destDir string) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return cannot("read", "archive for", destDir, err)
+	}
+	defer gzr.Close()
+	if err := os.Mkdir(destDir, 0755); err != nil {
+		return cannot("create", "directory", destDir, err)
+	}
+
+	tr := tar.NewReader(gzr)
+	symlinks := make(map[string]bool)
+	var dirs []*tar.Header
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return cannot("read", "archive for", destDir, err)
+		}
+		name := path.Clean(hdr.Name)
+		if name == "." {
+			continue
+		}
+		if err := checkArchiveName(name, symlinks); err != nil {
+			return cannot("extract", "archive into", destDir, err)
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(name))
+		mode := fs.FileMode(hdr.Mode) & fs.ModePerm
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return cannot("create", "directory", target, err)
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return cannot("create", "directory", filepath.Dir(target), err)
+			}
+			fh, err := os.OpenFile(target,
+				os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode|0200)
+			if err != nil {
+				return cannot("create", "file", target, err)
+			}
+			_, err = io.Copy(fh, tr)
+			if closeErr := fh.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return cannot("write", "file", target, err)
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return cannot("set permissions of", "file", target, err)
+			}
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return cannot("set times of", "file", target, err)
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return cannot("create", "directory", filepath.Dir(target), err)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return cannot("create", "symlink", target, err)
+			}
+			symlinks[name] = true
+		}
+	}
+
+	// Set directory times last, since creating files in them changes them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		hdr := dirs[i]
+		target := filepath.Join(destDir, filepath.FromSlash(path.Clean(hdr.Name)))
+		if err := os.Chmod(target, fs.FileMode(hdr.Mode)&fs.ModePerm); err != nil {
+			return cannot("set permissions of", "directory", target, err)
+		}
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return cannot("set times of", "directory", target, err)
+		}
+	}
+	return nil
+}
+
+// checkArchiveName makes sure that an entry’s (cleaned) name stays inside the
+// extraction directory and does not go through a symlink extracted earlier.
+//
+func checkArchiveName(name string, symlinks map[string]bool) error {
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("archive entry %q is outside the archive", name)
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return fmt.Errorf("archive entry %q is under symlink %q", name, dir)
+		}
+	}
+	return nil
+}
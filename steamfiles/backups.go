@@ -1,16 +1,20 @@
 package steamfiles
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/c12h/steam-stuff/sVDF"
 )
 
 // An AppBackup holds the relevant information about a Steam backup, taken from
-// its sku.sis file.
+// its sku.sis file, or about an archive backup (see WriteArchiveBackup), taken
+// from its index.
 //
 // A Steam backup contains one or more apps (in my case, usually one). It
 // consists of a directory ...???
@@ -18,8 +22,9 @@ import (
 type AppBackup struct {
 	AppNumbers []AppNum  // Which apps are saved in this backup
 	BackupName string    // The "name" field from the backup's sku.sis file
-	BackupPath string    // The pathname of the backup directory
-	ModTime    time.Time // When the sku.sis file was last modified
+	BackupPath string    // The pathname of the backup directory (or archive)
+	ModTime    time.Time // When the sku.sis file was last modified (or the archive made)
+	IndexPath  string    // For an archive backup, its index; otherwise ""
 }
 
 // ScanBackupsDir adds AppBackup values to a map indexed by AppNum.
@@ -47,8 +52,12 @@ type AppBackupForAppNum map[AppNum]*AppBackup
 type DupeBackupHandler func(appNum AppNum, prev, curr *AppBackup) bool
 
 // ScanBackupsDir scans a directory for backups: that is, it looks for any
-// immediate subdirectory D with a valid D/sku.sis or D/Disk_1/sku.sis file.
-// It records any valid-seeming backups it finds in its map parameter.
+// immediate subdirectory D with a valid D/sku.sis or D/Disk_1/sku.sis file,
+// and for archive backups (files named <name>.steambackup.json, with
+// <name>.steambackup.tar.gz beside them).  It records any valid-seeming
+// backups it finds in its map parameter.  An index without its archive (fx,
+// left by an interrupted tidy-up) is skipped, like a subdirectory without a
+// sku.sis file.
 //
 // If it finds a backup containing an app which the map already has an AppBackup
 // for, ScanBackupsDir calls handleDupe to let the caller perhaps log the
@@ -61,105 +70,193 @@ func ScanBackupsDir(
 	theMap map[AppNum]*AppBackup,
 	handleDupe DupeBackupHandler,
 ) error {
-	if handleDupe == nil {
-		handleDupe = ignoreOlderDupe
+	return std.ScanBackupsDir(backupsDirPath, theMap, handleDupe)
+}
+
+// ScanBackupsDir is the Scanner method behind the ScanBackupsDir function.
+//
+func (s *Scanner) ScanBackupsDir(
+	backupsDirPath string,
+	theMap map[AppNum]*AppBackup,
+	handleDupe DupeBackupHandler,
+) error {
+	return s.ScanBackupsDirContext(context.Background(),
+		backupsDirPath, theMap, handleDupe, nil)
+}
+
+// ScanBackupsDirContext is like ScanBackupsDir, but examines the backups
+// concurrently (as opts allows), reports progress and stops early if ctx is
+// done, in which case it returns ctx.Err() and leaves theMap unchanged.
+//
+// The results do not depend on the order in which backups get examined:
+// ScanBackupsDirContext updates theMap and calls handleDupe in the same order
+// ScanBackupsDir does, and if several backups are bad, it reports the one whose
+// name sorts first.
+//
+func ScanBackupsDirContext(ctx context.Context,
+	backupsDirPath string,
+	theMap map[AppNum]*AppBackup,
+	handleDupe DupeBackupHandler,
+	opts *ScanOptions,
+) error {
+	return std.ScanBackupsDirContext(ctx, backupsDirPath, theMap, handleDupe, opts)
+}
+
+// ScanBackupsDirContext is the Scanner method behind the ScanBackupsDirContext
+// function.
+//
+func (s *Scanner) ScanBackupsDirContext(ctx context.Context,
+	backupsDirPath string,
+	theMap map[AppNum]*AppBackup,
+	handleDupe DupeBackupHandler,
+	opts *ScanOptions,
+) error {
+	backups, err := s.readBackups(ctx, backupsDirPath, opts)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return cannot("find any Steam backups in", "directory",
+			backupsDirPath, nil)
 	}
-	dh, err := os.Open(backupsDirPath)
+	mergeBackups(theMap, backups, handleDupe)
+	return nil
+}
+
+// readBackups reads the sku.sis files of all the backups in a directory
+// (concurrently, as opts allows), and returns the results sorted by directory
+// name.  If several backups are bad, it reports the one whose name sorts first.
+//
+func (s *Scanner) readBackups(ctx context.Context,
+	backupsDirPath string, opts *ScanOptions,
+) ([]*AppBackup, error) {
+	allNames, err := s.readDirNames(backupsDirPath)
 	if err != nil {
-		return cannot("open", "", backupsDirPath, err)
+		return nil, err
 	}
+	sort.Strings(allNames)
 
-	allNames, err := dh.Readdirnames(-1)
-	dh.Close()
+	backups := make([]*AppBackup, len(allNames))
+	errors := make([]error, len(allNames))
+	scan := newScanState(ctx, opts)
+	err = scan.forEach(len(allNames), func(i int) {
+		var skuSize int64
+		backups[i], skuSize, errors[i] =
+			s.readBackup(filepath.Join(backupsDirPath, allNames[i]))
+		if backups[i] != nil {
+			scan.visited(1, skuSize)
+		}
+	})
 	if err != nil {
-		return cannot("read", "directory", backupsDirPath, err)
+		return nil, err
 	}
 
-	nFound := 0
-	for _, n := range allNames {
-		path := filepath.Join(backupsDirPath, n)
-		nodeInfo, err := os.Lstat(path)
-		if err != nil {
-			return cannot("examine", "", path, err)
+	ret := make([]*AppBackup, 0, len(backups))
+	for i, b := range backups {
+		if errors[i] != nil {
+			return nil, errors[i]
 		}
-		if !nodeInfo.IsDir() {
-			continue
+		if b != nil {
+			ret = append(ret, b)
 		}
-		skuPath := filepath.Join(path, "sku.sis")
-		nodeInfo, err = os.Lstat(skuPath)
-		if err != nil && os.IsNotExist(err) {
-			skuPath = filepath.Join(path, "Disk_1", "sku.sis")
-			nodeInfo, err = os.Lstat(skuPath)
-			if err != nil {
-				if os.IsNotExist(err) {
-					continue
+	}
+	return ret, nil
+}
+
+// mergeBackups adds backups to a map, resolving duplicates as ScanBackupsDir
+// describes.
+//
+func mergeBackups(theMap map[AppNum]*AppBackup,
+	backups []*AppBackup, handleDupe DupeBackupHandler,
+) {
+	if handleDupe == nil {
+		handleDupe = ignoreOlderDupe
+	}
+	for _, newBackup := range backups {
+		for _, appNum := range newBackup.AppNumbers {
+			if prevBackup, havePrev := theMap[appNum]; havePrev {
+				if !handleDupe(appNum, prevBackup, newBackup) {
+					continue // Leave prevBackup in place
 				}
 			}
+			theMap[appNum] = newBackup
 		}
-		if err != nil {
-			return cannot("find sku.sis file for", "backup", path,
-				os.ErrNotExist)
-		}
+	}
+}
 
-		skuInfo, err := sVDF.FromFile(skuPath, "sku", "SKU")
-		if err != nil {
-			return err
+// readBackup reads the sku.sis file for a backup (or the index of an archive
+// backup), returning nil (and no error) if path is not a backup directory or
+// index.  It also returns the size of the sku.sis file, for progress reports.
+//
+func (s *Scanner) readBackup(path string) (*AppBackup, int64, error) {
+	nodeInfo, err := s.fsys.Lstat(path)
+	if err != nil {
+		return nil, 0, cannot("examine", "", path, err)
+	}
+	if !nodeInfo.IsDir() {
+		if isRegFile(nodeInfo) && strings.HasSuffix(path, ArchiveIndexSuffix) {
+			return s.readArchiveBackup(path)
 		}
-
-		backupName, err := skuInfo.Lookup("name")
+		return nil, 0, nil
+	}
+	skuPath := filepath.Join(path, "sku.sis")
+	nodeInfo, err = s.fsys.Lstat(skuPath)
+	if err != nil && os.IsNotExist(err) {
+		skuPath = filepath.Join(path, "Disk_1", "sku.sis")
+		nodeInfo, err = s.fsys.Lstat(skuPath)
 		if err != nil {
-			return cannot("get app name from", "", skuPath, err)
+			if os.IsNotExist(err) {
+				return nil, 0, nil
+			}
 		}
+	}
+	if err != nil {
+		return nil, 0, cannot("find sku.sis file for", "backup", path,
+			os.ErrNotExist)
+	}
+
+	skuInfo, err := sVDF.FromFS(s.fsys, skuPath, "sku", "SKU")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	backupName, err := skuInfo.Lookup("name")
+	if err != nil {
+		return nil, 0, cannot("get app name from", "", skuPath, err)
+	}
 
-		appNumbersList := make([]AppNum, 0, 1)
-		appListKey := "apps"
+	appNumbersList := make([]AppNum, 0, 1)
+	appListKey := "apps"
+	if !skuInfo.HaveString(appListKey, "0") {
+		appListKey = "Apps"
 		if !skuInfo.HaveString(appListKey, "0") {
-			appListKey = "Apps"
-			if !skuInfo.HaveString(appListKey, "0") {
-				return cannot(`find apps (or Apps) in`, "", skuPath, nil)
-			}
+			return nil, 0, cannot(`find apps (or Apps) in`, "", skuPath, nil)
 		}
-		for i := 0; ; i += 1 {
-			indexKey := strconv.Itoa(i)
-			if !skuInfo.HaveString(appListKey, indexKey) {
-				break
-			}
-			appNumText, err := skuInfo.Lookup(appListKey, indexKey)
-			if err != nil {
-				panic(err.Error())
-			}
-			appNum, err := parseAppNum(appNumText, skuPath)
-			if err != nil {
-				return err
-			}
-			appNumbersList = append(appNumbersList, appNum)
+	}
+	for i := 0; ; i += 1 {
+		indexKey := strconv.Itoa(i)
+		if !skuInfo.HaveString(appListKey, indexKey) {
+			break
 		}
-		if len(appNumbersList) == 0 {
-			return cannot("get any app numbers from", "", skuPath, nil)
+		appNumText, err := skuInfo.Lookup(appListKey, indexKey)
+		if err != nil {
+			panic(err.Error())
 		}
-
-		nFound += 1
-		newBackup := &AppBackup{
-			AppNumbers: appNumbersList,
-			BackupName: backupName,
-			BackupPath: path,
-			ModTime:    skuInfo.ModTime}
-
-		for _, appNum := range appNumbersList {
-			if prevBackup, havePrev := theMap[appNum]; havePrev {
-				if !handleDupe(appNum, prevBackup, newBackup) {
-					continue // Leave prevBackup in place
-				}
-			}
-			theMap[appNum] = newBackup
+		appNum, err := parseAppNum(appNumText, skuPath)
+		if err != nil {
+			return nil, 0, err
 		}
+		appNumbersList = append(appNumbersList, appNum)
 	}
-
-	if nFound == 0 {
-		return cannot("find any Steam backups in", "directory",
-			backupsDirPath, nil)
+	if len(appNumbersList) == 0 {
+		return nil, 0, cannot("get any app numbers from", "", skuPath, nil)
 	}
-	return nil
+
+	return &AppBackup{
+		AppNumbers: appNumbersList,
+		BackupName: backupName,
+		BackupPath: path,
+		ModTime:    skuInfo.ModTime}, nodeInfo.Size(), nil
 }
 
 // ignoreOlderDupe is a do-nothing default DupeBackupHandler.
@@ -0,0 +1,71 @@
+package steamfiles_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+// preferSingleApp is the DupeBackupHandler that check-backups uses, less its
+// reports: a backup of just one app beats one of several, and otherwise the
+// newer backup wins.
+//
+func preferSingleApp(appNum steamfiles.AppNum, prev, curr *steamfiles.AppBackup) bool {
+	if len(prev.AppNumbers) > 1 && len(curr.AppNumbers) == 1 {
+		return true
+	} else if len(prev.AppNumbers) == 1 && len(curr.AppNumbers) > 1 {
+		return false
+	}
+	return !prev.ModTime.After(curr.ModTime)
+}
+
+func TestLoadInstallationWithTwoBackupsDirs(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.InitialLibrary().AddApp(20, "Twenty", "Twenty").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	older, newer := steamtest.DefaultTime, steamtest.DefaultTime.Add(24*time.Hour)
+	h.AddBackupsDir("/disk1/backups").AddBackup("Ten", 10).SetTime(older)
+	h.AddBackupsDir("/disk2/backups").AddBackup("Both", 10, 20).SetTime(newer)
+	s := h.Scanner(t)
+	dirs := []string{"/disk1/backups", "/disk2/backups", "/disk1/backups/"}
+
+	for _, tc := range []struct {
+		name    string
+		handler steamfiles.DupeBackupHandler
+		want10  string
+		wantDir string
+	}{
+		{"default", nil, "Both", "/disk2/backups"},
+		{"prefer single-app", preferSingleApp, "Ten", "/disk1/backups"},
+	} {
+		inst, err := s.LoadInstallation(context.Background(),
+			&steamfiles.LoadOptions{BackupsDirs: dirs, HandleDupe: tc.handler})
+		if err != nil {
+			t.Fatalf("%s: LoadInstallation: %s", tc.name, err)
+		}
+		if len(inst.BackupsDirs) != 2 || len(inst.AllBackups) != 2 {
+			t.Errorf("%s: got backups dirs %q and %d backups, want 2 of each",
+				tc.name, inst.BackupsDirs, len(inst.AllBackups))
+		}
+		b := inst.Backups[10]
+		if b == nil || b.BackupName != tc.want10 {
+			t.Errorf("%s: app 10’s backup is %+v, want %q", tc.name, b, tc.want10)
+			continue
+		}
+		if dir := inst.BackupsDirOf(b); dir != tc.wantDir {
+			t.Errorf("%s: BackupsDirOf(%q) = %q, want %q", tc.name, b.BackupPath,
+				dir, tc.wantDir)
+		}
+		if b := inst.Backups[20]; b == nil || b.BackupName != "Both" {
+			t.Errorf("%s: app 20’s backup is %+v, want %q", tc.name, b, "Both")
+		}
+		if n := len(inst.BackupsOf(10)); n != 2 {
+			t.Errorf("%s: app 10 has %d backups, want 2", tc.name, n)
+		}
+	}
+}
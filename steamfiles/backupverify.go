@@ -0,0 +1,391 @@
+// Functions etc for checking that a Steam backup is complete and consistent.
+
+package steamfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// A BackupDefectKind says what is wrong with part of a backup.  The values are
+// short, stable strings, suitable for scripts to match on.
+//
+type BackupDefectKind string
+
+const (
+	DefectMissingDisk         BackupDefectKind = "missing-disk"         // No Disk_<N> directory
+	DefectUnexpectedDisk      BackupDefectKind = "unexpected-disk"      // Disk_<N> with N > "disks"
+	DefectMissingSKU          BackupDefectKind = "missing-sku"          // Disk_<N> has no sku.sis
+	DefectBadSKU              BackupDefectKind = "bad-sku"              // A sku.sis cannot be used
+	DefectSKUMismatch         BackupDefectKind = "sku-mismatch"         // Disks’ sku.sis files differ
+	DefectWrongDiskNumber     BackupDefectKind = "wrong-disk-number"    // sku.sis "disk" ≠ N
+	DefectMissingDepot        BackupDefectKind = "missing-depot"        // Depot has no chunk stores
+	DefectUnlistedDepot       BackupDefectKind = "unlisted-depot"       // Chunk store for unknown depot
+	DefectMissingChunkStore   BackupDefectKind = "missing-chunkstore"   // Listed chunk store not found
+	DefectDuplicateChunkStore BackupDefectKind = "duplicate-chunkstore" // Same chunk store twice
+	DefectMissingCSD          BackupDefectKind = "missing-csd"          // .csm without its .csd
+	DefectMissingCSM          BackupDefectKind = "missing-csm"          // .csd without its .csm
+	DefectBadCSM              BackupDefectKind = "bad-csm"              // .csm cannot be used
+	DefectCSDSize             BackupDefectKind = "csd-size"             // .csd size ≠ what .csm says
+)
+
+// A BackupDefect describes one thing wrong with a backup.
+//
+type BackupDefect struct {
+	Kind       BackupDefectKind `json:"kind"`
+	Path       string           `json:"path"`                 // The file or directory concerned
+	Disk       int              `json:"disk,omitempty"`       // Which Disk_<N>, if relevant
+	Depot      DepotNum         `json:"depot,omitempty"`      // Which depot, if relevant
+	ChunkStore int              `json:"chunkstore,omitempty"` // Which chunk store, if relevant
+	Detail     string           `json:"detail"`               // A human-readable explanation
+}
+
+// A BackupVerification is what VerifyBackup reports about a backup.
+//
+// A backup in the ‘single directory’ layout (with sku.sis in the backup
+// directory itself) is treated as having one disk.
+//
+type BackupVerification struct {
+	BackupPath string         `json:"backup_path"`
+	Disks      int            `json:"disks"`  // How many disks the backup should have
+	Depots     []DepotNum     `json:"depots"` // The depots that sku.sis lists
+	Defects    []BackupDefect `json:"defects"`
+}
+
+// OK reports whether VerifyBackup found no defects.
+//
+func (v *BackupVerification) OK() bool {
+	return len(v.Defects) == 0
+}
+
+func (v *BackupVerification) addDefect(kind BackupDefectKind, path string,
+	disk int, cs chunkStoreName, format string, args ...interface{},
+) {
+	v.Defects = append(v.Defects, BackupDefect{
+		Kind:       kind,
+		Path:       path,
+		Disk:       disk,
+		Depot:      cs.depot,
+		ChunkStore: cs.index,
+		Detail:     fmt.Sprintf(format, args...)})
+}
+
+var reDiskDir = regexp.MustCompile(`^Disk_(\d+)$`)
+
+// VerifyBackup checks a Steam backup directory (as found by ScanBackupsDir) for
+// missing or damaged parts.  It checks that
+//	- every disk that sku.sis says the backup has is present,
+//	- every disk has a sku.sis file, and they all agree with each other,
+//	- every depot listed in sku.sis has at least one chunk store,
+//	- every chunk store has both its .csd and .csm file, and
+//	- every .csd file is the size that its .csm file says it should be.
+//
+// VerifyBackup returns an error only if backupPath does not seem to be a backup
+// at all; problems with the backup’s contents are listed in the result.
+//
+func VerifyBackup(backupPath string) (*BackupVerification, error) {
+	return std.VerifyBackup(backupPath)
+}
+
+// VerifyBackup is the Scanner method behind the VerifyBackup function.
+//
+func (s *Scanner) VerifyBackup(backupPath string) (*BackupVerification, error) {
+	ret := &BackupVerification{BackupPath: backupPath}
+
+	// Find the disks, and the sku.sis files in them.
+	diskDirs := map[int]string{}
+	if _, err := s.fsys.Lstat(filepath.Join(backupPath, "sku.sis")); err == nil {
+		diskDirs[1] = backupPath
+		ret.Disks = 1
+	} else if !os.IsNotExist(err) {
+		return nil, cannot("examine", "backup", backupPath, err)
+	} else {
+		names, err := s.readDirNames(backupPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			if match := reDiskDir.FindStringSubmatch(n); match != nil {
+				diskNum, _ := strconv.Atoi(match[1])
+				diskDirs[diskNum] = filepath.Join(backupPath, n)
+			}
+		}
+		if _, haveDisk1 := diskDirs[1]; !haveDisk1 {
+			return nil, cannot("find sku.sis file for", "backup",
+				backupPath, os.ErrNotExist)
+		}
+	}
+
+	skus := map[int]*sVDF.File{}
+	for diskNum, dir := range diskDirs {
+		skuPath := filepath.Join(dir, "sku.sis")
+		if _, err := s.fsys.Lstat(skuPath); err != nil {
+			ret.addDefect(DefectMissingSKU, skuPath, diskNum,
+				chunkStoreName{}, "disk %d has no sku.sis", diskNum)
+			continue
+		}
+		skuInfo, err := sVDF.FromFS(s.fsys, skuPath, "sku", "SKU")
+		if err != nil {
+			ret.addDefect(DefectBadSKU, skuPath, diskNum,
+				chunkStoreName{}, "%s", err)
+			continue
+		}
+		skus[diskNum] = skuInfo
+	}
+	firstSKU, haveFirstSKU := skus[1]
+	if !haveFirstSKU {
+		ret.sortDefects()
+		return ret, nil
+	}
+
+	// Check the disks against what Disk_1/sku.sis says.
+	if ret.Disks == 0 {
+		ret.Disks = len(diskDirs)
+		if text, err := firstSKU.Lookup("disks"); err == nil {
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 1 {
+				ret.addDefect(DefectBadSKU, firstSKU.Path, 1,
+					chunkStoreName{}, "bad disk count %q", text)
+			} else {
+				ret.Disks = n
+			}
+		}
+	}
+	for diskNum := 1; diskNum <= ret.Disks; diskNum++ {
+		if _, haveDisk := diskDirs[diskNum]; !haveDisk {
+			ret.addDefect(DefectMissingDisk,
+				filepath.Join(backupPath, fmt.Sprintf("Disk_%d", diskNum)),
+				diskNum, chunkStoreName{},
+				"disk %d of %d is missing", diskNum, ret.Disks)
+		}
+	}
+	for diskNum, dir := range diskDirs {
+		if diskNum > ret.Disks {
+			ret.addDefect(DefectUnexpectedDisk, dir, diskNum,
+				chunkStoreName{},
+				"backup should only have %d disk(s)", ret.Disks)
+		}
+	}
+	for diskNum, skuInfo := range skus {
+		if text, err := skuInfo.Lookup("disk"); err == nil {
+			if text != strconv.Itoa(diskNum) && len(diskDirs) > 1 {
+				ret.addDefect(DefectWrongDiskNumber, skuInfo.Path,
+					diskNum, chunkStoreName{},
+					"says it is disk %q", text)
+			}
+		}
+		if diskNum == 1 {
+			continue
+		}
+		if diff := diffValues(firstSKU.TopValue, skuInfo.TopValue,
+			"", skuDiskSpecificNames); diff != "" {
+			ret.addDefect(DefectSKUMismatch, skuInfo.Path, diskNum,
+				chunkStoreName{}, "differs from disk 1: %s", diff)
+		}
+	}
+
+	// Find out which depots (and which chunk stores) sku.sis lists.
+	listedStores := map[DepotNum][]int{}
+	if nvl, err := firstSKU.LookupNVL("depots"); err == nil {
+		for _, key := range nvl.Names() {
+			text, isString := (*nvl)[key].(string)
+			if !isString {
+				continue
+			}
+			depot, err := parseDepotNum(text, firstSKU.Path)
+			if err != nil {
+				ret.addDefect(DefectBadSKU, firstSKU.Path, 1,
+					chunkStoreName{}, "%s", err)
+				continue
+			}
+			ret.Depots = append(ret.Depots, depot)
+			listedStores[depot] = nil
+		}
+	}
+	if nvl, err := firstSKU.LookupNVL("chunkstores"); err == nil {
+		for _, depotText := range nvl.Names() {
+			depot, err := parseDepotNum(depotText, firstSKU.Path)
+			if err != nil {
+				continue
+			}
+			stores, isNVL := (*nvl)[depotText].(sVDF.NamesValuesList)
+			if !isNVL {
+				continue
+			}
+			for _, indexText := range stores.Names() {
+				if index, err := strconv.Atoi(indexText); err == nil {
+					listedStores[depot] =
+						append(listedStores[depot], index)
+				}
+			}
+		}
+	}
+	sort.Slice(ret.Depots, func(i, j int) bool { return ret.Depots[i] < ret.Depots[j] })
+
+	// Find the chunk stores that are actually present.
+	type storeFiles struct {
+		disk     int
+		csd, csm string
+	}
+	foundStores := map[chunkStoreName]*storeFiles{}
+	for diskNum, dir := range diskDirs {
+		names, err := s.readDirNames(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			cs, ext, ok := parseChunkStoreFileName(n)
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, n)
+			sf, haveStore := foundStores[cs]
+			if !haveStore {
+				sf = &storeFiles{disk: diskNum}
+				foundStores[cs] = sf
+			} else if sf.disk != diskNum {
+				ret.addDefect(DefectDuplicateChunkStore, path, diskNum, cs,
+					"%s is also on disk %d", cs, sf.disk)
+				continue
+			}
+			if ext == "csd" {
+				sf.csd = path
+			} else {
+				sf.csm = path
+			}
+		}
+	}
+
+	// Check the chunk stores against the list and against each other.
+	for depot, indexes := range listedStores {
+		if len(indexes) == 0 {
+			for cs := range foundStores {
+				if cs.depot == depot {
+					indexes = append(indexes, cs.index)
+				}
+			}
+			if len(indexes) == 0 {
+				ret.addDefect(DefectMissingDepot, backupPath, 0,
+					chunkStoreName{depot, 0},
+					"no chunk stores for depot %d", depot)
+			}
+		}
+		for _, index := range indexes {
+			cs := chunkStoreName{depot, index}
+			if _, haveStore := foundStores[cs]; !haveStore {
+				ret.addDefect(DefectMissingChunkStore, backupPath, 0, cs,
+					"no %s.csd or %s.csm file", cs, cs)
+			}
+		}
+	}
+	for cs, sf := range foundStores {
+		if _, isListed := listedStores[cs.depot]; !isListed && len(listedStores) > 0 {
+			ret.addDefect(DefectUnlistedDepot, diskDirs[sf.disk], sf.disk, cs,
+				"sku.sis does not list depot %d", cs.depot)
+		}
+		switch {
+		case sf.csd == "":
+			ret.addDefect(DefectMissingCSD, sf.csm, sf.disk, cs,
+				"%s.csm has no matching .csd file", cs)
+		case sf.csm == "":
+			ret.addDefect(DefectMissingCSM, sf.csd, sf.disk, cs,
+				"%s.csd has no matching .csm file", cs)
+		default:
+			ret.checkChunkStore(s, cs, sf.disk, sf.csd, sf.csm)
+		}
+	}
+
+	ret.sortDefects()
+	return ret, nil
+}
+
+// checkChunkStore compares a .csd file with its .csm index.
+//
+func (v *BackupVerification) checkChunkStore(s *Scanner,
+	cs chunkStoreName, disk int, csdPath, csmPath string,
+) {
+	store, err := s.OpenChunkStore(csmPath)
+	if err != nil {
+		v.addDefect(DefectBadCSM, csmPath, disk, cs, "%s", err)
+		return
+	}
+	if store.DataSize < 0 {
+		v.addDefect(DefectMissingCSD, csdPath, disk, cs,
+			"%s.csd has disappeared", cs)
+		return
+	}
+	if need := store.DataSizeNeeded(); store.DataSize != need {
+		v.addDefect(DefectCSDSize, csdPath, disk, cs,
+			"file has %d bytes, but %d chunks in index need %d",
+			store.DataSize, store.NumChunks(), need)
+	}
+}
+
+// sortDefects puts the defects into a predictable order.
+//
+func (v *BackupVerification) sortDefects() {
+	sort.SliceStable(v.Defects, func(i, j int) bool {
+		a, b := &v.Defects[i], &v.Defects[j]
+		if a.Disk != b.Disk {
+			return a.Disk < b.Disk
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Kind < b.Kind
+	})
+}
+
+// The "disk" entry in a sku.sis file is expected to differ between disks.
+//
+var skuDiskSpecificNames = map[string]bool{"disk": true}
+
+// diffValues compares two values from VDF files, returning "" if they are the
+// same or else a description of the first difference it finds.  Top-level names
+// in the ignore map are skipped.
+//
+func diffValues(a, b sVDF.Value, where string, ignore map[string]bool) string {
+	aNVL, aIsNVL := a.(sVDF.NamesValuesList)
+	bNVL, bIsNVL := b.(sVDF.NamesValuesList)
+	if !aIsNVL || !bIsNVL {
+		if aIsNVL != bIsNVL || a != b {
+			return fmt.Sprintf("%s is %#v, not %#v", where, b, a)
+		}
+		return ""
+	}
+
+	names := map[string]bool{}
+	for n := range aNVL {
+		names[n] = true
+	}
+	for n := range bNVL {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		if !ignore[n] {
+			sorted = append(sorted, n)
+		}
+	}
+	sort.Strings(sorted)
+	for _, n := range sorted {
+		path := fmt.Sprintf("%s→%q", where, n)
+		aVal, inA := aNVL[n]
+		bVal, inB := bNVL[n]
+		if !inA {
+			return fmt.Sprintf("%s is extra", path)
+		} else if !inB {
+			return fmt.Sprintf("%s is missing", path)
+		}
+		if diff := diffValues(aVal, bVal, path, nil); diff != "" {
+			return diff
+		}
+	}
+	return ""
+}
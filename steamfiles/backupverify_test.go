@@ -0,0 +1,90 @@
+package steamfiles_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+// verifyFixture returns a two-disk backup of app 10 with two depots, as a
+// MapFS holding /backups/Ten.
+//
+func verifyFixture(t *testing.T) fstest.MapFS {
+	t.Helper()
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.AddBackupsDir("/backups").AddBackup("Ten", 10).UseDisks(2).
+		AddDepot(101, 1234, 5).
+		AddDepot(102, 5678, 2)
+	return h.MapFS(t)
+}
+
+// verify runs VerifyBackup on /backups/Ten in fsys.
+//
+func verify(t *testing.T, fsys fstest.MapFS) *steamfiles.BackupVerification {
+	t.Helper()
+	v, err := steamfiles.NewScanner(steamfiles.FromFS(fsys)).VerifyBackup("/backups/Ten")
+	if err != nil {
+		t.Fatalf("VerifyBackup: %s", err)
+	}
+	return v
+}
+
+func TestVerifyBackupGood(t *testing.T) {
+	v := verify(t, verifyFixture(t))
+	if !v.OK() {
+		t.Errorf("VerifyBackup found defects in a good backup: %+v", v.Defects)
+	}
+	if v.Disks != 2 || len(v.Depots) != 2 || v.Depots[0] != 101 || v.Depots[1] != 102 {
+		t.Errorf("VerifyBackup found %d disks and depots %v, want 2 and [101 102]",
+			v.Disks, v.Depots)
+	}
+}
+
+func TestVerifyBackupDamaged(t *testing.T) {
+	const disk2 = "backups/Ten/Disk_2"
+	for _, tc := range []struct {
+		name   string
+		damage func(fstest.MapFS)
+		want   steamfiles.BackupDefectKind
+	}{
+		{"truncated .csd", func(fsys fstest.MapFS) {
+			f := fsys[disk2+"/101_depotcache_2.csd"]
+			f.Data = f.Data[:len(f.Data)-1]
+		}, steamfiles.DefectCSDSize},
+		{"missing .csd", func(fsys fstest.MapFS) {
+			delete(fsys, disk2+"/102_depotcache_2.csd")
+		}, steamfiles.DefectMissingCSD},
+		{"missing .csm", func(fsys fstest.MapFS) {
+			delete(fsys, disk2+"/102_depotcache_2.csm")
+		}, steamfiles.DefectMissingCSM},
+		{"truncated .csm", func(fsys fstest.MapFS) {
+			f := fsys[disk2+"/101_depotcache_2.csm"]
+			f.Data = f.Data[:len(f.Data)-3]
+		}, steamfiles.DefectBadCSM},
+		{"missing disk", func(fsys fstest.MapFS) {
+			for name := range fsys {
+				if strings.HasPrefix(name, disk2) {
+					delete(fsys, name)
+				}
+			}
+		}, steamfiles.DefectMissingDisk},
+		{"missing sku.sis", func(fsys fstest.MapFS) {
+			delete(fsys, disk2+"/sku.sis")
+		}, steamfiles.DefectMissingSKU},
+	} {
+		fsys := verifyFixture(t)
+		tc.damage(fsys)
+		v := verify(t, fsys)
+		found := false
+		for _, d := range v.Defects {
+			found = found || d.Kind == tc.want
+		}
+		if !found {
+			t.Errorf("%s: VerifyBackup found %+v, want a %s defect", tc.name,
+				v.Defects, tc.want)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Functions etc for examining the <depot>_depotcache_<n>.csm and .csd files
+// (‘chunk stores’) in Steam backups.
+
+package steamfiles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Each chunk store in a backup is a pair of files:
+//	<DepotNum>_depotcache_<N>.csd	holds the (compressed) chunks of data
+//	<DepotNum>_depotcache_<N>.csm	is an index to the .csd file
+// where N counts up from 1.  Valve does not document the format of these files;
+// as far as I can tell, a .csm file is a 16-byte header
+//	"SCFS"			magic number
+//	uint32			version (?)
+//	uint32			the depot’s DepotNum
+//	uint32			how many chunk records follow
+// followed by fixed-size chunk records
+//	[20]byte		SHA-1 hash of the chunk’s original data
+//	uint64			offset of the chunk in the .csd file
+//	uint32			size of the chunk’s original data
+//	uint32			size of the chunk as stored in the .csd file
+// with all integers little-endian.
+//
+var reChunkStoreFile = regexp.MustCompile(`^(\d+)_depotcache_(\d+)\.(csd|csm)$`)
+
+const (
+	csmMagic      = "SCFS"
+	csmHeaderSize = 16
+	csmRecordSize = 36
+)
+
+/*-------------------------------- ChunkStore --------------------------------*/
+
+// A ChunkRecord describes one chunk of a depot’s data, as listed in a .csm
+// file.
+//
+type ChunkRecord struct {
+	SHA1         [20]byte // The SHA-1 hash of the chunk’s original data
+	Offset       int64    // Where the chunk starts in the .csd file
+	OriginalSize int64    // How big the chunk’s data is once unpacked
+	StoredSize   int64    // How many bytes of the .csd file the chunk takes
+}
+
+// End returns the offset just past the chunk’s data in the .csd file, or
+// math.MaxInt64 if a corrupt record puts the chunk beyond any possible file.
+//
+func (c ChunkRecord) End() int64 {
+	if !c.inRange(math.MaxInt64) {
+		return math.MaxInt64
+	}
+	return c.Offset + c.StoredSize
+}
+
+// inRange reports whether a chunk lies wholly within the first size bytes of
+// a file.  It avoids computing Offset + StoredSize, which can overflow when a
+// .csm file is corrupt.
+//
+func (c ChunkRecord) inRange(size int64) bool {
+	return c.Offset >= 0 && c.StoredSize >= 0 && c.StoredSize <= size &&
+		c.Offset <= size-c.StoredSize
+}
+
+// A ChunkStore holds the index from a .csm file, plus details of the matching
+// .csd file.  It does not keep either file open.
+//
+type ChunkStore struct {
+	Depot     DepotNum // The depot whose data is in the chunk store
+	Number    int      // The N in <DepotNum>_depotcache_<N>.csm
+	Version   uint32   // The (apparent) version number from the .csm file
+	IndexPath string   // The pathname of the .csm file
+	DataPath  string   // The pathname of the .csd file
+	DataSize  int64    // The size of the .csd file, or -1 if it is missing
+	records   []byte   // The chunk records, straight from the .csm file
+}
+
+// OpenChunkStore reads a .csm file and checks that it is self-consistent.  It
+// also looks for the matching .csd file, but does not complain if that is
+// missing.
+//
+// The .csm file’s name must be of the form <DepotNum>_depotcache_<N>.csm, and
+// its header must agree with the DepotNum in its name.
+//
+func OpenChunkStore(csmPath string) (*ChunkStore, error) {
+	return std.OpenChunkStore(csmPath)
+}
+
+// OpenChunkStore is the Scanner method behind the OpenChunkStore function.
+//
+func (s *Scanner) OpenChunkStore(csmPath string) (*ChunkStore, error) {
+	name, ext, ok := parseChunkStoreFileName(filepath.Base(csmPath))
+	if !ok || ext != "csm" {
+		return nil, fileError(csmPath, filepath.Base(csmPath),
+			"name not like <depot>_depotcache_<N>.csm")
+	}
+	data, err := s.readFile(csmPath)
+	if err != nil {
+		return nil, cannot("read", "chunk store index", csmPath, err)
+	}
+	if len(data) < csmHeaderSize || string(data[:4]) != csmMagic {
+		return nil, fileError(csmPath, "", "no %q header", csmMagic)
+	}
+
+	le := binary.LittleEndian
+	ret := &ChunkStore{
+		Depot:     DepotNum(le.Uint32(data[8:])),
+		Number:    name.index,
+		Version:   le.Uint32(data[4:]),
+		IndexPath: csmPath,
+		DataPath:  strings.TrimSuffix(csmPath, ".csm") + ".csd",
+		DataSize:  -1}
+	if ret.Depot != name.depot {
+		return nil, fileError(csmPath, "",
+			"index is for depot %d, not %d", ret.Depot, name.depot)
+	}
+	nChunks := int(le.Uint32(data[12:]))
+	if want := csmHeaderSize + nChunks*csmRecordSize; len(data) != want {
+		return nil, fileError(csmPath, "",
+			"size %d does not match %d chunk records (want %d)",
+			len(data), nChunks, want)
+	}
+	ret.records = data[csmHeaderSize:]
+
+	if info, err := s.fsys.Lstat(ret.DataPath); err == nil {
+		ret.DataSize = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, cannot("examine", "chunk store", ret.DataPath, err)
+	}
+	return ret, nil
+}
+
+// NumChunks returns the number of chunks in a chunk store.
+//
+func (cs *ChunkStore) NumChunks() int {
+	return len(cs.records) / csmRecordSize
+}
+
+// Chunk returns the i’th chunk record from a chunk store’s index.  It panics if
+// i is out of range.
+//
+func (cs *ChunkStore) Chunk(i int) ChunkRecord {
+	rec := cs.records[i*csmRecordSize : (i+1)*csmRecordSize]
+	le := binary.LittleEndian
+	ret := ChunkRecord{
+		Offset:       int64(le.Uint64(rec[20:])),
+		OriginalSize: int64(le.Uint32(rec[28:])),
+		StoredSize:   int64(le.Uint32(rec[32:]))}
+	copy(ret.SHA1[:], rec[:20])
+	return ret
+}
+
+// ForEachChunk calls fn for each chunk record, in the order they appear in the
+// .csm file, stopping early (and returning fn’s error) if fn returns an error.
+//
+func (cs *ChunkStore) ForEachChunk(fn func(i int, c ChunkRecord) error) error {
+	for i := 0; i < cs.NumChunks(); i++ {
+		if err := fn(i, cs.Chunk(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoredSize returns the total size of the chunks as stored in the .csd file,
+// and OriginalSize returns their total size once unpacked.
+//
+func (cs *ChunkStore) StoredSize() int64 {
+	var total int64
+	for i := 0; i < cs.NumChunks(); i++ {
+		total += cs.Chunk(i).StoredSize
+	}
+	return total
+}
+func (cs *ChunkStore) OriginalSize() int64 {
+	var total int64
+	for i := 0; i < cs.NumChunks(); i++ {
+		total += cs.Chunk(i).OriginalSize
+	}
+	return total
+}
+
+// DataSizeNeeded returns how big the .csd file must be to hold every chunk
+// listed in the index, or math.MaxInt64 if no file could hold them all.
+//
+func (cs *ChunkStore) DataSizeNeeded() int64 {
+	var end int64
+	for i := 0; i < cs.NumChunks(); i++ {
+		if e := cs.Chunk(i).End(); e > end {
+			end = e
+		}
+	}
+	return end
+}
+
+// CheckRange reports (as a FileError) whether a chunk lies outside the .csd
+// file, or returns nil if it lies wholly inside it.
+//
+func (cs *ChunkStore) CheckRange(c ChunkRecord) error {
+	if cs.DataSize < 0 {
+		return cannot("find", "chunk store", cs.DataPath, os.ErrNotExist)
+	}
+	if !c.inRange(cs.DataSize) {
+		return fileError(cs.DataPath, "",
+			"chunk at offset %d (%d bytes) is outside the %d-byte file",
+			c.Offset, c.StoredSize, cs.DataSize)
+	}
+	return nil
+}
+
+// ChunkReader returns a reader for the stored (still packed) bytes of a chunk
+// within an open .csd file, after checking that the chunk lies within the
+// file.
+//
+func (cs *ChunkStore) ChunkReader(csd io.ReaderAt, c ChunkRecord) (*io.SectionReader, error) {
+	if err := cs.CheckRange(c); err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(csd, c.Offset, c.StoredSize), nil
+}
+
+/*------------------------- Chunk stores in a backup -------------------------*/
+
+// A DepotContents summarises the chunk stores for one depot in a backup.
+//
+type DepotContents struct {
+	Depot        DepotNum
+	ChunkStores  []*ChunkStore // Sorted by .Number
+	NumChunks    int           // The total number of chunks
+	StoredSize   int64         // The total size of the chunks as stored
+	OriginalSize int64         // The total size of the chunks once unpacked
+}
+
+// BackupContents reads the index of every chunk store in a backup directory
+// (in either the ‘single directory’ or the Disk_<N> layout), and returns a
+// summary for each depot, sorted by DepotNum.
+//
+// BackupContents does not check the backup for completeness; VerifyBackup does
+// that.
+//
+func BackupContents(backupPath string) ([]*DepotContents, error) {
+	return std.BackupContents(backupPath)
+}
+
+// BackupContents is the Scanner method behind the BackupContents function.
+//
+func (s *Scanner) BackupContents(backupPath string) ([]*DepotContents, error) {
+	dirs := []string{backupPath}
+	names, err := s.readDirNames(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if reDiskDir.MatchString(n) {
+			dirs = append(dirs, filepath.Join(backupPath, n))
+		}
+	}
+
+	contentsForDepot := map[DepotNum]*DepotContents{}
+	for _, dir := range dirs {
+		names, err := s.readDirNames(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			if _, ext, ok := parseChunkStoreFileName(n); !ok || ext != "csm" {
+				continue
+			}
+			cs, err := s.OpenChunkStore(filepath.Join(dir, n))
+			if err != nil {
+				return nil, err
+			}
+			dc, haveDepot := contentsForDepot[cs.Depot]
+			if !haveDepot {
+				dc = &DepotContents{Depot: cs.Depot}
+				contentsForDepot[cs.Depot] = dc
+			}
+			dc.ChunkStores = append(dc.ChunkStores, cs)
+			dc.NumChunks += cs.NumChunks()
+			dc.StoredSize += cs.StoredSize()
+			dc.OriginalSize += cs.OriginalSize()
+		}
+	}
+
+	ret := make([]*DepotContents, 0, len(contentsForDepot))
+	for _, dc := range contentsForDepot {
+		sort.Slice(dc.ChunkStores, func(i, j int) bool {
+			return dc.ChunkStores[i].Number < dc.ChunkStores[j].Number
+		})
+		ret = append(ret, dc)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Depot < ret[j].Depot })
+	return ret, nil
+}
+
+/*------------------------------ Helper stuff --------------------------------*/
+
+// A chunkStoreName identifies a chunk store within a backup.
+//
+type chunkStoreName struct {
+	depot DepotNum
+	index int
+}
+
+func (n chunkStoreName) String() string {
+	return fmt.Sprintf("%d_depotcache_%d", n.depot, n.index)
+}
+
+// parseChunkStoreFileName reports whether a file name is that of a .csd or .csm
+// file, and if so, which chunk store it belongs to and which extension it has.
+//
+func parseChunkStoreFileName(name string) (chunkStoreName, string, bool) {
+	match := reChunkStoreFile.FindStringSubmatch(name)
+	if match == nil {
+		return chunkStoreName{}, "", false
+	}
+	depot, err1 := strconv.Atoi(match[1])
+	index, err2 := strconv.Atoi(match[2])
+	if err1 != nil || err2 != nil || depot <= 0 || int64(depot) > 1<<31-1 {
+		return chunkStoreName{}, "", false
+	}
+	return chunkStoreName{DepotNum(depot), index}, match[3], true
+}
@@ -0,0 +1,100 @@
+package steamfiles_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"testing/fstest"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+)
+
+// csmFile makes the contents of a .csm file for depot 101 holding the given
+// (offset, stored size) chunk records.
+//
+func csmFile(records ...[2]uint64) []byte {
+	le := binary.LittleEndian
+	data := make([]byte, 16, 16+36*len(records))
+	copy(data, "SCFS")
+	le.PutUint32(data[4:], 2)
+	le.PutUint32(data[8:], 101)
+	le.PutUint32(data[12:], uint32(len(records)))
+	for _, r := range records {
+		rec := make([]byte, 36)
+		le.PutUint64(rec[20:], r[0])
+		le.PutUint32(rec[28:], uint32(r[1])*2)
+		le.PutUint32(rec[32:], uint32(r[1]))
+		data = append(data, rec...)
+	}
+	return data
+}
+
+func TestChunkStoreRanges(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		offset     uint64
+		size       uint64
+		inRange    bool
+		sizeNeeded int64
+	}{
+		{"first chunk", 0, 16, true, 16},
+		{"last chunk", 48, 16, true, 64},
+		{"past the end", 56, 16, false, 72},
+		{"offset past the end", 100, 0, false, 100},
+		{"offset near MaxInt64", math.MaxInt64 - 8, 256, false, math.MaxInt64},
+		{"negative offset", 1 << 63, 16, false, math.MaxInt64},
+		{"offset 2⁶⁴-1", math.MaxUint64, 1, false, math.MaxInt64},
+	} {
+		fsys := fstest.MapFS{
+			"b/101_depotcache_1.csm": {Data: csmFile([2]uint64{tc.offset, tc.size})},
+			"b/101_depotcache_1.csd": {Data: make([]byte, 64)},
+		}
+		s := steamfiles.NewScanner(steamfiles.FromFS(fsys))
+		cs, err := s.OpenChunkStore("/b/101_depotcache_1.csm")
+		if err != nil {
+			t.Fatalf("%s: OpenChunkStore: %s", tc.name, err)
+		}
+		if cs.NumChunks() != 1 || cs.DataSize != 64 {
+			t.Fatalf("%s: got %d chunks and a %d-byte .csd", tc.name, cs.NumChunks(),
+				cs.DataSize)
+		}
+		err = cs.CheckRange(cs.Chunk(0))
+		if (err == nil) != tc.inRange {
+			t.Errorf("%s: CheckRange gave %v, want in range = %v", tc.name, err,
+				tc.inRange)
+		}
+		if got := cs.DataSizeNeeded(); got != tc.sizeNeeded {
+			t.Errorf("%s: DataSizeNeeded() = %d, want %d", tc.name, got,
+				tc.sizeNeeded)
+		}
+		if _, err := cs.ChunkReader(nil, cs.Chunk(0)); (err == nil) != tc.inRange {
+			t.Errorf("%s: ChunkReader gave %v, want in range = %v", tc.name, err,
+				tc.inRange)
+		}
+	}
+}
+
+func TestOpenChunkStoreRejectsBadIndexes(t *testing.T) {
+	good := csmFile([2]uint64{0, 16})
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", good[:12]},
+		{"wrong magic", append([]byte("SCFX"), good[4:]...)},
+		{"truncated record", good[:len(good)-1]},
+		{"extra bytes", append(append([]byte(nil), good...), 0)},
+	} {
+		fsys := fstest.MapFS{"b/101_depotcache_1.csm": {Data: tc.data}}
+		s := steamfiles.NewScanner(steamfiles.FromFS(fsys))
+		if _, err := s.OpenChunkStore("/b/101_depotcache_1.csm"); err == nil {
+			t.Errorf("%s: OpenChunkStore did not fail", tc.name)
+		}
+	}
+	fsys := fstest.MapFS{"b/102_depotcache_1.csm": {Data: good}}
+	s := steamfiles.NewScanner(steamfiles.FromFS(fsys))
+	if _, err := s.OpenChunkStore("/b/102_depotcache_1.csm"); err == nil {
+		t.Errorf("OpenChunkStore accepted an index for the wrong depot")
+	}
+}
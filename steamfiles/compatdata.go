@@ -0,0 +1,239 @@
+// Functions etc for Proton’s compatdata directories (Wine prefixes) and the
+// compatibility tool settings in Steam’s config.vdf.
+
+package steamfiles
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+/*---------------------------- CompatToolMapping -----------------------------*/
+
+// A CompatTool is an entry from the "CompatToolMapping" section of
+// <SteamHome>/config/config.vdf, which records the compatibility tool (usually
+// a version of Proton) that the user chose for an app:
+//	"InstallConfigStore" { "Software" { "Valve" { "Steam" {
+//		"CompatToolMapping"
+//		{
+//			"230070"
+//			{
+//				"name"		"proton_8"
+//				"config"		""
+//				"priority"		"250"
+//			}
+//		}
+//	} } } }
+// The entry for app "0" gives the default tool for all apps.
+//
+type CompatTool struct {
+	Name     string `json:"name"`   // The tool’s internal name, eg "proton_8"
+	Config   string `json:"config"` // Extra configuration, usually empty
+	Priority int    `json:"priority"`
+}
+
+// ReadCompatToolMapping reads the "CompatToolMapping" section of a Steam
+// installation’s config/config.vdf file.  Entries for non-Steam games (whose IDs
+// are too big to be AppNums) are skipped; the default tool, if any, has AppNum
+// 0.  A missing file or section is not an error.
+//
+func ReadCompatToolMapping(steamHome string) (map[AppNum]CompatTool, error) {
+	return std.ReadCompatToolMapping(steamHome)
+}
+
+// ReadCompatToolMapping is the Scanner method behind the ReadCompatToolMapping
+// function.
+//
+func (s *Scanner) ReadCompatToolMapping(steamHome string) (map[AppNum]CompatTool, error) {
+	ret := make(map[AppNum]CompatTool)
+	configPath := filepath.Join(steamHome, "config", "config.vdf")
+	if _, err := s.fsys.Lstat(configPath); err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, cannot("examine", "", configPath, err)
+	}
+	configInfo, err := sVDF.FromFS(s.fsys, configPath, "InstallConfigStore")
+	if err != nil {
+		return nil, err
+	}
+
+	// Valve is not consistent about the case of these names.
+	mapping, ok := lookupNVLFold(configInfo.TopValue,
+		"Software", "Valve", "Steam", "CompatToolMapping")
+	if !ok {
+		return ret, nil
+	}
+	for _, appText := range mapping.Names() {
+		n, err := strconv.ParseInt(appText, 10, 64)
+		if err != nil || n < 0 || n > math.MaxInt32 {
+			continue
+		}
+		entry, ok := mapping[appText].(sVDF.NamesValuesList)
+		if !ok {
+			return nil, fileError(configPath, appText,
+				"CompatToolMapping entry %q is not a list", appText)
+		}
+		tool := CompatTool{}
+		tool.Name, _ = entry["name"].(string)
+		tool.Config, _ = entry["config"].(string)
+		if p, ok := entry["priority"].(string); ok {
+			tool.Priority, _ = strconv.Atoi(p)
+		}
+		ret[AppNum(n)] = tool
+	}
+	return ret, nil
+}
+
+// lookupNVLFold follows a path of names through nested NVLs, ignoring the case
+// of the names.
+//
+func lookupNVLFold(v sVDF.Value, names ...string) (sVDF.NamesValuesList, bool) {
+	for _, name := range names {
+		nvl, ok := v.(sVDF.NamesValuesList)
+		if !ok {
+			return nil, false
+		}
+		v = nil
+		for n, sub := range nvl {
+			if strings.EqualFold(n, name) {
+				v = sub
+				break
+			}
+		}
+	}
+	nvl, ok := v.(sVDF.NamesValuesList)
+	return nvl, ok
+}
+
+/*------------------------------ CompatPrefixes ------------------------------*/
+
+// A CompatPrefix is a steamapps/compatdata/<AppNum> directory, which holds the
+// Wine prefix that Proton uses for an app.  Many Windows games keep their saved
+// games and settings in there, and Steam backups do not include it.
+//
+type CompatPrefix struct {
+	AppNumber     AppNum        `json:"appid"`
+	AppName       string        `json:"name,omitempty"` // If the app is installed
+	Library       string        `json:"library"`        // The "steamapps" directory
+	Path          string        `json:"path"`           // The compatdata/<AppNum> directory
+	Size          int64         `json:"size"`           // Total size of its files
+	ModTime       time.Time     `json:"mtime"`          // The newest of its files’ mtimes
+	ProtonVersion string        `json:"proton_version"` // From its "version" file, if any
+	CompatTool    string        `json:"compat_tool"`    // From CompatToolMapping, if set
+	App           *InstalledApp `json:"-"`              // The owning app, if installed
+}
+
+// FindCompatPrefixes lists the Proton prefixes in every library of an
+// Installation, with their sizes and owning apps, sorted by library (in the
+// order of inst.Libraries) then AppNum.  Progress reports (via opts) count the
+// files whose sizes are added up.
+//
+// Directories whose names are not AppNums (such as those of non-Steam games)
+// are skipped.
+//
+func FindCompatPrefixes(ctx context.Context, inst *Installation, opts *ScanOptions,
+) ([]*CompatPrefix, error) {
+	return std.FindCompatPrefixes(ctx, inst, opts)
+}
+
+// FindCompatPrefixes is the Scanner method behind the FindCompatPrefixes
+// function.
+//
+func (s *Scanner) FindCompatPrefixes(ctx context.Context, inst *Installation,
+	opts *ScanOptions,
+) ([]*CompatPrefix, error) {
+	tools, err := s.ReadCompatToolMapping(inst.Home)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*CompatPrefix
+	for _, lib := range inst.Libraries {
+		dir := filepath.Join(lib.Path, "compatdata")
+		entries, err := s.fsys.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, cannot("read", "directory", dir, err)
+		}
+		var prefixes []*CompatPrefix
+		for _, e := range entries {
+			n, err := strconv.ParseInt(e.Name(), 10, 32)
+			if err != nil || n <= 0 || !e.IsDir() {
+				continue
+			}
+			p := &CompatPrefix{
+				AppNumber:  AppNum(n),
+				Library:    lib.Path,
+				Path:       filepath.Join(dir, e.Name()),
+				CompatTool: tools[AppNum(n)].Name}
+			if app, ok := inst.Apps[p.AppNumber]; ok {
+				p.App, p.AppName = app, app.AppName
+			}
+			if data, err := s.readFile(filepath.Join(p.Path, "version")); err == nil {
+				p.ProtonVersion = strings.TrimSpace(string(data))
+			}
+			prefixes = append(prefixes, p)
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			return prefixes[i].AppNumber < prefixes[j].AppNumber
+		})
+		ret = append(ret, prefixes...)
+	}
+
+	scan := newScanState(ctx, opts)
+	errors := make([]error, len(ret))
+	err = scan.forEach(len(ret), func(i int) {
+		ret[i].Size, ret[i].ModTime, errors[i] = s.treeStats(scan, ret[i].Path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errors {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// CompatPrefixFor returns the prefix for an app from a list that
+// FindCompatPrefixes returned, preferring the one in the app’s own library if
+// there are several.  It returns nil if there is none.
+//
+func CompatPrefixFor(prefixes []*CompatPrefix, app *InstalledApp, appNum AppNum,
+) *CompatPrefix {
+	var ret *CompatPrefix
+	for _, p := range prefixes {
+		if p.AppNumber != appNum {
+			continue
+		}
+		if ret == nil ||
+			(app != nil && len(app.LibraryFolders) > 0 &&
+				p.Library == app.LibraryFolders[0]) {
+			ret = p
+		}
+	}
+	return ret
+}
+
+// CompatArchivePath returns the pathname for an archive of an app’s Proton
+// prefix kept next to one of its Steam backups:
+// <backup directory>.compatdata_<AppNum>.tar.gz.  Being outside the backup
+// directory, the archive does not bother Steam when it restores the backup.
+//
+func CompatArchivePath(backup *AppBackup, appNum AppNum) string {
+	return fmt.Sprintf("%s.compatdata_%d.tar.gz",
+		filepath.Clean(backup.BackupPath), appNum)
+}
@@ -0,0 +1,276 @@
+// Functions etc for reading the depot manifests that Steam keeps in
+// <SteamHome>/depotcache/<DepotNum>_<ManifestID>.manifest files.
+
+package steamfiles
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Steam identifies each version of a depot’s contents by a 64-bit ‘manifest
+// ID’.  The "InstalledDepots" section of an appmanifest_<AppNum>.acf file says
+// which manifest ID is installed for each of the app’s depots.
+//
+type ManifestID uint64
+
+// A DepotManifest lists the files in one version of a depot.
+//
+type DepotManifest struct {
+	Path               string     // The file the manifest was read from
+	Depot              DepotNum   // Which depot the manifest is for
+	ManifestID         ManifestID // Which version of the depot
+	CreationTime       time.Time  // When Valve created the manifest
+	FilenamesEncrypted bool       // If true, the .Name fields are unusable
+	OriginalSize       int64      // Total size of the files
+	CompressedSize     int64      // Total size of the (compressed) chunks
+	UniqueChunks       int        // How many distinct chunks there are
+	Files              []DepotFile
+}
+
+// A DepotFile describes a file, directory or symlink in a depot.
+//
+type DepotFile struct {
+	Name       string         // Relative pathname, using '/' as separator
+	Size       int64          // Size in bytes
+	Flags      DepotFileFlags // What kind of file this is
+	SHA1       [20]byte       // SHA-1 hash of the file’s contents
+	LinkTarget string         // Where a symlink points to
+	Chunks     []DepotChunk   // The pieces the file is delivered in
+}
+
+// A DepotChunk describes one piece of a file in a depot.
+//
+type DepotChunk struct {
+	SHA1           [20]byte // SHA-1 hash of the chunk’s data
+	CRC            uint32   // Adler-32 (sic) checksum of the chunk’s data
+	Offset         int64    // Where the chunk goes in the file
+	OriginalSize   int64    // How big the chunk is
+	CompressedSize int64    // How big the chunk is when compressed
+}
+
+// DepotFileFlags are Valve’s EDepotFileFlag bits.
+//
+type DepotFileFlags uint32
+
+const (
+	DepotFileUserConfig          DepotFileFlags = 1
+	DepotFileVersionedUserConfig DepotFileFlags = 2
+	DepotFileEncrypted           DepotFileFlags = 4
+	DepotFileReadOnly            DepotFileFlags = 8
+	DepotFileHidden              DepotFileFlags = 16
+	DepotFileExecutable          DepotFileFlags = 32
+	DepotFileDirectory           DepotFileFlags = 64
+	DepotFileCustomExecutable    DepotFileFlags = 128
+	DepotFileInstallScript       DepotFileFlags = 256
+	DepotFileSymlink             DepotFileFlags = 512
+)
+
+// IsDir reports whether a DepotFile is a directory.
+//
+func (f *DepotFile) IsDir() bool {
+	return f.Flags&DepotFileDirectory != 0
+}
+
+// IsSymlink reports whether a DepotFile is a symbolic link.
+//
+func (f *DepotFile) IsSymlink() bool {
+	return f.Flags&DepotFileSymlink != 0
+}
+
+// DepotManifestPath returns the pathname that Steam uses for a depot manifest
+// in a ‘depotcache’ directory.
+//
+func DepotManifestPath(depotcacheDir string, depot DepotNum, id ManifestID) string {
+	return filepath.Join(depotcacheDir, fmt.Sprintf("%d_%d.manifest", depot, id))
+}
+
+// A manifest file is a series of sections, each starting with a 32-bit magic
+// number and (except for the last) a 32-bit length, both little-endian.
+// (These numbers are the ones that SteamKit uses.)
+//
+const (
+	manifestPayloadMagic   = 0x71F617D0 // ContentManifestPayload message
+	manifestMetadataMagic  = 0x1F4812BE // ContentManifestMetadata message
+	manifestSignatureMagic = 0x1B81B817 // ContentManifestSignature message
+	manifestEndMagic       = 0x32C415AB // End of manifest (no length)
+)
+
+// ReadDepotManifest reads and decodes a .manifest file.  It copes with the
+// file being zipped, as manifests fetched from Valve’s servers are.
+//
+func ReadDepotManifest(path string) (*DepotManifest, error) {
+	return std.ReadDepotManifest(path)
+}
+
+// ReadDepotManifest is the Scanner method behind the ReadDepotManifest
+// function.
+//
+func (s *Scanner) ReadDepotManifest(path string) (*DepotManifest, error) {
+	data, err := s.readFile(path)
+	if err != nil {
+		return nil, cannot("read", "depot manifest", path, err)
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		data, err = unzipManifest(data)
+		if err != nil {
+			return nil, cannot("unzip", "depot manifest", path, err)
+		}
+	}
+
+	ret := &DepotManifest{Path: path}
+	le := binary.LittleEndian
+	havePayload, haveMetadata := false, false
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fileError(path, "", "truncated section header")
+		}
+		magic := le.Uint32(data)
+		if magic == manifestEndMagic {
+			break
+		}
+		if len(data) < 8 || uint64(le.Uint32(data[4:])) > uint64(len(data)-8) {
+			return nil, fileError(path, "",
+				"truncated section (magic %#08x)", magic)
+		}
+		section := data[8 : 8+le.Uint32(data[4:])]
+		data = data[8+len(section):]
+
+		switch magic {
+		case manifestPayloadMagic:
+			havePayload = true
+			err = ret.decodePayload(section)
+		case manifestMetadataMagic:
+			haveMetadata = true
+			err = ret.decodeMetadata(section)
+		case manifestSignatureMagic:
+			// We cannot check signatures without Valve’s key, so ignore them.
+		default:
+			return nil, fileError(path, "",
+				"unknown section magic %#08x (old-format manifest?)", magic)
+		}
+		if err != nil {
+			return nil, fileError(path, "", "%s", err)
+		}
+	}
+	if !havePayload || !haveMetadata {
+		return nil, fileError(path, "", "no file list or no metadata")
+	}
+	return ret, nil
+}
+
+// decodeMetadata gets details from a ContentManifestMetadata message.
+//
+func (m *DepotManifest) decodeMetadata(msg []byte) error {
+	return protoFields(msg, func(f protoField) error {
+		switch f.number {
+		case 1:
+			m.Depot = DepotNum(f.num)
+		case 2:
+			m.ManifestID = ManifestID(f.num)
+		case 3:
+			m.CreationTime = time.Unix(int64(f.num), 0)
+		case 4:
+			m.FilenamesEncrypted = f.num != 0
+		case 5:
+			m.OriginalSize = int64(f.num)
+		case 6:
+			m.CompressedSize = int64(f.num)
+		case 7:
+			m.UniqueChunks = int(f.num)
+		}
+		return nil
+	})
+}
+
+// decodePayload gets the file list from a ContentManifestPayload message.
+//
+func (m *DepotManifest) decodePayload(msg []byte) error {
+	return protoFields(msg, func(f protoField) error {
+		if f.number != 1 || f.wireType != wireBytes {
+			return nil
+		}
+		var df DepotFile
+		err := protoFields(f.bytes, func(f protoField) error {
+			switch f.number {
+			case 1:
+				df.Name = depotFileName(string(f.bytes))
+			case 2:
+				df.Size = int64(f.num)
+			case 3:
+				df.Flags = DepotFileFlags(f.num)
+			case 5:
+				copy(df.SHA1[:], f.bytes)
+			case 6:
+				chunk, err := decodeChunk(f.bytes)
+				if err != nil {
+					return err
+				}
+				df.Chunks = append(df.Chunks, chunk)
+			case 7:
+				df.LinkTarget = string(f.bytes)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, df)
+		return nil
+	})
+}
+
+// decodeChunk gets details from a ContentManifestPayload.FileMapping.ChunkData
+// message.
+//
+func decodeChunk(msg []byte) (DepotChunk, error) {
+	var ret DepotChunk
+	err := protoFields(msg, func(f protoField) error {
+		switch f.number {
+		case 1:
+			copy(ret.SHA1[:], f.bytes)
+		case 2:
+			ret.CRC = uint32(f.num)
+		case 3:
+			ret.Offset = int64(f.num)
+		case 4:
+			ret.OriginalSize = int64(f.num)
+		case 5:
+			ret.CompressedSize = int64(f.num)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// depotFileName converts a file name from a manifest (which uses Windows
+// conventions) to a slash-separated relative pathname.
+//
+func depotFileName(name string) string {
+	name = strings.TrimRight(name, "\x00")
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// unzipManifest extracts the first (and only) file from a zipped manifest.
+//
+func unzipManifest(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(zr.File) == 0 {
+		return nil, fmt.Errorf("empty zip archive")
+	}
+	fh, err := zr.File[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return io.ReadAll(fh)
+}
@@ -0,0 +1,146 @@
+package steamfiles
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// manifestSection makes one section of a .manifest file.
+//
+func manifestSection(magic uint32, body []byte) []byte {
+	ret := make([]byte, 8, 8+len(body))
+	binary.LittleEndian.PutUint32(ret, magic)
+	binary.LittleEndian.PutUint32(ret[4:], uint32(len(body)))
+	return append(ret, body...)
+}
+
+var manifestCreated = time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// testManifest returns the sections of a small depot manifest for depot 101:
+// a 10-byte executable in one chunk, its directory and a symlink to it.
+//
+func testManifest() (payload, metadata, signature, end []byte) {
+	sha := bytes.Repeat([]byte{0xAB}, 20)
+	chunk := cat(pbBytes(1, sha), pbVarint(2, 0xDEADBEEF), pbVarint(3, 0),
+		pbVarint(4, 10), pbVarint(5, 8))
+	files := cat(
+		pbBytes(1, cat(pbBytes(1, []byte("bin\\game\x00")), pbVarint(2, 10),
+			pbVarint(3, uint64(DepotFileExecutable)), pbBytes(5, sha),
+			pbBytes(6, chunk))),
+		pbBytes(1, cat(pbBytes(1, []byte("bin")),
+			pbVarint(3, uint64(DepotFileDirectory)))),
+		pbBytes(1, cat(pbBytes(1, []byte("game")),
+			pbVarint(3, uint64(DepotFileSymlink)), pbBytes(7, []byte("bin/game")))),
+	)
+	meta := cat(pbVarint(1, 101), pbVarint(2, 1234),
+		pbVarint(3, uint64(manifestCreated.Unix())), pbVarint(5, 10),
+		pbVarint(6, 8), pbVarint(7, 1))
+	end = make([]byte, 4)
+	binary.LittleEndian.PutUint32(end, manifestEndMagic)
+	return manifestSection(manifestPayloadMagic, files),
+		manifestSection(manifestMetadataMagic, meta),
+		manifestSection(manifestSignatureMagic, []byte("signed")),
+		end
+}
+
+// readTestManifest runs ReadDepotManifest on a file holding data.
+//
+func readTestManifest(data []byte) (*DepotManifest, error) {
+	fsys := fstest.MapFS{"depotcache/101_1234.manifest": {Data: data}}
+	return NewScanner(FromFS(fsys)).ReadDepotManifest("/depotcache/101_1234.manifest")
+}
+
+func TestReadDepotManifest(t *testing.T) {
+	payload, metadata, signature, end := testManifest()
+	plain := cat(payload, metadata, signature, end)
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, err := zw.Create("z")
+	if err == nil {
+		_, err = w.Write(plain)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"plain":        plain,
+		"zipped":       zipped.Bytes(),
+		"no end":       cat(payload, metadata, signature),
+		"reordered":    cat(metadata, signature, payload, end),
+		"after end":    cat(payload, metadata, end, []byte("junk")),
+		"no signature": cat(payload, metadata, end),
+	} {
+		m, err := readTestManifest(data)
+		if err != nil {
+			t.Errorf("%s: ReadDepotManifest: %s", name, err)
+			continue
+		}
+		if m.Depot != 101 || m.ManifestID != 1234 ||
+			!m.CreationTime.Equal(manifestCreated) || m.OriginalSize != 10 ||
+			m.CompressedSize != 8 || m.UniqueChunks != 1 || m.FilenamesEncrypted {
+			t.Errorf("%s: got metadata %+v", name, m)
+		}
+		if len(m.Files) != 3 {
+			t.Errorf("%s: got %d files, want 3", name, len(m.Files))
+			continue
+		}
+		f := m.Files[0]
+		if f.Name != "bin/game" || f.Size != 10 || f.Flags != DepotFileExecutable ||
+			f.SHA1[19] != 0xAB || len(f.Chunks) != 1 {
+			t.Errorf("%s: got file %+v", name, f)
+		} else if c := f.Chunks[0]; c.CRC != 0xDEADBEEF || c.OriginalSize != 10 ||
+			c.CompressedSize != 8 || c.SHA1[0] != 0xAB {
+			t.Errorf("%s: got chunk %+v", name, c)
+		}
+		if !m.Files[1].IsDir() || m.Files[1].Name != "bin" {
+			t.Errorf("%s: got directory %+v", name, m.Files[1])
+		}
+		if !m.Files[2].IsSymlink() || m.Files[2].LinkTarget != "bin/game" {
+			t.Errorf("%s: got symlink %+v", name, m.Files[2])
+		}
+	}
+}
+
+func TestReadDepotManifestMalformed(t *testing.T) {
+	payload, metadata, signature, end := testManifest()
+	badPayload := manifestSection(manifestPayloadMagic,
+		pbBytes(1, []byte{1<<3 | wireBytes, 9, 'x'}))
+	badChunk := manifestSection(manifestPayloadMagic,
+		pbBytes(1, pbBytes(6, []byte{3 << 3, 0x80})))
+	oldMagic := make([]byte, 8)
+	binary.LittleEndian.PutUint32(oldMagic, 0x16349781)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", []byte{0xD0, 0x17}},
+		{"old format", cat(oldMagic, payload, metadata, end)},
+		{"wrong magic", cat(payload, manifestSection(0x12345678, nil), metadata, end)},
+		{"no metadata", cat(payload, signature, end)},
+		{"no payload", cat(metadata, signature, end)},
+		{"only end", end},
+		{"truncated section", cat(payload, metadata[:len(metadata)-1])},
+		{"length past end", cat(payload[:4], []byte{0xFF, 0xFF, 0xFF, 0x7F},
+			payload[8:])},
+		{"missing length", cat(payload, metadata[:6])},
+		{"bad file list", cat(badPayload, metadata, end)},
+		{"bad chunk", cat(badChunk, metadata, end)},
+		{"bad metadata", cat(payload,
+			manifestSection(manifestMetadataMagic, []byte{1 << 3}), end)},
+		{"corrupt zip", []byte("PK\x03\x04 not really a zip file")},
+	} {
+		if m, err := readTestManifest(tc.data); err == nil {
+			t.Errorf("%s: ReadDepotManifest gave %+v, want an error", tc.name, m)
+		}
+	}
+}
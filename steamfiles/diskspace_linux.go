@@ -0,0 +1,66 @@
+package steamfiles
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// sysRoot is where DiskOf looks for block devices; tests change it.
+//
+var sysRoot = "/sys"
+
+// Statfs returns the size of the file system holding a file, how many bytes
+// are free on it, and how many of those unprivileged users can write.
+//
+func (osFileSystem) Statfs(name string) (capacity, free, available int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return 0, 0, 0, &fs.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	bsize := int64(st.Bsize)
+	return int64(st.Blocks) * bsize, int64(st.Bfree) * bsize,
+		int64(st.Bavail) * bsize, nil
+}
+
+// fileIDOf gets a FileID from the results of Stat or Lstat, if the FileSystem
+// that produced them provides one.
+//
+func fileIDOf(info fs.FileInfo) (FileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+	return FileID{Device: uint64(st.Dev), Inode: uint64(st.Ino)}, true
+}
+
+// DiskOf returns the device number of the disk holding a file system, given
+// the file system’s device number: for a partition, the whole disk’s number (as
+// /sys/dev/block says), so that two partitions of one disk are not taken for
+// two disks.  Other devices (whole disks, RAID arrays, LVM volumes, network and
+// virtual file systems) are returned as they are.
+//
+func (osFileSystem) DiskOf(dev uint64) uint64 {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	devDir, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "dev", "block",
+		fmt.Sprintf("%d:%d", major, minor)))
+	if err != nil {
+		return dev
+	}
+	if _, err := os.Stat(filepath.Join(devDir, "partition")); err != nil {
+		return dev // Not a partition
+	}
+	text, err := os.ReadFile(filepath.Join(filepath.Dir(devDir), "dev"))
+	if err != nil {
+		return dev
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(text)), "%d:%d", &major,
+		&minor); err != nil {
+		return dev
+	}
+	return major&0xfff<<8 | major&^0xfff<<32 | minor&0xff | minor&^0xff<<12
+}
@@ -0,0 +1,74 @@
+package steamfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSys makes DiskOf look in a temporary directory holding the given block
+// devices until the test finishes.  Each device is given by its path under
+// devices/ (a partition being a subdirectory of its disk) and its "MAJ:MIN".
+//
+func fakeSys(t *testing.T, devices map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	blockDir := filepath.Join(root, "dev", "block")
+	if err := os.MkdirAll(blockDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, dev := range devices {
+		dir := filepath.Join(root, "devices", path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := os.WriteFile(filepath.Join(dir, "dev"), []byte(dev+"\n"), 0644)
+		if err == nil && filepath.Base(filepath.Dir(dir)) != "block" {
+			err = os.WriteFile(filepath.Join(dir, "partition"), []byte("1\n"),
+				0644)
+		}
+		if err == nil {
+			err = os.Symlink(filepath.Join("..", "..", "devices", path),
+				filepath.Join(blockDir, dev))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := sysRoot
+	sysRoot = root
+	t.Cleanup(func() { sysRoot = prev })
+}
+
+func TestDiskOf(t *testing.T) {
+	fakeSys(t, map[string]string{
+		"pci/block/sda":               "8:0",
+		"pci/block/sda/sda1":          "8:1",
+		"pci/block/sda/sda2":          "8:2",
+		"pci/nvme/block/nvme0n1":      "259:0",
+		"pci/nvme/block/nvme0n1/p300": "259:300",
+		"virtual/block/dm-0":          "253:0",
+		"virtual/block/md0":           "9:0",
+		"virtual/block/md0/md0p1":     "259:1",
+		"pci/block/sdb":               "8:16",
+		"pci/block/sdb/sdb5":          "8:21",
+	})
+	for _, tc := range []struct {
+		name      string
+		dev, want uint64
+	}{
+		{"first partition", 0x801, 0x800},
+		{"second partition", 0x802, 0x800},
+		{"whole disk", 0x800, 0x800},
+		{"minor over 255", 0x11032c, 0x10300},
+		{"LVM volume", 0xfd00, 0xfd00},
+		{"partition of a RAID array", 0x10301, 0x900},
+		{"another disk", 0x815, 0x810},
+		{"unknown device", 0x2a, 0x2a},
+	} {
+		if got := (osFileSystem{}).DiskOf(tc.dev); got != tc.want {
+			t.Errorf("%s: DiskOf(%#x) = %#x, want %#x", tc.name, tc.dev, got,
+				tc.want)
+		}
+	}
+}
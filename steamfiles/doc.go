@@ -22,6 +22,12 @@
 // strings) that this package’s sibling sVDF can parse.  FindSteamLibraryFolders()
 // finds the initial SLF and parses this file to find any other SLFs.
 //
+// On a dual-boot machine, the same games may be used by a Windows Steam
+// installation, whose libraryfolders.vdf has Windows pathnames (fx,
+// `D:\SteamLibrary`).  Setting SteamHomeOverride to where its Steam directory
+// is mounted, and DriveMounts to where its drives are, lets this package read
+// it too.
+//
 //
 // Installed Apps
 //
@@ -34,6 +40,11 @@
 //	<SLF>/steamapps/common/<installdir>
 // is the (root of the) directory tree where all the app’s files live.
 //
+// Each app’s files come from one or more ‘depots’.  Steam keeps a ‘depot
+// manifest’ listing the files in each installed version of a depot at
+//	<SteamHome>/depotcache/<DepotNum>_<ManifestID>.manifest
+// which ReadDepotManifest can decode.
+//
 //
 // Steam Backups
 //
@@ -61,4 +72,89 @@
 //			sku.sis
 // with the files stored in the backup directory itself, not in a subdirectory.
 //
+// Each pair of <DepotNum>_depotcache_<N>.csd and .csm files is a ‘chunk store’:
+// the .csd file holds chunks of the depot’s data and the .csm file indexes
+// them.  OpenChunkStore reads a .csm file, BackupContents summarises all the
+// chunk stores in a backup, and VerifyBackup checks that none are missing.
+//
+// Steam’s backup wizard cannot be scripted, so WriteArchiveBackup makes this
+// package’s own kind of backup: a gzipped tar archive of one app’s manifest
+// and files (and optionally its Workshop content and Proton prefix), named
+// <name>.steambackup.tar.gz, with a JSON index (see BackupIndex and
+// ReadBackupIndex) named <name>.steambackup.json beside it.  ScanBackupsDir
+// finds these archive backups along with Steam’s.  RestoreArchiveBackup puts
+// one back into a library, with a manifest that makes Steam check the app’s
+// files before it next runs.  PlanTidy works out which backups a
+// RetentionPolicy does not want, and MoveToTrash gets rid of them
+// recoverably.  CheckRedundancy counts each app’s up-to-date backups across
+// all the backups directories, and reports apps that have them on fewer
+// distinct devices than a RedundancyPolicy wants.
+//
+//
+// Installations
+//
+// Rather than calling FindSteamLibraryDirs, ScanSteamLibDir and ScanBackupsDir
+// themselves, programs can call LoadInstallation, which does all of that (plus
+// FindUsers) and returns an Installation with indexes of the results: apps by
+// AppNum, by library and by StateFlags, backups by app, and users.  It also
+// reads each library’s appworkshop_<AppNum>.acf files (see ReadAppWorkshop),
+// since Steam backups leave Workshop content out; WorkshopNewerThan tells
+// whether that content has changed since a backup.  Given a LoadOptions.CacheDir
+// (see DefaultCacheDir), it saves a LibrarySnapshot of each library it scans,
+// and loads libraries it cannot scan (fx, on drives that are not mounted) from
+// there into Installation.Offline, marked with when they were last scanned.
+// FindOrphans uses an Installation to find the directories that uninstalled
+// apps have left behind (in steamapps/common, shadercache, compatdata and
+// workshop).  FindPendingUpdates finds apps that Steam is part-way through
+// downloading or updating, which should not be backed up or moved until it
+// has finished.  Fsck checks an installation’s VDF files, manifests, install
+// directories and libraryfolders.vdf "apps" lists for inconsistencies,
+// reporting each one with a severity.
+//
+// MoveApp moves an app to another library folder, copying and checking its
+// files before switching over, with a journal so that an interrupted move can
+// be resumed or (with AbortMove) rolled back.  It refuses to run while Steam is
+// running (see SteamRunning).  PlanPlacement works out which moves would keep
+// recently played apps on fast storage, the rest on slow storage, and some
+// space free in every library.
+//
+// FindCompatPrefixes lists the Proton prefixes (steamapps/compatdata/<AppNum>),
+// which hold the saved games of many Windows games but are not in Steam’s
+// backups, and ReadCompatToolMapping reads which compatibility tool each app
+// uses.  WriteTreeArchive and ExtractArchive keep copies of such directories.
+//
+//
+// Scanning
+//
+// ScanSteamLibDir, ScanBackupsDir and AppNewerThan each have a …Context variant
+// that takes a context.Context and a *ScanOptions.  These read files with a
+// bounded pool of goroutines, report progress (files and bytes examined) via a
+// callback, and stop early when the context is cancelled.  Their results are
+// the same as the plain versions’, whatever order the files get read in.
+//
+//
+// File Systems
+//
+// All the package’s file access goes through a FileSystem, which by default is
+// the real one (OSFileSystem).  UseFileSystem can switch to another; FromFS
+// adapts any io/fs file system (such as an fstest.MapFS of test fixtures, or
+// os.DirFS of an archived copy of a Steam library) for this purpose.
+//
+// A Scanner pairs a FileSystem with the caches built up while using it, and is
+// safe for concurrent use.  Each of the package’s functions that reads files is
+// also a Scanner method; the functions use DefaultScanner(), which
+// UseFileSystem replaces.  Long-running programs can use Scanner.Invalidate or
+// Scanner.Refresh when they know that files have changed.
+//
+// StatDisk gives the size and free space of the file system holding a
+// directory, and FileIdentity a directory’s device and inode numbers, which
+// are the same however it is reached.  FindSteamLibraryDirs, LoadInstallation
+// and UniqueDirs use these to list each library or backups directory once,
+// even if symlinks or bind mounts give it several pathnames, and
+// Installation.Volumes groups an Installation’s directories by file system.
+//
+// Package steamtest builds synthetic Steam installations (libraries, apps,
+// backups and users) in a temporary directory or in memory, for testing code
+// that uses this package.
+//
 package steamfiles // import "github.com/c12h/steam-stuff/steamfiles"
@@ -49,7 +49,7 @@ type NotFoundError struct{
 }
 
 func (e *NotFoundError) Error() string {
-	text := fmt.Sprintf("cannot find %", e.What)
+	text := fmt.Sprintf("cannot find %s", e.What)
 	if e.BaseErr != nil {
 		text = fmt.Sprintf("%s: %s", text, e.BaseErr)
 	}
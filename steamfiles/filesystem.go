@@ -0,0 +1,180 @@
+package steamfiles
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A FileSystem provides the access to files and directories that this package
+// needs.  All of this package’s functions go through a FileSystem, so callers
+// can point them at (say) an archived copy of a Steam library or an in-memory
+// tree of test fixtures instead of the real file system.
+//
+// Pathnames given to a FileSystem are in the local OS’s syntax, and are usually
+// absolute; that is what callers of this package pass in and get back.
+//
+// A FileSystem is also an fs.FS, but (unlike fs.FS) it must accept absolute
+// pathnames.
+//
+type FileSystem interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)  // Follows symlinks
+	Lstat(name string) (fs.FileInfo, error) // Does not follow symlinks
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// OSFileSystem is the FileSystem that accesses real files via package os.  It
+// is the default.
+//
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFileSystem) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFileSystem) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFileSystem) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+func (osFileSystem) Readlink(name string) (string, error)       { return os.Readlink(name) }
+
+// FromFS adapts an io/fs file system (fx, a testing/fstest.MapFS or the result
+// of os.DirFS) to a FileSystem.
+//
+// Pathnames are mapped to fs.FS names by converting them to slash-separated
+// form and removing any leading slashes, so "/home/me/.steam/steam" refers to
+// "home/me/.steam/steam" in fsys.  If fsys has an Lstat method it is used;
+// otherwise Lstat is the same as Stat.
+//
+func FromFS(fsys fs.FS) FileSystem {
+	return ioFileSystem{fsys}
+}
+
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+func (f ioFileSystem) Open(name string) (fs.File, error) {
+	return f.fsys.Open(fsName(name))
+}
+func (f ioFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, fsName(name))
+}
+func (f ioFileSystem) Lstat(name string) (fs.FileInfo, error) {
+	if lfs, ok := f.fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	}); ok {
+		return lfs.Lstat(fsName(name))
+	}
+	return fs.Stat(f.fsys, fsName(name))
+}
+func (f ioFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, fsName(name))
+}
+
+// fsName converts a pathname in the local OS’s syntax to an fs.FS name.
+//
+func fsName(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if vol := filepath.VolumeName(path); vol != "" {
+		path = path[len(vol):]
+	}
+	path = strings.TrimLeft(path, "/")
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+/*--------------------- The FileSystem used by this package ------------------*/
+
+// UseFileSystem makes this package’s functions use fsys for all file access,
+// by replacing DefaultScanner() with a new Scanner (whose caches start empty).
+// Passing nil restores the default, OSFileSystem.
+//
+// UseFileSystem should not be called while any other function in this package
+// is running.  Programs that need several file systems at once should use
+// several Scanners instead.
+//
+func UseFileSystem(fsys FileSystem) {
+	std = NewScanner(fsys)
+}
+
+/*----------------------------- Helper functions -----------------------------*/
+
+// readDirNames returns the names of the entries in a directory.
+//
+func (s *Scanner) readDirNames(dirPath string) ([]string, error) {
+	entries, err := s.fsys.ReadDir(dirPath)
+	if err != nil {
+		return nil, cannot("read", "directory", dirPath, err)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+// readFile returns the contents of a file.
+//
+func (s *Scanner) readFile(path string) ([]byte, error) {
+	fh, err := s.fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return io.ReadAll(fh)
+}
+
+// evalSymlinks resolves any symlinks in a pathname, if the FileSystem in use
+// can do that; if not, it returns the pathname unchanged.
+//
+func (s *Scanner) evalSymlinks(path string) (string, error) {
+	if efs, ok := s.fsys.(interface {
+		EvalSymlinks(name string) (string, error)
+	}); ok {
+		return efs.EvalSymlinks(path)
+	}
+	return path, nil
+}
+
+// readlink returns the target of a symlink, if the FileSystem in use can do
+// that.
+//
+func (s *Scanner) readlink(path string) (string, error) {
+	if rfs, ok := s.fsys.(interface {
+		Readlink(name string) (string, error)
+	}); ok {
+		return rfs.Readlink(path)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+}
+
+// walkTree calls fn for every file and directory under (but not including)
+// root, in lexical order, much like filepath.WalkDir.  If fn returns
+// filepath.SkipDir for a directory, walkTree does not look inside it.
+//
+func (s *Scanner) walkTree(root string, fn func(path string, d fs.DirEntry) error) error {
+	entries, err := s.fsys.ReadDir(root)
+	if err != nil {
+		return cannot("read", "directory", root, err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(root, e.Name())
+		err := fn(path, e)
+		if err == filepath.SkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if err := s.walkTree(path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
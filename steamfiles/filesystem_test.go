@@ -0,0 +1,204 @@
+package steamfiles
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// These tests drive the package from an in-memory fstest.MapFS via FromFS, so
+// they need no real Steam installation (and do not use package steamtest,
+// which would be an import cycle here).
+
+var fixtureTime = time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+const fixtureHome = "/home/me/.steam/steam"
+
+// fixtureFS returns a small Steam installation: two library folders, three
+// apps (one with a wrongly-cased "installdir" and one in steamapps/music), and
+// backups in both of Steam’s layouts.
+//
+func fixtureFS() fstest.MapFS {
+	file := func(text string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(text), ModTime: fixtureTime, Mode: 0644}
+	}
+	manifest := func(appid, name, installdir string) *fstest.MapFile {
+		return file(`"AppState"
+{
+	"appid"		"` + appid + `"
+	"name"		"` + name + `"
+	"installdir"		"` + installdir + `"
+	"StateFlags"		"4"
+	"LastUpdated"		"1609502400"
+	"SizeOnDisk"		"5"
+}
+`)
+	}
+	sku := func(name string, apps ...string) *fstest.MapFile {
+		text := "\"SKU\"\n{\n\t\"name\"\t\t\"" + name + "\"\n\t\"apps\"\n\t{\n"
+		for i, a := range apps {
+			text += "\t\t\"" + string(rune('0'+i)) + "\"\t\t\"" + a + "\"\n"
+		}
+		return file(text + "\t}\n}\n")
+	}
+	return fstest.MapFS{
+		"home/me/.steam/steam/steamapps/libraryfolders.vdf": file(`"libraryfolders"
+{
+	"0"
+	{
+		"path"		"/home/me/.steam/steam"
+		"apps"
+		{
+			"230070"		"5"
+		}
+	}
+	"1"
+	{
+		"path"		"/media/games/SteamLibrary"
+		"apps"
+		{
+			"201310"		"5"
+			"492740"		"5"
+		}
+	}
+}
+`),
+		"home/me/.steam/steam/steamapps/appmanifest_230070.acf": manifest(
+			"230070", "The Age of Decadence", "AgeOfDecadence"),
+		"home/me/.steam/steam/steamapps/common/AgeOfDecadence/game": file("#!..."),
+
+		"media/games/SteamLibrary/steamapps/appmanifest_201310.acf": manifest(
+			"201310", "X3: Albion Prelude", "x3 terran conflict"),
+		"media/games/SteamLibrary/steamapps/common/X3 Terran Conflict/x3": file("#!..."),
+		"media/games/SteamLibrary/steamapps/appmanifest_492740.acf": manifest(
+			"492740", "Stellaris: Original Game Soundtrack", "Stellaris Soundtrack"),
+		"media/games/SteamLibrary/steamapps/music/Stellaris Soundtrack/01.mp3": file("ID3.."),
+
+		"home/me/.steam/steam/Backups/Decadence/sku.sis":       sku("Decadence", "230070"),
+		"home/me/.steam/steam/Backups/X3/Disk_1/sku.sis":       sku("X3", "201310"),
+		"home/me/.steam/steam/Backups/X3/Disk_2/sku.sis":       sku("X3", "201310"),
+		"home/me/.steam/steam/Backups/Not a backup/readme.txt": file("hello"),
+	}
+}
+
+func fixtureScanner() *Scanner {
+	s := NewScanner(FromFS(fixtureFS()))
+	s.SteamHomeOverride = fixtureHome
+	return s
+}
+
+func TestFromFSNames(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":                     ".",
+		"/home/me/.steam/steam": "home/me/.steam/steam",
+		"/media/games/":         "media/games",
+		"/a/b/../c":             "a/c",
+	} {
+		if got := fsName(path); got != want {
+			t.Errorf("fsName(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	fsys := FromFS(fixtureFS())
+	info, err := fsys.Stat("/home/me/.steam/steam/steamapps")
+	if err != nil || !info.IsDir() {
+		t.Fatalf("Stat of steamapps gave %v, %v; want a directory", info, err)
+	}
+	if _, err := fsys.Lstat("/no/such/file"); err == nil {
+		t.Errorf("Lstat of a missing file did not fail")
+	}
+}
+
+func TestLoadInstallationFromFS(t *testing.T) {
+	inst, err := fixtureScanner().LoadInstallation(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Home != fixtureHome {
+		t.Errorf("Home = %q, want %q", inst.Home, fixtureHome)
+	}
+	if len(inst.Libraries) != 2 {
+		t.Fatalf("got %d libraries, want 2", len(inst.Libraries))
+	}
+	if !inst.Libraries[0].IsHome || inst.Libraries[1].IsHome {
+		t.Errorf("only the first library should be the home one")
+	}
+	for appNum, lib := range map[AppNum]string{
+		230070: "/home/me/.steam/steam/steamapps",
+		201310: "/media/games/SteamLibrary/steamapps",
+		492740: "/media/games/SteamLibrary/steamapps",
+	} {
+		app, ok := inst.Apps[appNum]
+		if !ok {
+			t.Errorf("app %d not loaded", appNum)
+			continue
+		}
+		if got := inst.LibraryOf(app); got == nil || got.Path != lib {
+			t.Errorf("app %d is in %v, want %q", appNum, got, lib)
+		}
+		if !app.LastUpdated.Equal(fixtureTime) {
+			t.Errorf("app %d LastUpdated = %v, want %v", appNum, app.LastUpdated,
+				fixtureTime)
+		}
+	}
+	if len(inst.Backups) != 2 || len(inst.AllBackups) != 2 {
+		t.Errorf("got %d preferred and %d total backups, want 2 and 2",
+			len(inst.Backups), len(inst.AllBackups))
+	}
+	if len(inst.UninstalledBackups()) != 0 {
+		t.Errorf("UninstalledBackups() = %v, want none", inst.UninstalledBackups())
+	}
+}
+
+func TestScanBackupsDirFromFS(t *testing.T) {
+	backups := make(AppBackupForAppNum)
+	err := fixtureScanner().ScanBackupsDir(fixtureHome+"/Backups", backups, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for appNum, name := range map[AppNum]string{230070: "Decadence", 201310: "X3"} {
+		b, ok := backups[appNum]
+		if !ok {
+			t.Errorf("no backup found for app %d", appNum)
+			continue
+		}
+		if b.BackupName != name || b.BackupPath != fixtureHome+"/Backups/"+name {
+			t.Errorf("backup of app %d is %q at %q", appNum, b.BackupName, b.BackupPath)
+		}
+		if !b.ModTime.Equal(fixtureTime) {
+			t.Errorf("backup of app %d ModTime = %v, want %v", appNum, b.ModTime,
+				fixtureTime)
+		}
+	}
+	if len(backups) != 2 {
+		t.Errorf("got %d backups, want 2", len(backups))
+	}
+}
+
+func TestAppNewerThanFromFS(t *testing.T) {
+	s := fixtureScanner()
+	before, after := fixtureTime.Add(-time.Hour), fixtureTime.Add(time.Hour)
+	for _, tc := range []struct {
+		lib, installDir string
+	}{
+		{fixtureHome + "/steamapps", "AgeOfDecadence"},
+		{"/media/games/SteamLibrary/steamapps", "x3 terran conflict"},   // Wrongly cased
+		{"/media/games/SteamLibrary/steamapps", "Stellaris Soundtrack"}, // In music/
+	} {
+		for _, cutoff := range []time.Time{before, after} {
+			newer, err := s.AppNewerThan(tc.lib, tc.installDir, cutoff)
+			if err != nil {
+				t.Errorf("AppNewerThan(%q, %q): %s", tc.lib, tc.installDir, err)
+				continue
+			}
+			if want := cutoff.Equal(before); newer != want {
+				t.Errorf("AppNewerThan(%q, %q, %v) = %v, want %v",
+					tc.lib, tc.installDir, cutoff, newer, want)
+			}
+		}
+	}
+	if _, err := s.AppNewerThan(fixtureHome+"/steamapps", "Missing", before); err == nil {
+		t.Errorf("AppNewerThan for a missing install dir did not fail")
+	}
+}
@@ -0,0 +1,422 @@
+// Functions etc for checking that the files of a Steam installation are
+// consistent with each other.
+
+package steamfiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// An FsckCheck says which of Fsck’s checks a finding comes from.  Like
+// OrphanKind, the values are short, stable strings.
+//
+type FsckCheck string
+
+const (
+	// Every VDF file parses, without odd whitespace.
+	FsckVDF FsckCheck = "vdf"
+	// Every appmanifest_<AppNum>.acf file has the entries Steam needs.
+	FsckManifest FsckCheck = "manifest"
+	// Every manifest’s "appid" matches its file name.
+	FsckAppID FsckCheck = "appid"
+	// No app has manifests in more than one library.
+	FsckDuplicate FsckCheck = "duplicate"
+	// Every manifest’s "StateFlags" make sense.
+	FsckStateFlags FsckCheck = "stateflags"
+	// Every manifest’s "installdir" exists (perhaps after correcting case).
+	FsckInstallDir FsckCheck = "installdir"
+	// No install directory is empty.
+	FsckEmptyDir FsckCheck = "emptydir"
+	// The "apps" lists in libraryfolders.vdf match the manifests present.
+	FsckLibraryFolders FsckCheck = "libraryfolders"
+)
+
+// FsckChecks lists all the FsckChecks, in the order Fsck reports them.
+//
+var FsckChecks = []FsckCheck{
+	FsckVDF, FsckManifest, FsckAppID, FsckDuplicate, FsckStateFlags,
+	FsckInstallDir, FsckEmptyDir, FsckLibraryFolders}
+
+// An FsckSeverity says how much a finding matters.
+//
+type FsckSeverity string
+
+const (
+	FsckInfo    FsckSeverity = "info"    // Worth knowing, but harmless
+	FsckWarning FsckSeverity = "warning" // Odd, and possibly a problem
+	FsckError   FsckSeverity = "error"   // Steam (or this package) will misbehave
+)
+
+var fsckSeverityRank = map[FsckSeverity]int{FsckInfo: 0, FsckWarning: 1, FsckError: 2}
+
+// AtLeast reports whether a severity is as bad as another or worse.
+//
+func (sev FsckSeverity) AtLeast(other FsckSeverity) bool {
+	return fsckSeverityRank[sev] >= fsckSeverityRank[other]
+}
+
+// ParseFsckSeverity converts "info", "warning" or "error" to an FsckSeverity.
+//
+func ParseFsckSeverity(text string) (FsckSeverity, error) {
+	sev := FsckSeverity(strings.ToLower(text))
+	if _, ok := fsckSeverityRank[sev]; !ok {
+		return "", fmt.Errorf("unknown severity %q (want info, warning or error)",
+			text)
+	}
+	return sev, nil
+}
+
+// An FsckFinding is one thing that Fsck found.
+//
+type FsckFinding struct {
+	Check     FsckCheck    `json:"check"`
+	Severity  FsckSeverity `json:"severity"`
+	Path      string       `json:"path"`            // The file or directory concerned
+	AppNumber AppNum       `json:"appid,omitempty"` // The app concerned, if any
+	Message   string       `json:"message"`
+}
+
+// Fsck checks a Steam installation for inconsistencies, returning what it
+// finds sorted by check (in the order of FsckChecks), then pathname.
+//
+// Unlike LoadInstallation, Fsck carries on past bad files, so it can report
+// all of them.  It reports the odd whitespace that sVDF notices as findings
+// (see sVDF.Warning); callers may want to set sVDF.PrintWarnings to false so
+// that it is not also printed.  Progress reports (via opts) count the
+// manifests checked.  Fsck changes nothing.
+//
+func Fsck(ctx context.Context, opts *ScanOptions) ([]*FsckFinding, error) {
+	return std.Fsck(ctx, opts)
+}
+
+// Fsck is the Scanner method behind the Fsck function.
+//
+func (s *Scanner) Fsck(ctx context.Context, opts *ScanOptions,
+) ([]*FsckFinding, error) {
+	c := &fsckState{s: s}
+	home, libraryDirs, err := s.FindSteamLibraryDirs(func(slf string, err error) {
+		c.add(FsckLibraryFolders, FsckWarning, slf, 0,
+			"cannot use Steam library folder: %s", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The installation-wide VDF files.  Of these, only
+	// steamapps/libraryfolders.vdf has to exist.
+	var libraryFoldersFiles []*sVDF.File
+	for _, f := range []struct {
+		path     string
+		topNames []string
+	}{
+		{filepath.Join(home, "steamapps", "libraryfolders.vdf"),
+			[]string{"LibraryFolders", "libraryfolders"}},
+		{filepath.Join(home, "config", "libraryfolders.vdf"),
+			[]string{"LibraryFolders", "libraryfolders"}},
+		{filepath.Join(home, "config", "config.vdf"),
+			[]string{"InstallConfigStore"}},
+		{filepath.Join(home, "config", "loginusers.vdf"),
+			[]string{"users"}},
+	} {
+		if _, err := s.fsys.Stat(f.path); err != nil && os.IsNotExist(err) {
+			continue
+		}
+		info := c.parseVDF(f.path, f.topNames...)
+		if info != nil && strings.HasSuffix(f.path, "libraryfolders.vdf") {
+			libraryFoldersFiles = append(libraryFoldersFiles, info)
+		}
+	}
+
+	// The manifests, and the apps they describe.
+	scan := newScanState(ctx, opts)
+	manifestsIn := make(map[string][]*InstalledApp)
+	librariesOf := make(map[AppNum][]string)
+	for _, dir := range libraryDirs {
+		apps, err := c.checkManifests(scan, dir)
+		if err != nil {
+			return nil, err
+		}
+		manifestsIn[dir] = apps
+		for _, app := range apps {
+			librariesOf[app.AppNumber] = append(librariesOf[app.AppNumber], dir)
+		}
+	}
+	for appNum, dirs := range librariesOf {
+		if len(dirs) < 2 {
+			continue
+		}
+		for _, dir := range dirs {
+			c.add(FsckDuplicate, FsckWarning, manifestPath(dir, appNum), appNum,
+				"app also has a manifest in %s", strings.Join(otherThan(dirs, dir), ", "))
+		}
+	}
+
+	// The "apps" lists in libraryfolders.vdf.
+	for _, info := range libraryFoldersFiles {
+		c.checkAppsLists(info, home, libraryDirs, manifestsIn)
+	}
+
+	if err := scan.ctx.Err(); err != nil {
+		return nil, err
+	}
+	order := make(map[FsckCheck]int)
+	for i, check := range FsckChecks {
+		order[check] = i
+	}
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		a, b := c.findings[i], c.findings[j]
+		if a.Check != b.Check {
+			return order[a.Check] < order[b.Check]
+		}
+		return a.Path < b.Path
+	})
+	return c.findings, nil
+}
+
+// fsckState holds what Fsck has found so far.
+//
+type fsckState struct {
+	s        *Scanner
+	findings []*FsckFinding
+}
+
+func (c *fsckState) add(check FsckCheck, sev FsckSeverity, path string,
+	appNum AppNum, format string, args ...interface{},
+) {
+	c.findings = append(c.findings, &FsckFinding{
+		Check: check, Severity: sev, Path: path, AppNumber: appNum,
+		Message: fmt.Sprintf(format, args...)})
+}
+
+// parseVDF parses a VDF file, recording any error or odd whitespace, and
+// returns nil if it cannot be parsed.
+//
+func (c *fsckState) parseVDF(path string, topNames ...string) *sVDF.File {
+	info, err := sVDF.FromFS(c.s.fsys, path, topNames...)
+	if err != nil {
+		c.add(FsckVDF, FsckError, path, 0, "%s", err)
+		return nil
+	}
+	for _, w := range info.Warnings {
+		c.add(FsckVDF, FsckWarning, path, 0, "line %d: odd whitespace: %s",
+			w.LineNumber, w.Diagnostic)
+	}
+	return info
+}
+
+// manifestPath returns the pathname of an app’s manifest in a library.
+//
+func manifestPath(steamLibDir string, appNum AppNum) string {
+	return filepath.Join(steamLibDir,
+		"appmanifest_"+strconv.Itoa(int(appNum))+".acf")
+}
+
+// otherThan returns the items of a list other than s.
+//
+func otherThan(list []string, s string) []string {
+	var ret []string
+	for _, item := range list {
+		if item != s {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// checkManifests checks the manifests and appworkshop_<AppNum>.acf files in a
+// library, and the apps’ install directories, returning the apps whose
+// manifests could be used.
+//
+func (c *fsckState) checkManifests(scan *scanState, steamLibDir string,
+) ([]*InstalledApp, error) {
+	names, err := c.s.readDirNames(steamLibDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var apps []*InstalledApp
+	for _, name := range names {
+		match := reManifestFile.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		path := filepath.Join(steamLibDir, name)
+		info := c.parseVDF(path, "AppState")
+		if info == nil {
+			continue
+		}
+		app, err := manifestFromVDF(info)
+		if err != nil {
+			c.add(FsckManifest, FsckError, path, 0, "%s", err)
+			continue
+		}
+		if strconv.Itoa(int(app.AppNumber)) != match[1] {
+			c.add(FsckAppID, FsckError, path, app.AppNumber,
+				"appid %d does not match the file name", app.AppNumber)
+			continue
+		}
+		app.LibraryFolders = []string{steamLibDir}
+		apps = append(apps, app)
+	}
+
+	if names, err := c.s.readDirNames(filepath.Join(steamLibDir, "workshop")); err == nil {
+		sort.Strings(names)
+		for _, name := range names {
+			if reAppWorkshopFile.MatchString(name) {
+				c.parseVDF(filepath.Join(steamLibDir, "workshop", name), "AppWorkshop")
+			}
+		}
+	}
+
+	// The install directories are checked concurrently, since emptiness
+	// can mean looking through a large tree.
+	findings := make([][]*FsckFinding, len(apps))
+	err = scan.forEach(len(apps), func(i int) {
+		sub := &fsckState{s: c.s}
+		sub.checkApp(apps[i], manifestPath(steamLibDir, apps[i].AppNumber))
+		findings[i] = sub.findings
+		scan.visited(1, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		c.findings = append(c.findings, f...)
+	}
+	return apps, nil
+}
+
+// errNotEmpty stops checkApp’s search for files once it finds one.
+//
+var errNotEmpty = errors.New("not empty")
+
+// checkApp checks an app’s StateFlags and install directory.
+//
+func (c *fsckState) checkApp(app *InstalledApp, mfPath string) {
+	flags, appNum := app.StateFlags, app.AppNumber
+	var known AppStateFlags
+	for _, sn := range appStateNames {
+		known |= sn.flag
+	}
+
+	switch {
+	case flags == 0:
+		c.add(FsckStateFlags, FsckWarning, mfPath, appNum,
+			"no StateFlags (or StateFlags 0)")
+	case flags&^known != 0:
+		c.add(FsckStateFlags, FsckWarning, mfPath, appNum,
+			"unknown StateFlags bits in %s", flags)
+	}
+	if flags.Has(AppStateUninstalled) && flags.Has(AppStateFullyInstalled) {
+		c.add(FsckStateFlags, FsckError, mfPath, appNum,
+			"StateFlags %s say both uninstalled and fully installed", flags)
+	}
+	if flags&(AppStateFilesMissing|AppStateFilesCorrupt) != 0 {
+		c.add(FsckStateFlags, FsckError, mfPath, appNum,
+			"StateFlags %s say files are missing or corrupt; verify the app in Steam",
+			flags)
+	}
+	if app.UpdatePending() {
+		c.add(FsckStateFlags, FsckInfo, mfPath, appNum,
+			"update pending (StateFlags %s)", flags)
+	}
+
+	installed := flags.Has(AppStateFullyInstalled)
+	sev := FsckWarning
+	if installed {
+		sev = FsckError
+	}
+	steamLibDir := app.LibraryFolders[0]
+	appDir, err := c.s.findAppDir(steamLibDir, app.InstallDir)
+	if err != nil {
+		c.add(FsckInstallDir, sev, mfPath, appNum,
+			"cannot find installdir %q: %s", app.InstallDir, err)
+		return
+	}
+	if filepath.Base(appDir) != app.InstallDir {
+		c.add(FsckInstallDir, FsckInfo, appDir, appNum,
+			"installdir is %q, which only matches ignoring case", app.InstallDir)
+	}
+	err = c.s.walkTree(appDir, func(path string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			return errNotEmpty
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		if app.SizeOnDisk == 0 {
+			sev = FsckWarning
+		}
+		c.add(FsckEmptyDir, sev, appDir, appNum, "install directory has no files")
+	case err != errNotEmpty:
+		c.add(FsckInstallDir, FsckError, appDir, appNum, "%s", err)
+	}
+}
+
+// checkAppsLists compares the "apps" lists in a libraryfolders.vdf file in the
+// newer format with the manifests in each library.  Steam updates these lists
+// lazily, so differences are only warnings.
+//
+func (c *fsckState) checkAppsLists(info *sVDF.File, home string,
+	libraryDirs []string, manifestsIn map[string][]*InstalledApp,
+) {
+	top, ok := info.TopValue.(sVDF.NamesValuesList)
+	if !ok {
+		return
+	}
+	mounts := c.s.driveMounts(home, info)
+	for _, key := range top.Names() {
+		slf, ok := top[key].(sVDF.NamesValuesList)
+		if !ok {
+			continue
+		}
+		slfPath, _ := slf["path"].(string)
+		listed, ok := slf["apps"].(sVDF.NamesValuesList)
+		if slfPath == "" || !ok {
+			continue
+		}
+		local, err := c.s.localPath(slfPath, mounts)
+		if err != nil {
+			continue
+		}
+		var dir string
+		for _, d := range libraryDirs {
+			if c.s.sameDir(d, filepath.Join(local, "steamapps")) {
+				dir = d
+			}
+		}
+		if dir == "" {
+			continue
+		}
+		present := make(map[string]bool)
+		for _, app := range manifestsIn[dir] {
+			text := strconv.Itoa(int(app.AppNumber))
+			present[text] = true
+			if _, ok := listed[text]; !ok {
+				c.add(FsckLibraryFolders, FsckWarning, info.Path, app.AppNumber,
+					"entry %q does not list app %d, which has a manifest in %s",
+					key, app.AppNumber, dir)
+			}
+		}
+		for _, text := range listed.Names() {
+			if present[text] {
+				continue
+			}
+			appNum, _ := strconv.Atoi(text)
+			c.add(FsckLibraryFolders, FsckWarning, info.Path, AppNum(appNum),
+				"entry %q lists app %s, but %s has no manifest for it",
+				key, text, dir)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package steamfiles_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/c12h/steam-stuff/sVDF"
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+const (
+	fsckHomeLib  = "home/me/.steam/steam/steamapps/"
+	fsckOtherLib = "media/games/steamapps/"
+)
+
+// fsckFixture returns a consistent installation with app 10 in the initial
+// library and app 20 in /media/games, after applying change (if not nil) to
+// app 10, for one of TestFsck’s cases to break.
+//
+func fsckFixture(t *testing.T, change func(a *steamtest.App)) fstest.MapFS {
+	t.Helper()
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	ten := h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games").AddApp(20, "Twenty", "Twenty").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	if change != nil {
+		change(ten)
+	}
+	return h.MapFS(t)
+}
+
+// An fsckWant is a finding that TestFsck expects.
+//
+type fsckWant struct {
+	check    steamfiles.FsckCheck
+	severity steamfiles.FsckSeverity
+	app      steamfiles.AppNum
+}
+
+func TestFsck(t *testing.T) {
+	defer func(prev bool) { sVDF.PrintWarnings = prev }(sVDF.PrintWarnings)
+	sVDF.PrintWarnings = false
+	manifest10 := fsckHomeLib + "appmanifest_10.acf"
+
+	for _, tc := range []struct {
+		name   string
+		change func(a *steamtest.App)  // Changes to app 10
+		damage func(fsys fstest.MapFS) // Changes to its files
+		want   []fsckWant
+	}{
+		{"consistent", nil, nil, nil},
+		{"unparsable VDF", nil, func(fsys fstest.MapFS) {
+			fsys[manifest10].Data = []byte(`"AppState" {`)
+		}, []fsckWant{{steamfiles.FsckVDF, steamfiles.FsckError, 0},
+			{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 10}}},
+		{"odd whitespace", nil, func(fsys fstest.MapFS) {
+			f := fsys[manifest10]
+			f.Data = []byte(strings.Replace(string(f.Data), "\t\t", " ", 1))
+		}, []fsckWant{{steamfiles.FsckVDF, steamfiles.FsckWarning, 0}}},
+		{"manifest without installdir", nil, func(fsys fstest.MapFS) {
+			f := fsys[manifest10]
+			f.Data = []byte(strings.Replace(string(f.Data), `"installdir"`,
+				`"installdirectory"`, 1))
+		}, []fsckWant{{steamfiles.FsckManifest, steamfiles.FsckError, 0},
+			{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 10}}},
+		{"appid does not match the file name", nil, func(fsys fstest.MapFS) {
+			fsys[fsckHomeLib+"appmanifest_11.acf"] = fsys[manifest10]
+		}, []fsckWant{{steamfiles.FsckAppID, steamfiles.FsckError, 10}}},
+		{"duplicate manifests", nil, func(fsys fstest.MapFS) {
+			fsys[fsckOtherLib+"appmanifest_10.acf"] = fsys[manifest10]
+			fsys[fsckOtherLib+"common/Ten/game"] =
+				fsys[fsckHomeLib+"common/Ten/game"]
+		}, []fsckWant{{steamfiles.FsckDuplicate, steamfiles.FsckWarning, 10},
+			{steamfiles.FsckDuplicate, steamfiles.FsckWarning, 10},
+			{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 10}}},
+		{"no StateFlags", func(a *steamtest.App) {
+			a.SetField("StateFlags", "0")
+		}, nil, []fsckWant{{steamfiles.FsckStateFlags, steamfiles.FsckWarning, 10}}},
+		{"unknown StateFlags", func(a *steamtest.App) {
+			a.SetField("StateFlags", "8196")
+		}, nil, []fsckWant{{steamfiles.FsckStateFlags, steamfiles.FsckWarning, 10}}},
+		{"uninstalled and fully installed", func(a *steamtest.App) {
+			a.SetField("StateFlags", "5")
+		}, nil, []fsckWant{{steamfiles.FsckStateFlags, steamfiles.FsckError, 10}}},
+		{"files missing", func(a *steamtest.App) {
+			a.SetField("StateFlags", "36")
+		}, nil, []fsckWant{{steamfiles.FsckStateFlags, steamfiles.FsckError, 10}}},
+		{"update pending", func(a *steamtest.App) {
+			a.SetField("StateFlags", "6")
+		}, nil, []fsckWant{{steamfiles.FsckStateFlags, steamfiles.FsckInfo, 10}}},
+		{"missing installdir", nil, func(fsys fstest.MapFS) {
+			delete(fsys, fsckHomeLib+"common/Ten/game")
+			delete(fsys, fsckHomeLib+"common/Ten")
+		}, []fsckWant{{steamfiles.FsckInstallDir, steamfiles.FsckError, 10}}},
+		{"missing installdir, not fully installed", func(a *steamtest.App) {
+			a.SetField("StateFlags", "1")
+		}, func(fsys fstest.MapFS) {
+			delete(fsys, fsckHomeLib+"common/Ten/game")
+			delete(fsys, fsckHomeLib+"common/Ten")
+		}, []fsckWant{{steamfiles.FsckInstallDir, steamfiles.FsckWarning, 10}}},
+		{"installdir in the wrong case", func(a *steamtest.App) {
+			a.InstallDir = "TEN"
+		}, func(fsys fstest.MapFS) {
+			fsys[fsckHomeLib+"common/Ten/game"] = fsys[fsckHomeLib+"common/TEN/game"]
+			delete(fsys, fsckHomeLib+"common/TEN/game")
+			delete(fsys, fsckHomeLib+"common/TEN")
+		}, []fsckWant{{steamfiles.FsckInstallDir, steamfiles.FsckInfo, 10}}},
+		{"empty install dir", nil, func(fsys fstest.MapFS) {
+			delete(fsys, fsckHomeLib+"common/Ten/game")
+		}, []fsckWant{{steamfiles.FsckEmptyDir, steamfiles.FsckError, 10}}},
+		{"empty install dir, SizeOnDisk 0", func(a *steamtest.App) {
+			a.SetField("SizeOnDisk", "0")
+		}, func(fsys fstest.MapFS) {
+			delete(fsys, fsckHomeLib+"common/Ten/game")
+		}, []fsckWant{{steamfiles.FsckEmptyDir, steamfiles.FsckWarning, 10}}},
+		{"apps list lacks an app", nil, func(fsys fstest.MapFS) {
+			fsys[fsckOtherLib+"appmanifest_10.acf"] = fsys[manifest10]
+			fsys[fsckOtherLib+"common/Ten/game"] =
+				fsys[fsckHomeLib+"common/Ten/game"]
+			delete(fsys, manifest10)
+		}, []fsckWant{{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 10},
+			{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 10}}},
+		{"apps list has an extra app", nil, func(fsys fstest.MapFS) {
+			delete(fsys, fsckOtherLib+"appmanifest_20.acf")
+		}, []fsckWant{{steamfiles.FsckLibraryFolders, steamfiles.FsckWarning, 20}}},
+	} {
+		fsys := fsckFixture(t, tc.change)
+		if tc.damage != nil {
+			tc.damage(fsys)
+		}
+		s := steamfiles.NewScanner(steamfiles.FromFS(fsys))
+		s.SteamHomeOverride = "/home/me/.steam/steam"
+		findings, err := s.Fsck(context.Background(), nil)
+		if err != nil {
+			t.Errorf("%s: Fsck: %s", tc.name, err)
+			continue
+		}
+		ok := len(findings) == len(tc.want)
+		for i := 0; ok && i < len(findings); i++ {
+			f, w := findings[i], tc.want[i]
+			ok = f.Check == w.check && f.Severity == w.severity && f.AppNumber == w.app
+		}
+		if !ok {
+			var got []string
+			for _, f := range findings {
+				got = append(got, string(f.Check)+"/"+string(f.Severity)+": "+
+					f.Path+": "+f.Message)
+			}
+			t.Errorf("%s: Fsck found %q, want %v", tc.name, got, tc.want)
+		}
+	}
+}
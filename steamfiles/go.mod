@@ -1,8 +1,10 @@
 module github.com/c12h/steam-stuff/steamfiles
 
-go 1.15
+go 1.16
 
 require (
 	github.com/c12h/errs v0.0.0-20210124123617-2034366c58f2
 	github.com/c12h/steam-stuff/sVDF v0.0.0-20210129084345-3b2a2d55e86f
 )
+
+replace github.com/c12h/steam-stuff/sVDF => ../sVDF
@@ -0,0 +1,83 @@
+package steamfiles_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+)
+
+// The tests in package steamfiles_test build their installations with package
+// steamtest, which imports steamfiles.  Those using Install(t) change
+// steamfiles.SteamHomeOverride, so they must not run in parallel.
+
+// load loads the installed synthetic installation, failing the test if it
+// cannot.
+//
+func load(t *testing.T, opts *steamfiles.LoadOptions) *steamfiles.Installation {
+	t.Helper()
+	inst, err := steamfiles.LoadInstallation(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("LoadInstallation: %s", err)
+	}
+	return inst
+}
+
+// exists reports whether a file or directory exists, without following
+// symlinks.
+//
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// symlink makes a symlink, failing the test if it cannot.
+//
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns a file’s contents, failing the test if it cannot.
+//
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return string(data)
+}
+
+// setEnv sets an environment variable until the test finishes; an empty value
+// unsets it.
+//
+func setEnv(t *testing.T, name, value string) {
+	prev, had := os.LookupEnv(name)
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(name, prev)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// useTrash makes MoveToTrash use a temporary home trash until the test
+// finishes, and returns it.
+//
+func useTrash(t *testing.T) string {
+	t.Helper()
+	dataHome := t.TempDir()
+	setEnv(t, "XDG_DATA_HOME", dataHome)
+	return filepath.Join(dataHome, "Trash")
+}
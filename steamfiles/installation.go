@@ -0,0 +1,392 @@
+// The Installation type, which gathers everything this package can find out
+// about a Steam installation.
+
+package steamfiles
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// An Installation holds the library folders, installed apps (with their
+// Workshop content), backups and users of a Steam installation, loaded once by
+// LoadInstallation, with indexes and cross-references between them.
+//
+// An Installation is a snapshot: it does not notice later changes to the
+// files.  Its methods are safe for concurrent use as long as nothing modifies
+// it; AddBackupsDir does modify it.
+//
+type Installation struct {
+	Home        string                // The Steam home directory
+	Libraries   []*Library            // The Steam library directories scanned
+	Apps        InstalledAppForAppNum // Each installed app, as ScanSteamLibDir records it
+	Workshops   AppWorkshopForAppNum  // Installed apps’ Workshop content
+	Offline     []*Library            // Libraries that could not be scanned, from the cache
+	BackupsDirs []string              // The backup directories scanned
+	AllBackups  []*AppBackup          // Every backup found, in the order found
+	Backups     AppBackupForAppNum    // The preferred backup for each app
+	Users       []*User               // The installation’s users, sorted by ID
+
+	scanner        *Scanner
+	libraryForPath map[string]*Library
+	backupsForApp  map[AppNum][]*AppBackup
+}
+
+// A Library is one Steam library directory (the "steamapps" directory of a
+// Steam Library Folder) in an Installation.
+//
+type Library struct {
+	Path      string          // The pathname of the "steamapps" directory
+	IsHome    bool            // Whether this is the one in the Steam home directory
+	Apps      []*InstalledApp // The apps with a manifest here, sorted by AppNum
+	Workshops []*AppWorkshop  // The Workshop manifests here, sorted by AppNum
+	Offline   bool            // Whether Apps etc come from a cached LibrarySnapshot
+	Scanned   time.Time       // When Apps etc were read from the library
+}
+
+// LoadOptions controls what LoadInstallation loads, and how.  A nil
+// *LoadOptions means use the defaults.
+//
+type LoadOptions struct {
+	// LibraryDirs lists the Steam library directories to scan.  The
+	// default is all of them, as found by FindSteamLibraryDirs.
+	LibraryDirs []string
+	// SkipHomeLibrary says to skip the Steam home directory’s library.
+	SkipHomeLibrary bool
+	// BackupsDirs lists the directories to look for backups in.  The
+	// default is <SteamHome>/Backups, if it exists.
+	BackupsDirs []string
+	// NoBackups says not to look for backups at all (callers can use
+	// AddBackupsDir later).
+	NoBackups bool
+	// CacheDir is a directory (such as DefaultCacheDir()) to save a
+	// LibrarySnapshot of each library in when it is scanned.  Libraries
+	// that FindSteamLibraryDirs reports as bad (fx, because their drive is
+	// not mounted) are then loaded from there, into Installation.Offline.
+	// The cache is best-effort: problems reading or writing it go to
+	// ReportProblem.  The default is not to cache anything.
+	CacheDir string
+
+	ReportBadLibrary BadSteamLibraryDirReporter // Passed to FindSteamLibraryDirs
+	HandleDiff       OldManifestReporter        // Passed to ScanSteamLibDir
+	HandleDupe       DupeBackupHandler          // Passed to ScanBackupsDir
+	ReportProblem    LoadProblemReporter        // See LoadProblemReporter
+	Scan             *ScanOptions               // Used for all the scanning
+}
+
+// A LoadProblemReporter is a callback that LoadInstallation uses to report
+// problems with optional extras, such as a Workshop manifest it cannot parse
+// or a cache directory it cannot write to, that it works around instead of
+// failing.  The default is to silently ignore them.
+//
+type LoadProblemReporter func(err error)
+
+// LoadInstallation finds the current user’s Steam installation (see
+// FindSteamHome) and loads everything about it: its libraries and the apps
+// installed in them, its backups and its users.
+//
+// Unlike ScanSteamLibDir, LoadInstallation does not complain about library
+// directories with no apps in them, since a new Steam Library Folder is empty.
+// It does complain about a backups directory with no backups, unless that
+// directory is the default one.
+//
+func LoadInstallation(ctx context.Context, opts *LoadOptions) (*Installation, error) {
+	return std.LoadInstallation(ctx, opts)
+}
+
+// LoadInstallation is the Scanner method behind the LoadInstallation function.
+//
+func (s *Scanner) LoadInstallation(ctx context.Context, opts *LoadOptions,
+) (*Installation, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	reportProblem := opts.ReportProblem
+	if reportProblem == nil {
+		reportProblem = func(error) {}
+	}
+	var badSLFs []string
+	home, libraryDirs, err := s.FindSteamLibraryDirs(func(slf string, err error) {
+		badSLFs = append(badSLFs, slf)
+		if opts.ReportBadLibrary != nil {
+			opts.ReportBadLibrary(slf, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	homeLibraryDir := libraryDirs[0]
+	if opts.LibraryDirs != nil {
+		libraryDirs = opts.LibraryDirs
+	}
+
+	inst := &Installation{
+		Home:           home,
+		Apps:           make(InstalledAppForAppNum),
+		Workshops:      make(AppWorkshopForAppNum),
+		Backups:        make(AppBackupForAppNum),
+		scanner:        s,
+		libraryForPath: make(map[string]*Library),
+		backupsForApp:  make(map[AppNum][]*AppBackup),
+	}
+
+	// Libraries and apps.
+	manifestsIn := make(map[*Library][]*InstalledApp)
+	for _, dir := range libraryDirs {
+		lib := &Library{Path: dir, IsHome: s.sameDir(dir, homeLibraryDir)}
+		if lib.IsHome && opts.SkipHomeLibrary {
+			continue
+		}
+		if inst.Library(dir) != nil {
+			continue
+		}
+		lib.Scanned = time.Now()
+		apps, err := s.readManifests(ctx, dir, opts.Scan)
+		if err != nil {
+			return nil, err
+		}
+		mergeInstalledApps(inst.Apps, dir, apps, opts.HandleDiff)
+		manifestsIn[lib] = apps
+		lib.Workshops, err = s.readAppWorkshops(dir, reportProblem)
+		if err != nil {
+			return nil, err
+		}
+		if opts.CacheDir != "" {
+			sortApps(apps)
+			err := WriteLibrarySnapshot(opts.CacheDir, &LibrarySnapshot{
+				Path: dir, Scanned: lib.Scanned,
+				Apps: apps, Workshops: lib.Workshops})
+			if err != nil {
+				reportProblem(err)
+			}
+		}
+		inst.Libraries = append(inst.Libraries, lib)
+		inst.libraryForPath[filepath.Clean(dir)] = lib
+	}
+	for _, lib := range inst.Libraries {
+		for _, app := range manifestsIn[lib] {
+			lib.Apps = append(lib.Apps, inst.Apps[app.AppNumber])
+		}
+		sortApps(lib.Apps)
+	}
+	for _, lib := range inst.Libraries {
+		for _, w := range lib.Workshops {
+			app, ok := inst.Apps[w.AppNumber]
+			if ok && lib.Path == app.LibraryFolders[0] {
+				inst.Workshops[w.AppNumber] = w
+			}
+		}
+	}
+
+	// Libraries that are missing, as they were when last scanned.
+	if opts.CacheDir != "" {
+		for _, slf := range badSLFs {
+			dir := filepath.Join(slf, "steamapps")
+			snap, err := ReadLibrarySnapshot(opts.CacheDir, dir)
+			if err != nil {
+				reportProblem(err)
+				continue
+			} else if snap == nil {
+				continue
+			}
+			inst.Offline = append(inst.Offline, &Library{
+				Path: dir, Apps: snap.Apps, Workshops: snap.Workshops,
+				Offline: true, Scanned: snap.Scanned})
+		}
+	}
+
+	// Backups.
+	if !opts.NoBackups {
+		backupsDirs, isDefault := opts.BackupsDirs, false
+		if backupsDirs == nil {
+			if dir, err := s.DirectoryExists(home, "Backups"); err == nil {
+				backupsDirs, isDefault = []string{dir}, true
+			}
+		}
+		for _, dir := range s.UniqueDirs(backupsDirs) {
+			err := inst.addBackupsDir(ctx, dir, opts.HandleDupe, opts.Scan,
+				isDefault)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Users.
+	inst.Users, err = s.FindUsers(home)
+	if err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// AddBackupsDir scans another directory for backups, adding them to the
+// Installation as LoadInstallation would have.  This lets callers whose
+// DupeBackupHandler wants to look at the installed apps load those first.
+// Adding a directory already scanned (by whatever route) does nothing.
+//
+func (inst *Installation) AddBackupsDir(ctx context.Context,
+	backupsDirPath string, handleDupe DupeBackupHandler, opts *ScanOptions,
+) error {
+	return inst.addBackupsDir(ctx, backupsDirPath, handleDupe, opts, false)
+}
+
+func (inst *Installation) addBackupsDir(ctx context.Context,
+	backupsDirPath string, handleDupe DupeBackupHandler, opts *ScanOptions,
+	emptyOK bool,
+) error {
+	for _, dir := range inst.BackupsDirs {
+		if inst.scanner.sameDir(dir, backupsDirPath) {
+			return nil
+		}
+	}
+	backups, err := inst.scanner.readBackups(ctx, backupsDirPath, opts)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 && !emptyOK {
+		return cannot("find any Steam backups in", "directory",
+			backupsDirPath, nil)
+	}
+	mergeBackups(inst.Backups, backups, handleDupe)
+	inst.BackupsDirs = append(inst.BackupsDirs, backupsDirPath)
+	inst.AllBackups = append(inst.AllBackups, backups...)
+	for _, b := range backups {
+		for _, appNum := range b.AppNumbers {
+			inst.backupsForApp[appNum] = append(inst.backupsForApp[appNum], b)
+		}
+	}
+	return nil
+}
+
+/*--------------------------------- Indexes ----------------------------------*/
+
+// SortedApps returns the installed apps, sorted by AppNum.
+//
+func (inst *Installation) SortedApps() []*InstalledApp {
+	ret := make([]*InstalledApp, 0, len(inst.Apps))
+	for _, app := range inst.Apps {
+		ret = append(ret, app)
+	}
+	sortApps(ret)
+	return ret
+}
+
+// AppsInState returns the installed apps whose StateFlags include all of the
+// given flags, sorted by AppNum.  For example,
+//	inst.AppsInState(AppStateUpdateRequired)
+// lists the apps that Steam wants to update.
+//
+func (inst *Installation) AppsInState(flags AppStateFlags) []*InstalledApp {
+	var ret []*InstalledApp
+	for _, app := range inst.SortedApps() {
+		if app.StateFlags.Has(flags) {
+			ret = append(ret, app)
+		}
+	}
+	return ret
+}
+
+// Library returns the Library with the given "steamapps" pathname, or one
+// reached by a different route (symlinks or bind mounts), or nil.
+//
+func (inst *Installation) Library(path string) *Library {
+	if lib, ok := inst.libraryForPath[filepath.Clean(path)]; ok {
+		return lib
+	}
+	for _, lib := range inst.Libraries {
+		if inst.scanner.sameDir(lib.Path, path) {
+			return lib
+		}
+	}
+	return nil
+}
+
+// LibraryOf returns the Library an installed app is used from, or nil if the
+// app is not from this Installation.
+//
+func (inst *Installation) LibraryOf(app *InstalledApp) *Library {
+	if len(app.LibraryFolders) == 0 {
+		return nil
+	}
+	return inst.Library(app.LibraryFolders[0])
+}
+
+// BackupsOf returns every backup holding an app, in the order found (so the
+// preferred one, inst.Backups[appNum], is not necessarily first).
+//
+func (inst *Installation) BackupsOf(appNum AppNum) []*AppBackup {
+	return inst.backupsForApp[appNum]
+}
+
+// BackupsDirOf returns which of inst.BackupsDirs a backup was found in, or ""
+// if it is not in any of them.
+//
+func (inst *Installation) BackupsDirOf(b *AppBackup) string {
+	parent := filepath.Dir(b.BackupPath)
+	for _, dir := range inst.BackupsDirs {
+		if filepath.Clean(dir) == parent {
+			return dir
+		}
+	}
+	return ""
+}
+
+// AppsIn returns the installed apps that a backup holds, skipping any of its
+// apps that are not installed.
+//
+func (inst *Installation) AppsIn(b *AppBackup) []*InstalledApp {
+	var ret []*InstalledApp
+	for _, appNum := range b.AppNumbers {
+		if app, ok := inst.Apps[appNum]; ok {
+			ret = append(ret, app)
+		}
+	}
+	return ret
+}
+
+// AppsWithoutBackup returns the installed apps that have no backup, sorted by
+// AppNum.
+//
+func (inst *Installation) AppsWithoutBackup() []*InstalledApp {
+	var ret []*InstalledApp
+	for _, app := range inst.SortedApps() {
+		if _, ok := inst.Backups[app.AppNumber]; !ok {
+			ret = append(ret, app)
+		}
+	}
+	return ret
+}
+
+// UninstalledBackups returns the AppNums of apps that have a backup but are
+// not installed, sorted.
+//
+func (inst *Installation) UninstalledBackups() []AppNum {
+	var ret []AppNum
+	for appNum := range inst.Backups {
+		if _, ok := inst.Apps[appNum]; !ok {
+			ret = append(ret, appNum)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// User returns the user with a given account number, or nil.
+//
+func (inst *Installation) User(id uint32) *User {
+	for _, u := range inst.Users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func sortApps(apps []*InstalledApp) {
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].AppNumber < apps[j].AppNumber
+	})
+}
@@ -0,0 +1,89 @@
+// Functions etc for caching what Steam libraries hold, so that programs can
+// still report on libraries whose drives are not mounted.
+
+package steamfiles
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A LibrarySnapshot records what a Steam library held when LoadInstallation
+// last scanned it (see LoadOptions.CacheDir).
+//
+type LibrarySnapshot struct {
+	Path      string          `json:"path"`    // The "steamapps" directory
+	Scanned   time.Time       `json:"scanned"` // When it was scanned
+	Apps      []*InstalledApp `json:"apps"`    // Its manifests, sorted by AppNum
+	Workshops []*AppWorkshop  `json:"workshops"`
+}
+
+// DefaultCacheDir returns the directory where programs should cache library
+// snapshots unless told otherwise: steamfiles/libraries in the user’s cache
+// directory (fx, ~/.cache/steamfiles/libraries).
+//
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", cannotFind("a cache directory", err)
+	}
+	return filepath.Join(dir, "steamfiles", "libraries"), nil
+}
+
+// snapshotPath returns the file in a cache directory that holds the snapshot
+// of a library.  The name is a hash of the library’s pathname, which the file
+// also records.
+//
+func snapshotPath(cacheDir, steamLibDir string) string {
+	sum := sha1.Sum([]byte(filepath.Clean(steamLibDir)))
+	return filepath.Join(cacheDir, "library-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// WriteLibrarySnapshot saves a snapshot of a library in a cache directory,
+// creating that if need be and replacing any older snapshot of the library.
+// Unlike most of this package’s functions, it uses the real file system.
+//
+func WriteLibrarySnapshot(cacheDir string, snap *LibrarySnapshot) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return cannot("create", "cache directory", cacheDir, err)
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return cannot("encode", "snapshot of library", snap.Path, err)
+	}
+	return writeFileAtomically(snapshotPath(cacheDir, snap.Path), data)
+}
+
+// ReadLibrarySnapshot returns the snapshot of a library saved in a cache
+// directory, or nil if there is none.  Each app’s LibraryFolders is just the
+// library.  Like WriteLibrarySnapshot, it uses the real file system.
+//
+func ReadLibrarySnapshot(cacheDir, steamLibDir string) (*LibrarySnapshot, error) {
+	path := snapshotPath(cacheDir, steamLibDir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, cannot("read", "library snapshot", path, err)
+	}
+	snap := &LibrarySnapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, cannot("decode", "library snapshot", path, err)
+	}
+	if filepath.Clean(snap.Path) != filepath.Clean(steamLibDir) {
+		return nil, fileError(path, "path",
+			"snapshot is for %q, not %q", snap.Path, steamLibDir)
+	}
+	for _, app := range snap.Apps {
+		app.LibraryFolders = []string{steamLibDir}
+	}
+	for _, w := range snap.Workshops {
+		w.Library = steamLibDir
+	}
+	return snap, nil
+}
@@ -1,6 +1,7 @@
 package steamfiles
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -8,11 +9,103 @@ import (
 	"github.com/c12h/steam-stuff/sVDF"
 )
 
+/*------------------------------ FindSteamHome -------------------------------*/
+
+// A SteamHome is a Steam installation found by FindSteamHomes.
+//
+type SteamHome struct {
+	Path    string // The Steam home directory (the initial SLF)
+	FoundBy string // How it was found, eg "$STEAM_DIR" or "~/.steam/steam"
+	Flavour string // "override", "native", "flatpak" or "snap"
+}
+
+// SteamHomeEnvVar is the name of an environment variable which, if set, gives
+// the pathname of the Steam home directory to use.
+//
+const SteamHomeEnvVar = "STEAM_DIR"
+
+// SteamHomeOverride, if not empty, gives the pathname of the Steam home
+// directory to use.  It takes priority over $STEAM_DIR, and is intended for
+// programs which have a configuration setting or command-line option for this.
+//
+var SteamHomeOverride string
+
+// FindSteamHomes returns every Steam installation it can find for the current
+// user, in order of preference.  An installation specified by
+// SteamHomeOverride or $STEAM_DIR comes first; it is an error if that is not a
+// valid Steam home directory.
+//
+// The same installation is often reachable by several paths (eg, ~/.steam/steam
+// is usually a symlink); FindSteamHomes reports each installation once, by the
+// first path it was found by, comparing paths with their symlinks resolved.
+//
+func FindSteamHomes() ([]SteamHome, error) {
+	return std.FindSteamHomes()
+}
+
+// FindSteamHomes is the Scanner method behind the FindSteamHomes function.
+//
+func (s *Scanner) FindSteamHomes() ([]SteamHome, error) {
+	var ret []SteamHome
+	seen := make(map[string]bool)
+	add := func(h SteamHome) {
+		resolved := h.Path
+		if p, err := s.evalSymlinks(h.Path); err == nil {
+			resolved = p
+		}
+		if !seen[resolved] {
+			seen[resolved] = true
+			ret = append(ret, h)
+		}
+	}
+
+	override, foundBy := s.SteamHomeOverride, "override setting"
+	if override == "" {
+		override = SteamHomeOverride
+	}
+	if override == "" {
+		override, foundBy = os.Getenv(SteamHomeEnvVar), "$"+SteamHomeEnvVar
+	}
+	if override != "" {
+		if _, err := s.DirectoryExists(override, "steamapps"); err != nil {
+			return nil, cannotFind(fmt.Sprintf("Steam home %q from %s",
+				override, foundBy), err)
+		}
+		add(SteamHome{Path: override, FoundBy: foundBy, Flavour: "override"})
+	}
+
+	candidates, err := steamHomeCandidates()
+	if err != nil && len(ret) == 0 {
+		return nil, err
+	}
+	for _, h := range candidates {
+		if _, err := s.DirectoryExists(h.Path, "steamapps"); err == nil {
+			add(h)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, cannotFind("any Steam installation", nil)
+	}
+	return ret, nil
+}
+
 // FindSteamHome returns the pathname of the directory where Steam is installed
-// for the current user (or returns an error).
+// for the current user (or returns an error).  If there are several, it
+// returns the first one that FindSteamHomes reports.
 //
 func FindSteamHome() (string, error) {
-	return findSteamHome()
+	return std.FindSteamHome()
+}
+
+// FindSteamHome is the Scanner method behind the FindSteamHome function.
+//
+func (s *Scanner) FindSteamHome() (string, error) {
+	homes, err := s.FindSteamHomes()
+	if err != nil {
+		return "", err
+	}
+	return homes[0].Path, nil
 }
 
 /*--------------------------- FindSteamLibraryDirs ---------------------------*/
@@ -29,13 +122,30 @@ type BadSteamLibraryDirReporter func(slfDir string, err error)
 //
 // The list it returns contains the pathnames of the "steamapps" directory in
 // each Steam Library Folder, not those of the Steam Library Folders themselves.
+// An SLF that libraryfolders.vdf lists twice by different routes (symlinks or
+// bind mounts) is only listed once.
+//
+// For a Windows Steam installation (see DriveMounts), the Windows pathnames in
+// libraryfolders.vdf are mapped to where their drives are mounted.  If the
+// drive holding the Steam home directory is not in DriveMounts, its mount
+// point is worked out from the home directory’s Windows pathname, which the
+// newer format of libraryfolders.vdf gives.  SLFs on drives that cannot be
+// mapped are reported as bad.
 //
 // Callers can supply a callback to report any invalid SLF; the default is to
 // silently ignore
 //
 func FindSteamLibraryDirs(reportBadSLF BadSteamLibraryDirReporter,
 ) (string, []string, error) {
-	SteamDir, err := FindSteamHome()
+	return std.FindSteamLibraryDirs(reportBadSLF)
+}
+
+// FindSteamLibraryDirs is the Scanner method behind the FindSteamLibraryDirs
+// function.
+//
+func (s *Scanner) FindSteamLibraryDirs(reportBadSLF BadSteamLibraryDirReporter,
+) (string, []string, error) {
+	SteamDir, err := s.FindSteamHome()
 	if err != nil {
 		return "", nil, err
 	}
@@ -43,20 +153,19 @@ func FindSteamLibraryDirs(reportBadSLF BadSteamLibraryDirReporter,
 	libraryDirs := []string{filepath.Join(SteamDir, "steamapps")}
 	libraryFoldersFilePath :=
 		filepath.Join(libraryDirs[0], "libraryfolders.vdf")
-	libraryFoldersInfo, err := sVDF.FromFile(libraryFoldersFilePath, "LibraryFolders")
+	libraryFoldersInfo, err := sVDF.FromFS(s.fsys, libraryFoldersFilePath,
+		"LibraryFolders", "libraryfolders")
 	if err != nil {
 		return SteamDir, nil, cannotFind("Steam library folders", err)
 	}
-	for i := 1; ; i += 1 {
-		s := strconv.Itoa(i)
-		if !libraryFoldersInfo.HaveString(s) {
-			break
+	mounts := s.driveMounts(SteamDir, libraryFoldersInfo)
+	for _, slf := range libraryFolderPaths(libraryFoldersInfo) {
+		local, err := s.localPath(slf, mounts)
+		var p string
+		if err == nil {
+			slf = local
+			p, err = s.DirectoryExists(slf, "steamapps")
 		}
-		slf, err := libraryFoldersInfo.Lookup(s)
-		if err != nil {
-			panic(err.Error())
-		}
-		p, err := DirectoryExists(slf, "steamapps")
 		if err != nil {
 			if reportBadSLF != nil {
 				reportBadSLF(slf, err)
@@ -66,7 +175,53 @@ func FindSteamLibraryDirs(reportBadSLF BadSteamLibraryDirReporter,
 		libraryDirs = append(libraryDirs, p)
 	}
 
-	return SteamDir, libraryDirs, nil
+	return SteamDir, s.UniqueDirs(libraryDirs), nil
+}
+
+// libraryFolderPaths gets the SLF pathnames from a libraryfolders.vdf file.
+//
+// Steam has used two formats for this file.  The older one has the pathnames
+// of all SLFs except the initial one as string values:
+//	"LibraryFolders"
+//	{
+//		"TimeNextStatsReport"		"…"
+//		"ContentStatsID"		"…"
+//		"1"		"/media/games/SteamLibrary"
+//	}
+// The newer one (from mid-2021) has an NVL for every SLF, including the
+// initial one, which also lists the apps installed there:
+//	"libraryfolders"
+//	{
+//		"0"
+//		{
+//			"path"		"/home/me/.local/share/Steam"
+//			"apps"
+//			{
+//				"228980"		"123456789"
+//			}
+//		}
+//		"1"
+//		{
+//			"path"		"/media/games/SteamLibrary"
+//			…
+//		}
+//	}
+//
+func libraryFolderPaths(info *sVDF.File) []string {
+	var ret []string
+	for i := 0; ; i += 1 {
+		s := strconv.Itoa(i)
+		if info.HaveString(s) {
+			slf, _ := info.Lookup(s)
+			ret = append(ret, slf)
+		} else if info.HaveString(s, "path") {
+			slf, _ := info.Lookup(s, "path")
+			ret = append(ret, slf)
+		} else if i > 0 {
+			break
+		}
+	}
+	return ret
 }
 
 //
@@ -85,12 +240,18 @@ func FindSteamLibraryDirs(reportBadSLF BadSteamLibraryDirReporter,
 // not, it returns an empty string and an error.
 //
 func DirectoryExists(base string, childNames ...string) (string, error) {
+	return std.DirectoryExists(base, childNames...)
+}
+
+// DirectoryExists is the Scanner method behind the DirectoryExists function.
+//
+func (s *Scanner) DirectoryExists(base string, childNames ...string) (string, error) {
 	p := base
 	for i := -1; i < len(childNames); i++ {
 		if i >= 0 {
 			p = filepath.Join(p, childNames[i])
 		}
-		nodeinfo, err := os.Stat(p)
+		nodeinfo, err := s.fsys.Stat(p)
 		if err != nil {
 			if os.IsNotExist(err) {
 				return "", cannot("find", "", p, notFoundErr)
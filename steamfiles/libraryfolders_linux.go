@@ -3,48 +3,45 @@ package steamfiles
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 )
 
 var notFoundErr = fmt.Errorf("no such entry")
 var notADirErr = syscall.ENOTDIR
 
-// findSteamHome is the system-dependent function that FindSteamHome is a
-// wrapper for.
+// steamHomeCandidates is the system-dependent part of FindSteamHomes.
 //
-// It returns the pathname of the directory where Steam is installed for the
-// current user (or returns an error).
+// It returns the places where Steam might be installed for the current user,
+// in order of preference; FindSteamHomes checks which of them exist.
 //
-func findSteamHome() (string, error) {
-	// First, find the user’s home directory.
-	path, err := os.UserHomeDir()
-	if err != nil {
-		return "", cannotFind("user home directory(!?)", err)
-	}
-
-	// Second, find their .steam directory.
-	path, err = DirectoryExists(path, ".steam")
+// The usual places are "$HOME/.steam/steam" or "$HOME/.steam/root" (normally
+// symlinks to the real directory), "$HOME/.steam/debian-installation" (for the
+// Debian/Ubuntu package) and "$HOME/.local/share/Steam".  Flatpak and Snap
+// installations keep their files under "$HOME/.var/app/…" and "$HOME/snap/…"
+// respectively.  Very old installations used "$HOME/.steam" itself.
+//
+func steamHomeCandidates() ([]SteamHome, error) {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", cannotFind("user’s .steam directory", nil)
-	}
-
-	// Third, look for "$HOME/.steam/steam" or else "$HOME/.steam/root",
-	// and use the first found.  If neither exist, use "$HOME/.steam".
-	homeSLF, err :=
-		DirectoryExists(path, "steam")
-	if homeSLF == "" {
-		homeSLF, err =
-			DirectoryExists(path, "root")
-	}
-	if homeSLF == "" {
-		homeSLF = path
+		return nil, cannotFind("user home directory(!?)", err)
 	}
 
-	// Fourth, check that <homeSLF>/steamapps exists.
-	// If it doesn’t, we don’t have any Steam Library Folder, which is bad.
-	if _, err := DirectoryExists(homeSLF, "steamapps"); err != nil {
-		return "", fmt.Errorf(`%q has no "steamapps" subdirectory (?!)`, homeSLF)
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
 	}
 
-	return homeSLF, nil
+	return []SteamHome{
+		{filepath.Join(home, ".steam", "steam"), "~/.steam/steam", "native"},
+		{filepath.Join(home, ".steam", "root"), "~/.steam/root", "native"},
+		{filepath.Join(home, ".steam", "debian-installation"),
+			"~/.steam/debian-installation", "native"},
+		{filepath.Join(dataHome, "Steam"), "$XDG_DATA_HOME/Steam", "native"},
+		{filepath.Join(home, ".var", "app", "com.valvesoftware.Steam",
+			".local", "share", "Steam"), "Flatpak", "flatpak"},
+		{filepath.Join(home, "snap", "steam", "common",
+			".local", "share", "Steam"), "Snap", "snap"},
+		{filepath.Join(home, ".steam"), "~/.steam", "native"},
+	}, nil
 }
@@ -0,0 +1,131 @@
+package steamfiles_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+)
+
+// fakeUserHome makes a temporary home directory holding a Steam home in each
+// of the given places (relative to it), and makes it $HOME until the test
+// finishes.  It clears $XDG_DATA_HOME, $STEAM_DIR and SteamHomeOverride.
+//
+func fakeUserHome(t *testing.T, steamHomes ...string) string {
+	t.Helper()
+	home := t.TempDir()
+	for _, rel := range steamHomes {
+		if err := os.MkdirAll(filepath.Join(home, rel, "steamapps"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setEnv(t, "HOME", home)
+	setEnv(t, "XDG_DATA_HOME", "")
+	setEnv(t, steamfiles.SteamHomeEnvVar, "")
+	prev := steamfiles.SteamHomeOverride
+	steamfiles.SteamHomeOverride = ""
+	t.Cleanup(func() { steamfiles.SteamHomeOverride = prev })
+	return home
+}
+
+// checkHomes checks the paths and .FoundBy fields of FindSteamHomes’ results.
+//
+func checkHomes(t *testing.T, what string, got []steamfiles.SteamHome,
+	want ...string) {
+	t.Helper()
+	ok := len(got) == len(want)/2
+	for i := 0; ok && i < len(got); i++ {
+		ok = got[i].Path == want[2*i] && got[i].FoundBy == want[2*i+1]
+	}
+	if !ok {
+		t.Errorf("%s: FindSteamHomes gave %+v, want (path, found-by) pairs %q",
+			what, got, want)
+	}
+}
+
+func TestFindSteamHomesOrder(t *testing.T) {
+	home := fakeUserHome(t, ".local/share/Steam",
+		".var/app/com.valvesoftware.Steam/.local/share/Steam",
+		"snap/steam/common/.local/share/Steam")
+	symlink(t, filepath.Join(home, ".local/share/Steam"),
+		filepath.Join(home, ".steam"))
+
+	homes, err := steamfiles.NewScanner(nil).FindSteamHomes()
+	if err != nil {
+		t.Fatalf("FindSteamHomes: %s", err)
+	}
+	// ~/.steam/steam and ~/.steam/root do not exist; ~/.steam is the same
+	// installation as $XDG_DATA_HOME/Steam, which is found first.
+	checkHomes(t, "native, Flatpak and Snap", homes,
+		filepath.Join(home, ".local/share/Steam"), "$XDG_DATA_HOME/Steam",
+		filepath.Join(home, ".var/app/com.valvesoftware.Steam/.local/share/Steam"),
+		"Flatpak",
+		filepath.Join(home, "snap/steam/common/.local/share/Steam"), "Snap")
+	if homes[1].Flavour != "flatpak" || homes[2].Flavour != "snap" {
+		t.Errorf("got flavours %q and %q, want flatpak and snap",
+			homes[1].Flavour, homes[2].Flavour)
+	}
+}
+
+func TestFindSteamHomesKeepsPathFound(t *testing.T) {
+	home := fakeUserHome(t, ".local/share/Steam")
+	if err := os.Mkdir(filepath.Join(home, ".steam"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, filepath.Join(home, ".local/share/Steam"),
+		filepath.Join(home, ".steam", "steam"))
+	symlink(t, filepath.Join(home, ".local/share/Steam"),
+		filepath.Join(home, ".steam", "root"))
+
+	homes, err := steamfiles.NewScanner(nil).FindSteamHomes()
+	if err != nil {
+		t.Fatalf("FindSteamHomes: %s", err)
+	}
+	checkHomes(t, "symlinked ~/.steam/steam", homes,
+		filepath.Join(home, ".steam/steam"), "~/.steam/steam")
+}
+
+func TestFindSteamHomesOverride(t *testing.T) {
+	home := fakeUserHome(t, ".steam/steam", "other")
+	other := filepath.Join(home, "other")
+	native := filepath.Join(home, ".steam/steam")
+
+	setEnv(t, steamfiles.SteamHomeEnvVar, other)
+	homes, err := steamfiles.NewScanner(nil).FindSteamHomes()
+	if err != nil {
+		t.Fatalf("FindSteamHomes with $STEAM_DIR: %s", err)
+	}
+	checkHomes(t, "$STEAM_DIR", homes, other, "$STEAM_DIR", native,
+		"~/.steam/steam")
+
+	// -H (SteamHomeOverride) beats $STEAM_DIR, and the same installation is
+	// not listed again.
+	steamfiles.SteamHomeOverride = native
+	homes, err = steamfiles.NewScanner(nil).FindSteamHomes()
+	if err != nil {
+		t.Fatalf("FindSteamHomes with SteamHomeOverride: %s", err)
+	}
+	checkHomes(t, "SteamHomeOverride", homes, native, "override setting")
+
+	// A Scanner’s own setting beats both.
+	s := steamfiles.NewScanner(nil)
+	s.SteamHomeOverride = other
+	if p, err := s.FindSteamHome(); err != nil || p != other {
+		t.Errorf("FindSteamHome with Scanner.SteamHomeOverride gave %q, %v; want %q",
+			p, err, other)
+	}
+
+	// An override that is not a Steam home is an error.
+	steamfiles.SteamHomeOverride = filepath.Join(home, "nowhere")
+	if homes, err := steamfiles.NewScanner(nil).FindSteamHomes(); err == nil {
+		t.Errorf("FindSteamHomes with a bad override gave %+v", homes)
+	}
+}
+
+func TestFindSteamHomesNone(t *testing.T) {
+	fakeUserHome(t)
+	if homes, err := steamfiles.NewScanner(nil).FindSteamHomes(); err == nil {
+		t.Errorf("FindSteamHomes found %+v in an empty home directory", homes)
+	}
+}
@@ -0,0 +1,739 @@
+// Functions for moving an installed app from one Steam library folder to
+// another, the way Steam’s own “Move install folder” does, but resumably.
+
+package steamfiles
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/c12h/errs"
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// A MovePhase says how far a move of an app has got.
+//
+type MovePhase string
+
+const (
+	// Copying the app’s files to a temporary directory in the destination
+	// library, then checking the copy.  The source is untouched.
+	MoveCopying MovePhase = "copying"
+	// Switching over: renaming the copy into place, writing the manifest
+	// in the destination and removing it from the source, and updating
+	// libraryfolders.vdf.  The source files are untouched.
+	MoveSwitching MovePhase = "switching"
+	// Removing the source files.  The destination is complete.
+	MoveCleaning MovePhase = "cleaning"
+)
+
+// An AppMove describes a move of an app between Steam library directories that
+// has started but not finished.  MoveApp records it in a journal file in the
+// destination library (steamapps/steamfiles-move_<AppNum>.json) so that an
+// interrupted move can be resumed or rolled back.
+//
+type AppMove struct {
+	AppNumber AppNum    `json:"appid"`
+	AppName   string    `json:"name"`
+	From      string    `json:"from"`    // The source "steamapps" directory
+	To        string    `json:"to"`      // The destination "steamapps" directory
+	Subdir    string    `json:"subdir"`  // "common" or "music"
+	DirName   string    `json:"dirname"` // The install directory’s actual name
+	Size      int64     `json:"size"`    // The total size of the app’s files
+	Phase     MovePhase `json:"phase"`
+	Started   time.Time `json:"started"`
+}
+
+// MoveOptions controls MoveApp.  A nil *MoveOptions means use the defaults.
+//
+type MoveOptions struct {
+	// MinFreeSpace is how many bytes must remain free in the destination
+	// after the move.
+	MinFreeSpace int64
+	// Progress (if not nil) is called as files are copied and checked.
+	Progress ScanProgressReporter
+}
+
+// Pathnames involved in a move.
+func (m *AppMove) srcDir() string     { return filepath.Join(m.From, m.Subdir, m.DirName) }
+func (m *AppMove) destDir() string    { return filepath.Join(m.To, m.Subdir, m.DirName) }
+func (m *AppMove) partialDir() string { return m.destDir() + ".steamfiles-moving" }
+func (m *AppMove) manifestName() string {
+	return fmt.Sprintf("appmanifest_%d.acf", m.AppNumber)
+}
+func (m *AppMove) srcManifest() string    { return filepath.Join(m.From, m.manifestName()) }
+func (m *AppMove) parkedManifest() string { return m.srcManifest() + ".steamfiles-moving" }
+func (m *AppMove) destManifest() string   { return filepath.Join(m.To, m.manifestName()) }
+func (m *AppMove) journalPath() string    { return moveJournalPath(m.To, m.AppNumber) }
+
+func moveJournalPath(steamLibDir string, appNum AppNum) string {
+	return filepath.Join(steamLibDir, fmt.Sprintf("steamfiles-move_%d.json", appNum))
+}
+
+var reMoveJournal = regexp.MustCompile(`^steamfiles-move_(\d+)\.json$`)
+
+// ErrSteamRunning is returned by functions that refuse to change a Steam
+// library while Steam is running.
+//
+var ErrSteamRunning = errors.New("Steam is running")
+
+// MoveApp moves an installed app to another of an Installation’s Steam library
+// directories: its install directory (common/<installdir> or
+// music/<installdir>), its manifest and its entry in the "apps" lists of
+// libraryfolders.vdf.  Its Workshop content, shader cache and Proton prefix
+// stay where they are.
+//
+// MoveApp refuses to start if Steam is running, if Steam is part-way through
+// updating the app, if the destination already has the app, or if the
+// destination lacks the space for it.  It copies the app’s files, checks the
+// copy against the originals (by size and SHA-1 hash), switches over, and
+// only then removes the originals.  The app always has one complete copy with
+// a manifest.
+//
+// If a move of the app to steamLibDir was interrupted (by a crash or by ctx),
+// MoveApp resumes it (checking the space again if it was still copying);
+// AbortMove rolls it back instead.  The Installation is not updated, so
+// callers should load it again afterwards.
+//
+// Unlike most of this package, MoveApp always uses the real file system.
+//
+func MoveApp(ctx context.Context, inst *Installation, appNum AppNum,
+	steamLibDir string, opts *MoveOptions,
+) error {
+	if opts == nil {
+		opts = &MoveOptions{}
+	}
+	if SteamRunning(inst.Home) {
+		return errs.Cannot("move", "app", strconv.Itoa(int(appNum)), false, "",
+			ErrSteamRunning)
+	}
+	s := NewScanner(OSFileSystem)
+	lib := inst.Library(steamLibDir)
+	if lib == nil {
+		return cannotFind(fmt.Sprintf("Steam library directory %q", steamLibDir), nil)
+	}
+
+	m, err := ReadMoveJournal(lib.Path, appNum)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		if m, err = startMove(s, inst, appNum, lib, opts); err != nil {
+			return err
+		}
+	} else if m.Phase == MoveCopying {
+		// The free space may have gone since the move was interrupted.
+		if err := checkMoveSpace(s, m, opts); err != nil {
+			return err
+		}
+	}
+
+	scan := newScanState(ctx, &ScanOptions{Progress: opts.Progress})
+	for {
+		var err error
+		switch m.Phase {
+		case MoveCopying:
+			if err = copyAppTree(scan, m, opts); err == nil {
+				err = setMovePhase(m, MoveSwitching)
+			}
+		case MoveSwitching:
+			if err = switchApp(s, inst.Home, m); err == nil {
+				err = setMovePhase(m, MoveCleaning)
+			}
+		case MoveCleaning:
+			if err = os.RemoveAll(m.srcDir()); err != nil {
+				return cannot("remove", "directory", m.srcDir(), err)
+			}
+			if err = removeIfExists(m.parkedManifest()); err != nil {
+				return err
+			}
+			return removeIfExists(m.journalPath())
+		default:
+			return fileError(m.journalPath(), "phase", "unknown phase %q", m.Phase)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startMove checks that a move can be done, and writes its journal.
+//
+func startMove(s *Scanner, inst *Installation, appNum AppNum, lib *Library,
+	opts *MoveOptions,
+) (*AppMove, error) {
+	app, ok := inst.Apps[appNum]
+	if !ok {
+		return nil, cannotFind(fmt.Sprintf("installed app %d", appNum), nil)
+	}
+	what := fmt.Sprintf("app %d (%q)", appNum, app.AppName)
+	from := app.LibraryFolders[0]
+	if s.sameDir(from, lib.Path) {
+		return nil, errs.Cannot("move", "", what, false, "— it is already in "+lib.Path, nil)
+	}
+	if app.UpdatePending() {
+		return nil, errs.Cannot("move", "", what, false,
+			"— Steam has not finished updating it", nil)
+	}
+	srcDir, err := s.findAppDir(from, app.InstallDir)
+	if err != nil {
+		return nil, err
+	}
+	m := &AppMove{
+		AppNumber: appNum,
+		AppName:   app.AppName,
+		From:      from,
+		To:        lib.Path,
+		Subdir:    filepath.Base(filepath.Dir(srcDir)),
+		DirName:   filepath.Base(srcDir),
+		Phase:     MoveCopying,
+		Started:   time.Now().UTC().Truncate(time.Second),
+	}
+	for _, p := range []string{m.destDir(), m.destManifest(), m.partialDir()} {
+		if _, err := os.Lstat(p); err == nil {
+			return nil, errs.Cannot("move", "", what, false,
+				fmt.Sprintf("— %q already exists", p), nil)
+		}
+	}
+
+	m.Size, err = s.treeSize(newScanState(context.Background(), nil), srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMoveSpace(s, m, opts); err != nil {
+		return nil, err
+	}
+	return m, writeMoveJournal(m)
+}
+
+// checkMoveSpace checks that the destination of a move has room for the rest
+// of the copy (the bytes not already in its partial directory) plus
+// opts.MinFreeSpace.
+//
+func checkMoveSpace(s *Scanner, m *AppMove, opts *MoveOptions) error {
+	need := m.Size + opts.MinFreeSpace
+	if _, err := os.Lstat(m.partialDir()); err == nil {
+		copied, err := s.treeSize(newScanState(context.Background(), nil),
+			m.partialDir())
+		if err != nil {
+			return err
+		}
+		need -= copied
+	}
+	space, err := s.StatDisk(m.To)
+	if err != nil {
+		return err
+	}
+	if space.Available < need {
+		return errs.Cannot("move", "", fmt.Sprintf("app %d (%q)", m.AppNumber, m.AppName),
+			false, fmt.Sprintf("— it needs %d bytes, but %q has only %d free",
+				need, m.To, space.Available), nil)
+	}
+	return nil
+}
+
+// ReadMoveJournal returns the unfinished move of an app to a Steam library
+// directory, or nil if there is none.
+//
+func ReadMoveJournal(steamLibDir string, appNum AppNum) (*AppMove, error) {
+	path := moveJournalPath(steamLibDir, appNum)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, cannot("read", "move journal", path, err)
+	}
+	m := &AppMove{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fileError(path, "", "is not a valid move journal: %s", err)
+	}
+	if m.AppNumber != appNum || !sameCleanPath(m.To, steamLibDir) {
+		return nil, fileError(path, "", "is for app %d to %q", m.AppNumber, m.To)
+	}
+	m.To = steamLibDir
+	return m, nil
+}
+
+// PendingMoves returns the unfinished moves into any of an Installation’s
+// libraries, sorted by AppNum.
+//
+func PendingMoves(inst *Installation) ([]*AppMove, error) {
+	var ret []*AppMove
+	for _, lib := range inst.Libraries {
+		entries, err := os.ReadDir(lib.Path)
+		if err != nil {
+			return nil, cannot("read", "directory", lib.Path, err)
+		}
+		for _, e := range entries {
+			match := reMoveJournal.FindStringSubmatch(e.Name())
+			if match == nil {
+				continue
+			}
+			n, err := strconv.ParseInt(match[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			m, err := ReadMoveJournal(lib.Path, AppNum(n))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, m)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].AppNumber < ret[j].AppNumber })
+	return ret, nil
+}
+
+// AbortMove rolls back an unfinished move of an app to a Steam library
+// directory, leaving the app where it was.  It cannot roll back a move that has
+// reached MoveCleaning, since some of the source files may be gone; MoveApp can
+// finish such a move.
+//
+func AbortMove(inst *Installation, appNum AppNum, steamLibDir string) error {
+	if SteamRunning(inst.Home) {
+		return errs.Cannot("roll back", "move of app", strconv.Itoa(int(appNum)),
+			false, "", ErrSteamRunning)
+	}
+	m, err := ReadMoveJournal(steamLibDir, appNum)
+	if err != nil {
+		return err
+	} else if m == nil {
+		return cannotFind(fmt.Sprintf("a move of app %d to %q", appNum, steamLibDir), nil)
+	}
+
+	switch m.Phase {
+	case MoveCleaning:
+		return errs.Cannot("roll back", "", fmt.Sprintf("move of app %d", appNum), false,
+			"— it has started removing the originals (move it again to finish)", nil)
+	case MoveSwitching:
+		// Undo the switch in the reverse order.
+		err := updateLibraryFoldersApps(NewScanner(OSFileSystem), inst.Home,
+			m.To, m.From, m.AppNumber, m.Size)
+		if err != nil {
+			return err
+		}
+		if err := unparkManifest(m); err != nil {
+			return err
+		}
+		if err := removeIfExists(m.destManifest()); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(m.destDir()); err != nil {
+			return cannot("remove", "directory", m.destDir(), err)
+		}
+	}
+	if err := os.RemoveAll(m.partialDir()); err != nil {
+		return cannot("remove", "directory", m.partialDir(), err)
+	}
+	return removeIfExists(m.journalPath())
+}
+
+/*----------------------------- Helper functions -----------------------------*/
+
+func writeMoveJournal(m *AppMove) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(m.journalPath(), append(data, '\n'))
+}
+
+func setMovePhase(m *AppMove, phase MovePhase) error {
+	m.Phase = phase
+	return writeMoveJournal(m)
+}
+
+// copyAppTree copies an app’s files to the partial directory (skipping any
+// that an earlier attempt copied), then checks the copy.
+//
+func copyAppTree(scan *scanState, m *AppMove, opts *MoveOptions) error {
+	src, dest := m.srcDir(), m.partialDir()
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return cannot("create", "directory", dest, err)
+	}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return cannot("read", "", p, err)
+		}
+		if err := scan.ctx.Err(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return cannot("examine", "", p, err)
+		}
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return cannot("create", "directory", target, err)
+			}
+			if err := os.Chmod(target, info.Mode().Perm()|0700); err != nil {
+				return cannot("set permissions of", "directory", target, err)
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return cannot("read", "symlink", p, err)
+			}
+			if have, err := os.Readlink(target); err == nil && have == link {
+				return nil
+			}
+			os.Remove(target)
+			if err := os.Symlink(link, target); err != nil {
+				return cannot("create", "symlink", target, err)
+			}
+		case isRegFile(info):
+			if have, err := os.Lstat(target); err == nil && isRegFile(have) &&
+				have.Size() == info.Size() && have.ModTime().Equal(info.ModTime()) {
+				scan.visited(1, info.Size())
+				return nil // Copied by an earlier attempt
+			}
+			if err := copyFile(p, target, info); err != nil {
+				return err
+			}
+			scan.visited(1, info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return verifyCopy(scan, src, dest)
+}
+
+// copyFile copies a regular file, with its permissions and modification time.
+// The copy goes to a temporary name first, so a partly copied file never has
+// the right name.
+//
+func copyFile(src, dest string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return cannot("open", "file", src, err)
+	}
+	defer in.Close()
+	tmp := dest + ".steamfiles-tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return cannot("create", "file", tmp, err)
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return cannot("copy", "file", src, err)
+	}
+	return nil
+}
+
+// verifyCopy checks that two trees hold the same directories, symlinks and
+// regular files, comparing the files’ contents by SHA-1 hash.
+//
+func verifyCopy(scan *scanState, src, dest string) error {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return cannot("read", "", p, err)
+		}
+		if err := scan.ctx.Err(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dest, rel)
+		seen[rel] = true
+		info, err := d.Info()
+		if err != nil {
+			return cannot("examine", "", p, err)
+		}
+		have, err := os.Lstat(target)
+		if err != nil {
+			return cannot("check copy of", "", p, err)
+		}
+		bad := func(why string) error {
+			return fileError(target, "", "is not a good copy of %q: %s", p, why)
+		}
+		switch {
+		case d.IsDir():
+			if !have.IsDir() {
+				return bad("not a directory")
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			want, _ := os.Readlink(p)
+			if got, err := os.Readlink(target); err != nil || got != want {
+				return bad("not the same symlink")
+			}
+		case isRegFile(info):
+			if !isRegFile(have) || have.Size() != info.Size() {
+				return bad("different size")
+			}
+			wantHash, err := osFileSHA1(p)
+			if err != nil {
+				return err
+			}
+			gotHash, err := osFileSHA1(target)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(wantHash, gotHash) {
+				return bad("different contents")
+			}
+			scan.visited(1, info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The copy must not have anything extra, such as files that were
+	// deleted from the source after an earlier attempt copied them.
+	return filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return cannot("read", "", p, err)
+		}
+		rel, _ := filepath.Rel(dest, p)
+		if seen[rel] {
+			return nil
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return cannot("remove", "", p, err)
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func osFileSHA1(path string) ([]byte, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, cannot("open", "file", path, err)
+	}
+	defer fh.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return nil, cannot("read", "file", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// switchApp makes the destination copy the one Steam uses.  Each step can be
+// repeated safely, so an interrupted switch can just be run again.  The
+// destination manifest appears before the source one goes, so there is always
+// a manifest for a complete copy.
+//
+func switchApp(s *Scanner, steamHome string, m *AppMove) error {
+	if _, err := os.Lstat(m.partialDir()); err == nil {
+		if err := os.Rename(m.partialDir(), m.destDir()); err != nil {
+			return cannot("rename", "directory", m.partialDir(), err)
+		}
+	}
+	if _, err := os.Lstat(m.destManifest()); os.IsNotExist(err) {
+		from := m.srcManifest()
+		if _, err := os.Lstat(from); os.IsNotExist(err) {
+			from = m.parkedManifest()
+		}
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return cannot("read", "manifest", from, err)
+		}
+		if err := writeFileAtomically(m.destManifest(), data); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Lstat(m.srcManifest()); err == nil {
+		if err := os.Rename(m.srcManifest(), m.parkedManifest()); err != nil {
+			return cannot("rename", "manifest", m.srcManifest(), err)
+		}
+	}
+	return updateLibraryFoldersApps(s, steamHome, m.From, m.To, m.AppNumber, m.Size)
+}
+
+// unparkManifest puts the source manifest back, for AbortMove.
+//
+func unparkManifest(m *AppMove) error {
+	if _, err := os.Lstat(m.parkedManifest()); err == nil {
+		if err := os.Rename(m.parkedManifest(), m.srcManifest()); err != nil {
+			return cannot("rename", "manifest", m.parkedManifest(), err)
+		}
+	}
+	return nil
+}
+
+// updateLibraryFoldersApps moves an app from one SLF’s "apps" list to
+// another’s in the libraryfolders.vdf files that have such lists
+// (<SteamHome>/steamapps/libraryfolders.vdf and, in newer versions of Steam,
+// <SteamHome>/config/libraryfolders.vdf).  Files in the old format, which have
+// no such lists, are left alone.  Either all the files that need changing are
+// changed or (as far as possible) none are, so they never disagree.
+//
+func updateLibraryFoldersApps(s *Scanner, steamHome, from, to string,
+	appNum AppNum, size int64,
+) error {
+	appText := strconv.Itoa(int(appNum))
+	var updates []fileUpdate
+	for _, path := range []string{
+		filepath.Join(steamHome, "steamapps", "libraryfolders.vdf"),
+		filepath.Join(steamHome, "config", "libraryfolders.vdf"),
+	} {
+		old, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return cannot("read", "", path, err)
+		}
+		info, err := sVDF.FromFile(path, "LibraryFolders", "libraryfolders")
+		if err != nil {
+			return err
+		}
+		top, ok := info.TopValue.(sVDF.NamesValuesList)
+		if !ok {
+			continue
+		}
+		mounts := s.driveMounts(steamHome, info)
+		changed := false
+		for _, v := range top {
+			slf, ok := v.(sVDF.NamesValuesList)
+			if !ok {
+				continue
+			}
+			slfPath, _ := slf["path"].(string)
+			apps, ok := slf["apps"].(sVDF.NamesValuesList)
+			if slfPath == "" || !ok {
+				continue
+			}
+			local, err := s.localPath(slfPath, mounts)
+			if err != nil {
+				continue
+			}
+			steamapps := filepath.Join(local, "steamapps")
+			switch {
+			case s.sameDir(steamapps, from):
+				if _, have := apps[appText]; have {
+					delete(apps, appText)
+					changed = true
+				}
+			case s.sameDir(steamapps, to):
+				if apps[appText] != strconv.FormatInt(size, 10) {
+					apps[appText] = strconv.FormatInt(size, 10)
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := sVDF.Write(&buf, info.TopName, top); err != nil {
+			return cannot("write", "", path, err)
+		}
+		updates = append(updates, fileUpdate{path: path, old: old, new: buf.Bytes()})
+	}
+	return replaceFiles(updates)
+}
+
+// writeFileAtomically replaces a file via a temporary file and a rename, so
+// that readers see either the old contents or the new.
+//
+func writeFileAtomically(path string, data []byte) error {
+	return replaceFiles([]fileUpdate{{path: path, new: data}})
+}
+
+// A fileUpdate is a file for replaceFiles to replace, with its old contents
+// (for putting back) and its new ones.
+//
+type fileUpdate struct {
+	path     string
+	old, new []byte
+}
+
+// replaceFiles replaces several files as writeFileAtomically does, but so that
+// either all of them get their new contents or, as far as possible, none do:
+// it writes every temporary file before renaming any, and if a rename fails it
+// puts back the old contents of the files already replaced.
+//
+func replaceFiles(updates []fileUpdate) error {
+	tmpPath := func(path string) string { return path + ".steamfiles-tmp" }
+	for i, u := range updates {
+		if err := writeTempFile(tmpPath(u.path), u.new); err != nil {
+			for _, done := range updates[:i] {
+				os.Remove(tmpPath(done.path))
+			}
+			return cannot("write", "file", u.path, err)
+		}
+	}
+	for i, u := range updates {
+		if err := os.Rename(tmpPath(u.path), u.path); err != nil {
+			for _, rest := range updates[i:] {
+				os.Remove(tmpPath(rest.path))
+			}
+			for _, done := range updates[:i] {
+				if writeTempFile(tmpPath(done.path), done.old) == nil {
+					os.Rename(tmpPath(done.path), done.path)
+				}
+			}
+			return cannot("write", "file", u.path, err)
+		}
+	}
+	return nil
+}
+
+// writeTempFile creates (or truncates) a file, writes data to it and syncs it,
+// removing it if anything fails.
+//
+func writeTempFile(tmp string, data []byte) error {
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return cannot("remove", "", path, err)
+	}
+	return nil
+}
+
+func sameCleanPath(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,197 @@
+package steamfiles_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c12h/steam-stuff/sVDF"
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+func TestMoveApp(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("bin/game", "#!game", steamtest.DefaultTime).
+		AddFile("data/a.pak", "aaaa", steamtest.DefaultTime)
+	h.AddLibrary("/media/games")
+	root := h.Install(t)
+	from := filepath.Join(root, "home/me/.steam/steam/steamapps")
+	to := filepath.Join(root, "media/games/steamapps")
+
+	inst := load(t, nil)
+	if err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil); err != nil {
+		t.Fatalf("MoveApp: %s", err)
+	}
+
+	for rel, want := range map[string]string{
+		"common/Ten/bin/game":   "#!game",
+		"common/Ten/data/a.pak": "aaaa",
+	} {
+		if got := readFile(t, filepath.Join(to, rel)); got != want {
+			t.Errorf("%s holds %q, want %q", rel, got, want)
+		}
+	}
+	for _, gone := range []string{"common/Ten", "appmanifest_10.acf"} {
+		if exists(filepath.Join(from, gone)) {
+			t.Errorf("%s is still in the old library", gone)
+		}
+	}
+	if moves, err := steamfiles.PendingMoves(inst); err != nil || len(moves) != 0 {
+		t.Errorf("PendingMoves after a move = %v, %v; want none", moves, err)
+	}
+
+	inst = load(t, nil)
+	if app := inst.Apps[10]; app == nil || app.LibraryFolders[0] != to {
+		t.Fatalf("after the move, app 10 is %+v; want it in %q", app, to)
+	}
+	// Steam reads the apps lists in libraryfolders.vdf too.
+	lf, err := sVDF.FromFile(filepath.Join(from, "libraryfolders.vdf"), "libraryfolders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.HaveString("0", "apps", "10") || !lf.HaveString("1", "apps", "10") {
+		t.Errorf("libraryfolders.vdf does not list app 10 in only the new library")
+	}
+
+	if err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil); err == nil {
+		t.Errorf("moving app 10 to where it already is did not fail")
+	}
+}
+
+func TestMoveAppRefusesWhileSteamRuns(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games")
+	root := h.Install(t)
+	from := filepath.Join(root, "home/me/.steam/steam/steamapps")
+	to := filepath.Join(root, "media/games/steamapps")
+
+	inst := load(t, nil)
+	steamfiles.FakeSteamRunning(t, true)
+	err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil)
+	if !errors.Is(err, steamfiles.ErrSteamRunning) {
+		t.Fatalf("MoveApp while Steam runs gave %v, want ErrSteamRunning", err)
+	}
+	if !exists(filepath.Join(from, "common/Ten/game")) ||
+		exists(filepath.Join(to, "common/Ten")) {
+		t.Errorf("a refused move changed the libraries")
+	}
+}
+
+func TestMoveAppRefusesWithoutSpace(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games")
+	root := h.Install(t)
+	from := filepath.Join(root, "home/me/.steam/steam/steamapps")
+	to := filepath.Join(root, "media/games/steamapps")
+
+	inst := load(t, nil)
+	err := steamfiles.MoveApp(context.Background(), inst, 10, to,
+		&steamfiles.MoveOptions{MinFreeSpace: 1 << 62})
+	if err == nil {
+		t.Fatalf("MoveApp with too little space did not fail")
+	}
+	if !exists(filepath.Join(from, "common/Ten/game")) ||
+		!exists(filepath.Join(from, "appmanifest_10.acf")) {
+		t.Errorf("a refused move changed the source library")
+	}
+	if exists(filepath.Join(to, "common/Ten")) {
+		t.Errorf("a refused move left files in the destination")
+	}
+}
+
+func TestMoveAppResumeRechecksSpace(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games")
+	root := h.Install(t)
+	from := filepath.Join(root, "home/me/.steam/steam/steamapps")
+	to := filepath.Join(root, "media/games/steamapps")
+
+	// A cancelled move stops while copying, leaving its journal.
+	inst := load(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := steamfiles.MoveApp(ctx, inst, 10, to, nil); err == nil {
+		t.Fatalf("MoveApp with a cancelled context did not fail")
+	}
+	if m, err := steamfiles.ReadMoveJournal(to, 10); err != nil || m == nil ||
+		m.Phase != steamfiles.MoveCopying {
+		t.Fatalf("after a cancelled move, the journal is %+v, %v", m, err)
+	}
+
+	err := steamfiles.MoveApp(context.Background(), inst, 10, to,
+		&steamfiles.MoveOptions{MinFreeSpace: 1 << 62})
+	if err == nil {
+		t.Fatalf("resuming a move with too little space did not fail")
+	}
+	if exists(filepath.Join(to, "common/Ten")) ||
+		!exists(filepath.Join(from, "appmanifest_10.acf")) {
+		t.Errorf("a refused resumption switched the app over")
+	}
+	if err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil); err != nil {
+		t.Fatalf("resuming the move: %s", err)
+	}
+	if !exists(filepath.Join(to, "common/Ten/game")) {
+		t.Errorf("the resumed move did not finish")
+	}
+}
+
+func TestMoveAppUpdatesBothLibraryFolders(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games")
+	root := h.Install(t)
+	steamHome := filepath.Join(root, "home/me/.steam/steam")
+	to := filepath.Join(root, "media/games/steamapps")
+	lfPaths := []string{filepath.Join(steamHome, "steamapps/libraryfolders.vdf"),
+		filepath.Join(steamHome, "config/libraryfolders.vdf")}
+	original := readFile(t, lfPaths[0])
+	if err := os.Mkdir(filepath.Dir(lfPaths[1]), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lfPaths[1], []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make writing config/libraryfolders.vdf fail, by putting a directory
+	// where its temporary file would go.
+	blocker := lfPaths[1] + ".steamfiles-tmp"
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inst := load(t, nil)
+	if err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil); err == nil {
+		t.Fatalf("MoveApp did not fail when it could not update libraryfolders.vdf")
+	}
+	for _, p := range lfPaths {
+		if readFile(t, p) != original {
+			t.Errorf("a failed update changed %s", p)
+		}
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := steamfiles.MoveApp(context.Background(), inst, 10, to, nil); err != nil {
+		t.Fatalf("resuming the move: %s", err)
+	}
+	for _, p := range lfPaths {
+		lf, err := sVDF.FromFile(p, "libraryfolders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lf.HaveString("0", "apps", "10") || !lf.HaveString("1", "apps", "10") {
+			t.Errorf("%s does not list app 10 in only the new library", p)
+		}
+	}
+}
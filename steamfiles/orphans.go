@@ -0,0 +1,271 @@
+// Functions etc for finding files and directories that uninstalled apps have
+// left behind in Steam library folders.
+
+package steamfiles
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// An OrphanKind says what sort of leftover an Orphan is.  Like
+// BackupDefectKind, the values are short, stable strings.
+//
+type OrphanKind string
+
+const (
+	// A directory in steamapps/common (or steamapps/music) that no manifest
+	// in the same library names as its "installdir".
+	OrphanInstallDir OrphanKind = "install-dir"
+	// steamapps/shadercache/<AppNum>, for an app not installed anywhere.
+	OrphanShaderCache OrphanKind = "shadercache"
+	// steamapps/compatdata/<AppNum> (a Proton prefix), for an app not
+	// installed anywhere.
+	OrphanCompatData OrphanKind = "compatdata"
+	// steamapps/workshop/{content,downloads,temp}/<AppNum> or
+	// steamapps/workshop/appworkshop_<AppNum>.acf, for an app not installed
+	// anywhere.
+	OrphanWorkshop OrphanKind = "workshop"
+)
+
+// OrphanKinds lists all the OrphanKinds, in the order FindOrphans reports them.
+//
+var OrphanKinds = []OrphanKind{
+	OrphanInstallDir, OrphanShaderCache, OrphanCompatData, OrphanWorkshop}
+
+// An Orphan is a file or directory in a Steam library directory that belongs
+// to no installed app.
+//
+type Orphan struct {
+	Kind      OrphanKind `json:"kind"`
+	Library   string     `json:"library"`         // The "steamapps" directory
+	Path      string     `json:"path"`            // The orphaned file or directory
+	AppNumber AppNum     `json:"appid,omitempty"` // The app it belonged to, if known
+	Size      int64      `json:"size"`            // Total size of the files in it
+	ModTime   time.Time  `json:"mtime"`           // Its modification time
+}
+
+// FindOrphans looks through every library in an Installation for leftovers
+// from uninstalled apps, and works out how much space each one takes.  The
+// results are sorted by library (in the order of inst.Libraries), then kind,
+// then pathname.
+//
+// FindOrphans is cautious: it counts an app as gone only if it is not
+// installed in any of the Installation’s libraries (including those in
+// Installation.Offline, going by their cached inventories), and it ignores
+// entries whose names are not AppNums (such as the compatdata directories of
+// non-Steam games, whose IDs are too big to be AppNums).  Even so, the
+// Installation should include all of Steam’s libraries, or apps installed
+// elsewhere will look uninstalled.
+//
+// Progress reports (via opts) count the files whose sizes are added up.
+//
+func FindOrphans(ctx context.Context, inst *Installation, opts *ScanOptions,
+) ([]*Orphan, error) {
+	return std.FindOrphans(ctx, inst, opts)
+}
+
+// FindOrphans is the Scanner method behind the FindOrphans function.
+//
+func (s *Scanner) FindOrphans(ctx context.Context, inst *Installation,
+	opts *ScanOptions,
+) ([]*Orphan, error) {
+	installed := make(map[AppNum]bool)
+	for appNum := range inst.Apps {
+		installed[appNum] = true
+	}
+	for _, lib := range inst.Offline {
+		for _, app := range lib.Apps {
+			installed[app.AppNumber] = true
+		}
+	}
+
+	var ret []*Orphan
+	for _, lib := range inst.Libraries {
+		orphans, err := s.findLibraryOrphans(lib, installed)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, orphans...)
+	}
+
+	// Work out the sizes, which can take a while.
+	scan := newScanState(ctx, opts)
+	errors := make([]error, len(ret))
+	err := scan.forEach(len(ret), func(i int) {
+		ret[i].Size, errors[i] = s.treeSize(scan, ret[i].Path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errors {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// findLibraryOrphans finds the orphans in one library, without their sizes,
+// given the apps installed anywhere.
+//
+func (s *Scanner) findLibraryOrphans(lib *Library, installed map[AppNum]bool,
+) ([]*Orphan, error) {
+	var ret []*Orphan
+	add := func(kind OrphanKind, path string, appNum AppNum) error {
+		info, err := s.fsys.Lstat(path)
+		if err != nil {
+			return cannot("examine", "", path, err)
+		}
+		ret = append(ret, &Orphan{Kind: kind, Library: lib.Path,
+			Path: path, AppNumber: appNum, ModTime: info.ModTime()})
+		return nil
+	}
+	// Entries in a subdirectory, or none if it does not exist.
+	entriesIn := func(dir string) ([]fs.DirEntry, error) {
+		entries, err := s.fsys.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, cannot("read", "directory", dir, err)
+		}
+		return entries, nil
+	}
+	// Whether a name is the AppNum of an app that is not installed.
+	isGoneApp := func(name string) (AppNum, bool) {
+		n, err := strconv.ParseInt(name, 10, 32)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return AppNum(n), !installed[AppNum(n)]
+	}
+
+	// Install dirs.  Compare names ignoring case, since Steam copes with
+	// wrongly-cased "installdir" values (see AppNewerThan).
+	wanted := make(map[string]bool)
+	for _, app := range lib.Apps {
+		wanted[monocase(app.InstallDir)] = true
+	}
+	for _, sub := range []string{"common", "music"} {
+		dir := filepath.Join(lib.Path, sub)
+		entries, err := entriesIn(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() && !wanted[monocase(e.Name())] {
+				if err := add(OrphanInstallDir,
+					filepath.Join(dir, e.Name()), 0); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Per-app directories.
+	perAppDirs := []struct {
+		kind OrphanKind
+		dir  string
+	}{
+		{OrphanShaderCache, "shadercache"},
+		{OrphanCompatData, "compatdata"},
+		{OrphanWorkshop, filepath.Join("workshop", "content")},
+		{OrphanWorkshop, filepath.Join("workshop", "downloads")},
+		{OrphanWorkshop, filepath.Join("workshop", "temp")},
+	}
+	for _, pad := range perAppDirs {
+		dir := filepath.Join(lib.Path, pad.dir)
+		entries, err := entriesIn(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if appNum, gone := isGoneApp(e.Name()); gone && e.IsDir() {
+				if err := add(pad.kind,
+					filepath.Join(dir, e.Name()), appNum); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Workshop manifests.
+	workshopDir := filepath.Join(lib.Path, "workshop")
+	entries, err := entriesIn(workshopDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		match := reAppWorkshopFile.FindStringSubmatch(e.Name())
+		if match == nil || e.IsDir() {
+			continue
+		}
+		if appNum, gone := isGoneApp(match[1]); gone {
+			if err := add(OrphanWorkshop,
+				filepath.Join(workshopDir, e.Name()), appNum); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	kindOrder := make(map[OrphanKind]int)
+	for i, k := range OrphanKinds {
+		kindOrder[k] = i
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return kindOrder[ret[i].Kind] < kindOrder[ret[j].Kind]
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret, nil
+}
+
+// treeSize returns the total size of the regular files in a directory tree
+// (or of a single file), without following symlinks.
+//
+func (s *Scanner) treeSize(scan *scanState, path string) (int64, error) {
+	size, _, err := s.treeStats(scan, path)
+	return size, err
+}
+
+// treeStats returns the total size and the newest modification time of the
+// regular files in a directory tree (or of a single file), without following
+// symlinks.
+//
+func (s *Scanner) treeStats(scan *scanState, path string) (int64, time.Time, error) {
+	info, err := s.fsys.Lstat(path)
+	if err != nil {
+		return 0, time.Time{}, cannot("examine", "", path, err)
+	}
+	if !info.IsDir() {
+		if isRegFile(info) {
+			scan.visited(1, info.Size())
+			return info.Size(), info.ModTime(), nil
+		}
+		return 0, time.Time{}, nil
+	}
+	var total, nFiles int64
+	var newest time.Time
+	err = s.walkTree(path, func(p string, d fs.DirEntry) error {
+		if err := scan.ctx.Err(); err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return cannot("examine", "", p, err)
+			}
+			total, nFiles = total+info.Size(), nFiles+1
+			if info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+		}
+		return nil
+	})
+	scan.visited(nFiles, total)
+	return total, newest, err
+}
@@ -0,0 +1,102 @@
+package steamfiles_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+// workshopACF is a minimal appworkshop_40.acf file.
+//
+const workshopACF = "\"AppWorkshop\"\n{\n\t\"appid\"\t\t\"40\"\n}\n"
+
+func TestFindOrphans(t *testing.T) {
+	const home = "/home/me/.steam/steam/steamapps/"
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	h.AddLibrary("/media/games").AddApp(50, "Fifty", "Fifty").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	for _, p := range []string{
+		"compatdata/10/pfx/user.reg",      // App 10 is installed
+		"compatdata/20/pfx/user.reg",      // An orphan
+		"compatdata/50/pfx/user.reg",      // App 50 is installed elsewhere
+		"shadercache/30/fozpipelinesv6/x", // An orphan
+		"common/Gone/game",                // An orphan
+	} {
+		h.AddFile(home+p, "data", steamtest.DefaultTime)
+	}
+	h.AddFile(home+"workshop/appworkshop_40.acf", workshopACF, steamtest.DefaultTime)
+	root := h.Install(t)
+	lib := filepath.Join(root, home)
+	trash := useTrash(t)
+
+	// Load once to cache the second library’s inventory, then take it
+	// offline: app 50 should still count as installed.
+	opts := &steamfiles.LoadOptions{NoBackups: true, CacheDir: t.TempDir()}
+	load(t, opts)
+	if err := os.RemoveAll(filepath.Join(root, "media/games")); err != nil {
+		t.Fatal(err)
+	}
+	inst := load(t, opts)
+	if len(inst.Offline) != 1 {
+		t.Fatalf("got %d offline libraries, want 1", len(inst.Offline))
+	}
+
+	orphans, err := steamfiles.FindOrphans(context.Background(), inst, nil)
+	if err != nil {
+		t.Fatalf("FindOrphans: %s", err)
+	}
+	want := []struct {
+		kind   steamfiles.OrphanKind
+		rel    string
+		appNum steamfiles.AppNum
+		size   int64
+	}{
+		{steamfiles.OrphanInstallDir, "common/Gone", 0, 4},
+		{steamfiles.OrphanShaderCache, "shadercache/30", 30, 4},
+		{steamfiles.OrphanCompatData, "compatdata/20", 20, 4},
+		{steamfiles.OrphanWorkshop, "workshop/appworkshop_40.acf", 40,
+			int64(len(workshopACF))},
+	}
+	if len(orphans) != len(want) {
+		for _, o := range orphans {
+			t.Logf("found %s %s", o.Kind, o.Path)
+		}
+		t.Fatalf("FindOrphans found %d orphans, want %d", len(orphans), len(want))
+	}
+	for i, w := range want {
+		o := orphans[i]
+		if o.Kind != w.kind || o.Path != filepath.Join(lib, w.rel) ||
+			o.AppNumber != w.appNum || o.Library != lib {
+			t.Errorf("orphan #%d is %+v, want %s %s", i, o, w.kind, w.rel)
+		}
+		if o.Size != w.size {
+			t.Errorf("orphan %s has size %d, want %d", w.rel, o.Size, w.size)
+		}
+	}
+	// Trash them, as steam-orphans does; then there should be none left,
+	// and nothing else gone.
+	for _, o := range orphans {
+		if _, err := steamfiles.MoveToTrash(o.Path); err != nil {
+			t.Fatalf("MoveToTrash: %s", err)
+		}
+	}
+	if !exists(filepath.Join(trash, "files", "Gone")) {
+		t.Errorf("common/Gone is not in the trash")
+	}
+	inst = load(t, opts)
+	if orphans, err := steamfiles.FindOrphans(context.Background(), inst, nil); err != nil ||
+		len(orphans) != 0 {
+		t.Errorf("after trashing, FindOrphans = %v, %v; want none", orphans, err)
+	}
+	for _, rel := range []string{"common/Ten/game", "compatdata/10", "compatdata/50"} {
+		if !exists(filepath.Join(lib, rel)) {
+			t.Errorf("%s was removed", rel)
+		}
+	}
+}
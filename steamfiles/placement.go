@@ -0,0 +1,250 @@
+// Functions for planning which Steam library folders apps should live in.
+
+package steamfiles
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A PlacementPolicy says where PlanPlacement should put apps.  A nil
+// *PlacementPolicy means use the defaults, which only keep MinFreeSpace free.
+//
+type PlacementPolicy struct {
+	// FastLibraries lists the Steam library folders (or their "steamapps"
+	// directories) on fast storage (SSDs); the rest count as slow (HDDs).
+	// If it is empty, all libraries count the same and only MinFreeSpace
+	// matters.
+	FastLibraries []string
+	// RecentlyPlayed is how recently an app must have been played to belong
+	// in a fast library.  Apps played less recently (or never) belong in a
+	// slow one.
+	RecentlyPlayed time.Duration
+	// MinFreeSpace is how many bytes to keep free in every library.
+	MinFreeSpace int64
+	// Now is the time to measure RecentlyPlayed from; the zero value means
+	// the current time.
+	Now time.Time
+	// FreeSpace returns the free space in a library; the default is the
+	// Available bytes that StatDisk gives.  Planning ‘what if’ cases can
+	// supply other numbers.
+	FreeSpace func(steamLibDir string) (int64, error)
+}
+
+// A PlannedMove is one step of a PlacementPlan.
+//
+type PlannedMove struct {
+	App       *InstalledApp `json:"-"`
+	AppNumber AppNum        `json:"appid"`
+	AppName   string        `json:"name"`
+	From      string        `json:"from"` // The source "steamapps" directory
+	To        string        `json:"to"`   // The destination, or "" if nowhere fits
+	Size      int64         `json:"size"` // The app’s SizeOnDisk
+	Reason    string        `json:"reason"`
+}
+
+// A LibrarySpace gives a library’s free space before and after a
+// PlacementPlan.
+//
+type LibrarySpace struct {
+	Library   string `json:"library"` // The "steamapps" directory
+	Fast      bool   `json:"fast"`
+	Free      int64  `json:"free"`
+	FreeAfter int64  `json:"free_after"`
+}
+
+// A PlacementPlan is the result of PlanPlacement.
+//
+type PlacementPlan struct {
+	Moves    []*PlannedMove  `json:"moves"`    // In the order they should be done
+	Unplaced []*PlannedMove  `json:"unplaced"` // Moves wanted but with nowhere to go
+	Skipped  []*PlannedMove  `json:"skipped"`  // Moves wanted but not possible now
+	Space    []*LibrarySpace `json:"space"`    // In the order of inst.Libraries
+}
+
+// PlanPlacement works out a list of moves (for MoveApp, or for doing by hand)
+// that puts an Installation’s apps where a policy wants them, going by the
+// SizeOnDisk and LastPlayed values in their manifests:
+//
+//   - first, apps in fast libraries that have not been played recently move
+//     to slow ones, least recently played first, freeing space for
+//   - apps in slow libraries that have been played recently, which move to
+//     fast ones, most recently played first; then
+//   - while any library has less than MinFreeSpace free, its least recently
+//     played apps move to another library of the same speed (or, failing
+//     that, a slow one).
+//
+// Each move goes to the suitable library with the most free space, provided it
+// keeps MinFreeSpace free there.  Libraries on the same file system (see
+// FileIdentity) share its free space, so moves between them are never planned.
+// Apps that Steam is updating are skipped.  Each app appears in the plan at
+// most once, so the free-space pass leaves alone apps that the earlier passes
+// have moved, skipped or failed to place.  PlanPlacement changes nothing.
+//
+func PlanPlacement(inst *Installation, policy *PlacementPolicy,
+) (*PlacementPlan, error) {
+	if policy == nil {
+		policy = &PlacementPolicy{}
+	}
+	now, freeSpace := policy.Now, policy.FreeSpace
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if freeSpace == nil {
+		freeSpace = func(steamLibDir string) (int64, error) {
+			space, err := inst.scanner.StatDisk(steamLibDir)
+			if err != nil {
+				return 0, err
+			}
+			return space.Available, nil
+		}
+	}
+
+	plan := &PlacementPlan{}
+	spaceFor := make(map[string]*LibrarySpace)
+	// pool maps each LibrarySpace to the first one on the same file system,
+	// which keeps track of the free space they share.
+	pool := make(map[*LibrarySpace]*LibrarySpace)
+	onDevice := make(map[uint64]*LibrarySpace)
+	for _, lib := range inst.Libraries {
+		free, err := freeSpace(lib.Path)
+		if err != nil {
+			return nil, err
+		}
+		ls := &LibrarySpace{Library: lib.Path, Free: free, FreeAfter: free}
+		for _, fast := range policy.FastLibraries {
+			ls.Fast = ls.Fast || inst.scanner.sameDir(fast, lib.Path) ||
+				inst.scanner.sameDir(fast, filepath.Dir(lib.Path))
+		}
+		plan.Space = append(plan.Space, ls)
+		spaceFor[lib.Path] = ls
+		pool[ls] = ls
+		if id, err := inst.scanner.FileIdentity(lib.Path); err == nil {
+			if first, ok := onDevice[id.Device]; ok {
+				pool[ls] = first
+			} else {
+				onDevice[id.Device] = ls
+			}
+		}
+	}
+	haveFast := false
+	for _, ls := range plan.Space {
+		haveFast = haveFast || ls.Fast
+	}
+
+	isRecent := func(app *InstalledApp) bool {
+		return !app.LastPlayed.IsZero() &&
+			now.Sub(app.LastPlayed) <= policy.RecentlyPlayed
+	}
+	where := make(map[AppNum]string)
+	for _, app := range inst.Apps {
+		where[app.AppNumber] = app.LibraryFolders[0]
+	}
+
+	// roomiest returns the library passing ok with the most space free that
+	// could take app and still keep MinFreeSpace free, or nil.
+	roomiest := func(app *InstalledApp, ok func(*LibrarySpace) bool) *LibrarySpace {
+		var best *LibrarySpace
+		from := pool[spaceFor[where[app.AppNumber]]]
+		for _, ls := range plan.Space {
+			if pool[ls] == from || !ok(ls) ||
+				pool[ls].FreeAfter-app.SizeOnDisk < policy.MinFreeSpace {
+				continue
+			}
+			if best == nil || pool[ls].FreeAfter > pool[best].FreeAfter {
+				best = ls
+			}
+		}
+		return best
+	}
+	fits := func(app *InstalledApp, ok func(*LibrarySpace) bool) bool {
+		return roomiest(app, ok) != nil
+	}
+	// move plans moving an app to the roomiest library that passes ok.
+	considered := make(map[AppNum]bool)
+	move := func(app *InstalledApp, ok func(*LibrarySpace) bool, reason string) {
+		considered[app.AppNumber] = true
+		pm := &PlannedMove{App: app, AppNumber: app.AppNumber,
+			AppName: app.AppName, From: where[app.AppNumber],
+			Size: app.SizeOnDisk, Reason: reason}
+		if app.UpdatePending() {
+			pm.Reason += " (but Steam is updating it)"
+			plan.Skipped = append(plan.Skipped, pm)
+			return
+		}
+		best := roomiest(app, ok)
+		if best == nil {
+			plan.Unplaced = append(plan.Unplaced, pm)
+			return
+		}
+		pm.To = best.Library
+		pool[best].FreeAfter -= pm.Size
+		pool[spaceFor[pm.From]].FreeAfter += pm.Size
+		where[app.AppNumber] = pm.To
+		plan.Moves = append(plan.Moves, pm)
+	}
+	isFast := func(ls *LibrarySpace) bool { return ls.Fast }
+	isSlow := func(ls *LibrarySpace) bool { return !ls.Fast }
+
+	apps := inst.SortedApps()
+	byLastPlayed := func(mostRecentFirst bool) []*InstalledApp {
+		ret := append([]*InstalledApp(nil), apps...)
+		sort.SliceStable(ret, func(i, j int) bool {
+			if mostRecentFirst {
+				return ret[i].LastPlayed.After(ret[j].LastPlayed)
+			}
+			return ret[i].LastPlayed.Before(ret[j].LastPlayed)
+		})
+		return ret
+	}
+
+	if haveFast {
+		for _, app := range byLastPlayed(false) {
+			if spaceFor[where[app.AppNumber]].Fast && !isRecent(app) {
+				move(app, isSlow, notPlayedSince(app))
+			}
+		}
+		for _, app := range byLastPlayed(true) {
+			if !spaceFor[where[app.AppNumber]].Fast && isRecent(app) {
+				move(app, isFast, fmt.Sprintf("played %s",
+					app.LastPlayed.Local().Format("2006-01-02")))
+			}
+		}
+	}
+
+	for _, ls := range plan.Space {
+		if pool[ls].FreeAfter >= policy.MinFreeSpace {
+			continue
+		}
+		for _, app := range byLastPlayed(false) {
+			if pool[ls].FreeAfter >= policy.MinFreeSpace {
+				break
+			}
+			if where[app.AppNumber] != ls.Library || considered[app.AppNumber] {
+				continue
+			}
+			speed := ls.Fast
+			ok := func(other *LibrarySpace) bool { return other.Fast == speed }
+			if speed && !app.UpdatePending() && !fits(app, ok) {
+				ok = isSlow
+			}
+			move(app, ok, "to keep free space in "+ls.Library)
+		}
+	}
+	for _, ls := range plan.Space {
+		ls.FreeAfter = pool[ls].FreeAfter
+	}
+	return plan, nil
+}
+
+// notPlayedSince explains why PlanPlacement moves an app to a slow library.
+//
+func notPlayedSince(app *InstalledApp) string {
+	if app.LastPlayed.IsZero() {
+		return "never played"
+	}
+	return fmt.Sprintf("not played since %s",
+		app.LastPlayed.Local().Format("2006-01-02"))
+}
@@ -0,0 +1,212 @@
+package steamfiles_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+var placementNow = time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+// placementApp describes an app for placementInstallation: where it is, its
+// SizeOnDisk, how many days ago it was last played (0 for never) and whether
+// Steam is updating it.
+//
+type placementApp struct {
+	n        steamfiles.AppNum
+	lib      string
+	size     int64
+	daysAgo  int
+	updating bool
+}
+
+// placementInstallation loads an in-memory installation with libraries in
+// /home/me/.steam/steam, /ssd and /hdd holding the given apps.
+//
+func placementInstallation(t *testing.T, apps ...placementApp) *steamfiles.Installation {
+	t.Helper()
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	libs := map[string]*steamtest.Library{
+		"home": h.InitialLibrary(),
+		"ssd":  h.AddLibrary("/ssd"),
+		"hdd":  h.AddLibrary("/hdd"),
+	}
+	for _, pa := range apps {
+		name := "App" + strconv.Itoa(int(pa.n))
+		a := libs[pa.lib].AddApp(pa.n, name, name).
+			SetField("SizeOnDisk", strconv.FormatInt(pa.size, 10))
+		if pa.daysAgo > 0 {
+			played := placementNow.AddDate(0, 0, -pa.daysAgo)
+			a.SetField("LastPlayed", strconv.FormatInt(played.Unix(), 10))
+		}
+		if pa.updating {
+			a.SetField("StateFlags", "6")
+		}
+	}
+	inst, err := h.Scanner(t).LoadInstallation(context.Background(),
+		&steamfiles.LoadOptions{NoBackups: true})
+	if err != nil {
+		t.Fatalf("LoadInstallation: %s", err)
+	}
+	return inst
+}
+
+// placementPolicy returns a policy with /ssd fast, apps played in the last 30
+// days counting as recent, and the given free space in each library.
+//
+func placementPolicy(minFree int64, free map[string]int64) *steamfiles.PlacementPolicy {
+	return &steamfiles.PlacementPolicy{
+		FastLibraries:  []string{"/ssd"},
+		RecentlyPlayed: 30 * 24 * time.Hour,
+		MinFreeSpace:   minFree,
+		Now:            placementNow,
+		FreeSpace: func(steamLibDir string) (int64, error) {
+			for lib, n := range free {
+				if steamLibDir == libDir(lib) {
+					return n, nil
+				}
+			}
+			return 0, nil
+		},
+	}
+}
+
+// libDir returns the "steamapps" directory of a library for
+// placementInstallation.
+//
+func libDir(lib string) string {
+	if lib == "home" {
+		return "/home/me/.steam/steam/steamapps"
+	}
+	return "/" + lib + "/steamapps"
+}
+
+// checkMoves checks the moves in a plan, given as (app, from, to) triples.
+//
+func checkMoves(t *testing.T, what string, moves []*steamfiles.PlannedMove,
+	want ...interface{}) {
+	t.Helper()
+	ok := len(moves) == len(want)/3
+	for i := 0; ok && i < len(moves); i++ {
+		m := moves[i]
+		ok = m.AppNumber == steamfiles.AppNum(want[3*i].(int)) &&
+			m.From == libDir(want[3*i+1].(string)) &&
+			(m.To == libDir(want[3*i+2].(string)) || m.To == "" && want[3*i+2] == "")
+	}
+	if !ok {
+		var got []string
+		for _, m := range moves {
+			got = append(got, strconv.Itoa(int(m.AppNumber))+": "+m.From+" → "+m.To)
+		}
+		t.Errorf("%s: got %q, want %v", what, got, want)
+	}
+}
+
+func TestPlanPlacementBySpeed(t *testing.T) {
+	inst := placementInstallation(t,
+		placementApp{n: 10, lib: "ssd", size: 100, daysAgo: 200},
+		placementApp{n: 11, lib: "ssd", size: 100},
+		placementApp{n: 12, lib: "ssd", size: 100, daysAgo: 2},
+		placementApp{n: 20, lib: "hdd", size: 300, daysAgo: 1},
+		placementApp{n: 21, lib: "home", size: 400, daysAgo: 5},
+		placementApp{n: 22, lib: "hdd", size: 300, daysAgo: 90},
+	)
+	plan, err := steamfiles.PlanPlacement(inst, placementPolicy(0,
+		map[string]int64{"home": 1000, "ssd": 450, "hdd": 2000}))
+	if err != nil {
+		t.Fatalf("PlanPlacement: %s", err)
+	}
+	// Never-played app 11 goes before app 10; both go to the roomier slow
+	// library.  That frees room in /ssd for app 20 (played most recently),
+	// but not for app 21 as well.
+	checkMoves(t, "by speed", plan.Moves,
+		11, "ssd", "hdd", 10, "ssd", "hdd", 20, "hdd", "ssd")
+	checkMoves(t, "by speed (unplaced)", plan.Unplaced, 21, "home", "")
+	for _, want := range []struct {
+		lib        string
+		fast       bool
+		free, left int64
+	}{
+		{"home", false, 1000, 1000},
+		{"ssd", true, 450, 350},
+		{"hdd", false, 2000, 2100},
+	} {
+		found := false
+		for _, ls := range plan.Space {
+			if ls.Library == libDir(want.lib) {
+				found = true
+				if ls.Fast != want.fast || ls.Free != want.free ||
+					ls.FreeAfter != want.left {
+					t.Errorf("space for %s is %+v, want %+v", want.lib, ls, want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("plan has no space for %s", want.lib)
+		}
+	}
+}
+
+func TestPlanPlacementFreeSpace(t *testing.T) {
+	inst := placementInstallation(t,
+		placementApp{n: 10, lib: "home", size: 300, daysAgo: 3},
+		placementApp{n: 11, lib: "home", size: 300, daysAgo: 100},
+		placementApp{n: 12, lib: "home", size: 300, daysAgo: 1},
+	)
+	policy := placementPolicy(500, map[string]int64{"home": 100, "hdd": 800, "ssd": 5000})
+	policy.FastLibraries = nil
+	plan, err := steamfiles.PlanPlacement(inst, policy)
+	if err != nil {
+		t.Fatalf("PlanPlacement: %s", err)
+	}
+	// The least recently played apps go to the roomiest library until the
+	// home library has 500 bytes free.
+	checkMoves(t, "free space", plan.Moves, 11, "home", "ssd", 10, "home", "ssd")
+	if len(plan.Unplaced) != 0 || len(plan.Skipped) != 0 {
+		t.Errorf("free space: unplaced %v, skipped %v", plan.Unplaced, plan.Skipped)
+	}
+
+	policy = placementPolicy(500, map[string]int64{"home": 600, "hdd": 800, "ssd": 5000})
+	policy.FastLibraries = nil
+	plan, err = steamfiles.PlanPlacement(inst, policy)
+	if err != nil {
+		t.Fatalf("PlanPlacement: %s", err)
+	}
+	if len(plan.Moves) != 0 {
+		t.Errorf("with enough space and no fast libraries, got moves %v", plan.Moves)
+	}
+}
+
+func TestPlanPlacementPlansEachAppOnce(t *testing.T) {
+	// /ssd is short of space, and its old apps belong in slow libraries,
+	// but those have no room; one of them is being updated.
+	inst := placementInstallation(t,
+		placementApp{n: 10, lib: "ssd", size: 300, daysAgo: 100},
+		placementApp{n: 11, lib: "ssd", size: 300, daysAgo: 200, updating: true},
+		placementApp{n: 12, lib: "ssd", size: 300, daysAgo: 1},
+	)
+	plan, err := steamfiles.PlanPlacement(inst, placementPolicy(500,
+		map[string]int64{"home": 500, "ssd": 100, "hdd": 600}))
+	if err != nil {
+		t.Fatalf("PlanPlacement: %s", err)
+	}
+	seen := make(map[steamfiles.AppNum]int)
+	for _, list := range [][]*steamfiles.PlannedMove{plan.Moves, plan.Unplaced,
+		plan.Skipped} {
+		for _, m := range list {
+			seen[m.AppNumber]++
+		}
+	}
+	for n, count := range seen {
+		if count > 1 {
+			t.Errorf("app %d appears %d times in the plan", n, count)
+		}
+	}
+	checkMoves(t, "once (skipped)", plan.Skipped, 11, "ssd", "")
+	// App 12 is only considered by the free-space pass.
+	checkMoves(t, "once (unplaced)", plan.Unplaced, 10, "ssd", "", 12, "ssd", "")
+}
@@ -0,0 +1,75 @@
+package steamfiles
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Depot manifests are protocol buffer messages.  This package needs to read
+// only a handful of fields from them, so rather than depend on a protobuf
+// library and compiled .proto files, we decode the wire format by hand.
+
+// Protobuf wire types:
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errBadProtobuf = errors.New("malformed protobuf data")
+
+// A protoField is one field from a protobuf message.  For wireBytes fields,
+// .bytes holds the data (which may be a string or an embedded message);
+// otherwise .num holds the value.
+//
+type protoField struct {
+	number   int
+	wireType int
+	num      uint64
+	bytes    []byte
+}
+
+// protoFields splits a protobuf message into its fields, calling fn for each
+// one in turn.  It stops at the first error.
+//
+func protoFields(msg []byte, fn func(f protoField) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errBadProtobuf
+		}
+		msg = msg[n:]
+		f := protoField{number: int(key >> 3), wireType: int(key & 7)}
+		switch f.wireType {
+		case wireVarint:
+			f.num, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errBadProtobuf
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errBadProtobuf
+			}
+			f.num, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errBadProtobuf
+			}
+			f.num, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errBadProtobuf
+			}
+			f.bytes, msg = msg[n:n+int(size)], msg[n+int(size):]
+		default:
+			return errBadProtobuf
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
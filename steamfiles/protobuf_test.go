@@ -0,0 +1,104 @@
+package steamfiles
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// pbVarint and pbBytes encode protobuf fields, for building test messages.
+//
+func pbVarint(field int, v uint64) []byte {
+	ret := appendUvarint(nil, uint64(field)<<3|wireVarint)
+	return appendUvarint(ret, v)
+}
+func pbBytes(field int, data []byte) []byte {
+	ret := appendUvarint(nil, uint64(field)<<3|wireBytes)
+	ret = appendUvarint(ret, uint64(len(data)))
+	return append(ret, data...)
+}
+
+// appendUvarint appends a varint to a byte slice.
+//
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// cat concatenates byte slices.
+//
+func cat(parts ...[]byte) []byte {
+	var ret []byte
+	for _, p := range parts {
+		ret = append(ret, p...)
+	}
+	return ret
+}
+
+func TestProtoFields(t *testing.T) {
+	msg := cat(
+		pbVarint(1, 300),
+		[]byte{2<<3 | wireFixed64, 1, 0, 0, 0, 0, 0, 0, 0x80},
+		[]byte{3<<3 | wireFixed32, 0x78, 0x56, 0x34, 0x12},
+		pbBytes(4, []byte("hello")),
+		pbBytes(5, nil),
+	)
+	var got []protoField
+	err := protoFields(msg, func(f protoField) error {
+		got = append(got, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("protoFields: %s", err)
+	}
+	want := []protoField{
+		{number: 1, wireType: wireVarint, num: 300},
+		{number: 2, wireType: wireFixed64, num: 0x8000000000000001},
+		{number: 3, wireType: wireFixed32, num: 0x12345678},
+		{number: 4, wireType: wireBytes, bytes: []byte("hello")},
+		{number: 5, wireType: wireBytes, bytes: []byte{}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.number != w.number || g.wireType != w.wireType || g.num != w.num ||
+			string(g.bytes) != string(w.bytes) {
+			t.Errorf("field #%d is %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestProtoFieldsMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  []byte
+	}{
+		{"truncated key varint", []byte{0x80}},
+		{"overlong key varint", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+			0xFF, 0xFF, 0xFF, 0x01}},
+		{"missing varint value", []byte{1 << 3}},
+		{"truncated varint value", []byte{1 << 3, 0xAC}},
+		{"short fixed64", []byte{1<<3 | wireFixed64, 1, 2, 3, 4, 5, 6, 7}},
+		{"short fixed32", []byte{1<<3 | wireFixed32, 1, 2, 3}},
+		{"missing length", []byte{1<<3 | wireBytes}},
+		{"truncated length", []byte{1<<3 | wireBytes, 0x80}},
+		{"length past the end", []byte{1<<3 | wireBytes, 4, 'a', 'b', 'c'}},
+		{"huge length", cat([]byte{1<<3 | wireBytes},
+			appendUvarint(nil, 1<<63), []byte("abc"))},
+		{"start group", []byte{1<<3 | 3}},
+		{"end group", []byte{1<<3 | 4}},
+		{"wire type 6", []byte{1<<3 | 6, 0}},
+		{"wire type 7", []byte{1<<3 | 7, 0}},
+		{"good field then garbage", cat(pbVarint(1, 1), []byte{0x80})},
+	} {
+		n := 0
+		err := protoFields(tc.msg, func(protoField) error { n++; return nil })
+		if err != errBadProtobuf {
+			t.Errorf("%s: protoFields gave %v, want errBadProtobuf", tc.name, err)
+		}
+		if tc.name != "good field then garbage" && n != 0 {
+			t.Errorf("%s: protoFields passed on %d fields", tc.name, n)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Functions for checking that apps have enough copies of their backups.
+
+package steamfiles
+
+import (
+	"context"
+	"sort"
+)
+
+// A RedundancyPolicy says how many up-to-date backups of each app
+// CheckRedundancy wants.  A nil *RedundancyPolicy means use the defaults,
+// which want two of every app.
+//
+type RedundancyPolicy struct {
+	// Copies is how many up-to-date backups each app needs, each on a
+	// different device (so losing one disk cannot lose them all); <= 0
+	// means 2.
+	Copies int
+	// Apps, if not nil, lists the apps the policy applies to.  The default
+	// is every installed app, including those in offline libraries.
+	Apps map[AppNum]bool
+}
+
+// A ReplicaStatus says how well an app is backed up, for CheckRedundancy.
+//
+type ReplicaStatus struct {
+	App             *InstalledApp `json:"-"`
+	AppNumber       AppNum        `json:"appid"`
+	AppName         string        `json:"name"`
+	Current         []*AppBackup  `json:"-"`       // Its up-to-date backups, newest first
+	Stale           []*AppBackup  `json:"-"`       // Its out-of-date ones, newest first
+	Devices         int           `json:"devices"` // How many devices hold Current
+	UnderReplicated bool          `json:"under_replicated"`
+	// Err, if not nil, is why some backups counted as Stale could not be
+	// compared with the app’s files.
+	Err error `json:"-"`
+}
+
+// CheckRedundancy counts, for each app a policy applies to, its up-to-date
+// backups in all of an Installation’s backups directories (all of
+// Installation.AllBackups, not just the preferred ones), and how many distinct
+// devices hold them.  An app with up-to-date backups on fewer than the policy’s
+// Copies devices is UnderReplicated; so is one whose backups are all stale.
+//
+// Devices are disks: backups on two partitions of one disk count as being on
+// one device.  The disk is found from /sys/dev/block on Linux; a RAID array or
+// LVM volume counts as one device however many disks it spans, and with a
+// FileSystem other than OSFileSystem, each file system (see FileIdentity) counts
+// as a device.
+//
+// A backup is up to date if the app’s manifest is no newer than it or, failing
+// that, none of the app’s files are (see AppNewerThanContext).  Apps in offline
+// libraries can only be checked by the LastUpdated time in their cached
+// manifests.  Backups on a FileSystem that cannot give device numbers count as
+// being on one device per backups directory.
+//
+// The result is sorted by AppNum.  CheckRedundancy only fails if ctx is done.
+//
+func CheckRedundancy(ctx context.Context, inst *Installation,
+	policy *RedundancyPolicy, opts *ScanOptions,
+) ([]*ReplicaStatus, error) {
+	if policy == nil {
+		policy = &RedundancyPolicy{}
+	}
+	copies := policy.Copies
+	if copies <= 0 {
+		copies = 2
+	}
+
+	apps := inst.SortedApps()
+	offline := make(map[*InstalledApp]bool)
+	for _, lib := range inst.Offline {
+		for _, app := range lib.Apps {
+			if _, online := inst.Apps[app.AppNumber]; !online {
+				apps = append(apps, app)
+				offline[app] = true
+			}
+		}
+	}
+	sort.SliceStable(apps, func(i, j int) bool {
+		return apps[i].AppNumber < apps[j].AppNumber
+	})
+
+	deviceOf := make(map[*AppBackup]interface{})
+	var ret []*ReplicaStatus
+	for _, app := range apps {
+		if policy.Apps != nil && !policy.Apps[app.AppNumber] {
+			continue
+		}
+		status := &ReplicaStatus{App: app, AppNumber: app.AppNumber,
+			AppName: app.AppName}
+
+		// Each backup is at least as up to date as any older one, so once
+		// one is stale the rest are too.
+		backups := append([]*AppBackup(nil), inst.BackupsOf(app.AppNumber)...)
+		sort.SliceStable(backups, func(i, j int) bool {
+			return backups[i].ModTime.After(backups[j].ModTime)
+		})
+		for i, b := range backups {
+			current := true
+			if offline[app] {
+				current = !app.LastUpdated.After(b.ModTime)
+			} else if app.ModTime.After(b.ModTime) {
+				newer, err := inst.scanner.AppNewerThanContext(ctx,
+					app.LibraryFolders[0], app.InstallDir, b.ModTime, opts)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				current = !newer && err == nil
+				status.Err = err
+			}
+			if !current {
+				status.Stale = backups[i:]
+				break
+			}
+			status.Current = append(status.Current, b)
+		}
+
+		devices := make(map[interface{}]bool)
+		for _, b := range status.Current {
+			dev, ok := deviceOf[b]
+			if !ok {
+				dev = inst.deviceOf(b)
+				deviceOf[b] = dev
+			}
+			devices[dev] = true
+		}
+		status.Devices = len(devices)
+		status.UnderReplicated = status.Devices < copies
+		ret = append(ret, status)
+	}
+	return ret, nil
+}
+
+// deviceOf returns something that tells apart the devices holding backups: a
+// disk’s device number (see DiskOf in diskspace_linux.go) or, if the FileSystem
+// cannot map file systems to disks, the file system’s, or if it cannot give
+// that either, the backups directory.
+//
+func (inst *Installation) deviceOf(b *AppBackup) interface{} {
+	if id, err := inst.scanner.FileIdentity(b.BackupPath); err == nil {
+		if d, ok := inst.scanner.fsys.(interface{ DiskOf(uint64) uint64 }); ok {
+			return d.DiskOf(id.Device)
+		}
+		return id.Device
+	}
+	if dir := inst.BackupsDirOf(b); dir != "" {
+		return dir
+	}
+	return b.BackupPath
+}
@@ -0,0 +1,75 @@
+package steamfiles_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+func TestCheckRedundancy(t *testing.T) {
+	updated := steamtest.DefaultTime.Add(48 * time.Hour)
+	before, after := steamtest.DefaultTime, updated.Add(24*time.Hour)
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	for n, name := range map[steamfiles.AppNum]string{
+		10: "Ten", 20: "Twenty", 30: "Thirty", 40: "Forty",
+	} {
+		h.InitialLibrary().AddApp(n, name, name).SetManifestTime(updated).
+			AddFile("game", "#!game", updated)
+	}
+	disk1, disk2 := h.AddBackupsDir("/disk1/backups"), h.AddBackupsDir("/disk2/backups")
+	disk1.AddBackup("Ten", 10).SetTime(after)
+	disk2.AddBackup("Ten", 10).SetTime(after)
+	disk1.AddBackup("Twenty", 20).SetTime(after)
+	disk2.AddBackup("Twenty", 20).SetTime(before)
+	disk1.AddBackup("Thirty", 30).SetTime(before)
+	disk2.AddBackup("Thirty", 30).SetTime(before)
+	inst, err := h.Scanner(t).LoadInstallation(context.Background(),
+		&steamfiles.LoadOptions{BackupsDirs: []string{"/disk1/backups",
+			"/disk2/backups"}})
+	if err != nil {
+		t.Fatalf("LoadInstallation: %s", err)
+	}
+
+	statuses, err := steamfiles.CheckRedundancy(context.Background(), inst, nil,
+		nil)
+	if err != nil {
+		t.Fatalf("CheckRedundancy: %s", err)
+	}
+	want := []struct {
+		app                     steamfiles.AppNum
+		current, stale, devices int
+		underReplicated         bool
+	}{
+		{10, 2, 0, 2, false},
+		{20, 1, 1, 1, true},
+		{30, 0, 2, 0, true}, // All stale
+		{40, 0, 0, 0, true}, // No backups
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(want))
+	}
+	for i, w := range want {
+		st := statuses[i]
+		if st.AppNumber != w.app || len(st.Current) != w.current ||
+			len(st.Stale) != w.stale || st.Devices != w.devices ||
+			st.UnderReplicated != w.underReplicated || st.Err != nil {
+			t.Errorf("app %d: got %d current, %d stale, on %d devices, "+
+				"under-replicated %v, err %v; want %+v", st.AppNumber, len(st.Current), len(st.Stale), st.Devices,
+				st.UnderReplicated, st.Err, w)
+		}
+	}
+
+	statuses, err = steamfiles.CheckRedundancy(context.Background(), inst,
+		&steamfiles.RedundancyPolicy{Copies: 1,
+			Apps: map[steamfiles.AppNum]bool{20: true}}, nil)
+	if err != nil {
+		t.Fatalf("CheckRedundancy: %s", err)
+	}
+	if len(statuses) != 1 || statuses[0].AppNumber != 20 ||
+		statuses[0].UnderReplicated {
+		t.Errorf("with one copy wanted of app 20, got %+v", statuses)
+	}
+}
@@ -0,0 +1,190 @@
+// The Scanner type, which owns the FileSystem and caches that this package’s
+// functions use.
+
+package steamfiles
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Scanner examines Steam files via a particular FileSystem, caching what it
+// learns along the way.  This package’s functions (ScanSteamLibDir, VerifyInstall
+// and so on) are all available as Scanner methods too; the package-level
+// versions use DefaultScanner().
+//
+// A Scanner is safe for concurrent use by multiple goroutines.
+//
+// At present the only cache is of the entries in each "…/steamapps/common" (or
+// "…/music") directory whose names had to be matched ignoring case (see
+// AppNewerThan).  A Scanner re-reads such a directory if a name is not found in
+// its cached entries, so newly installed apps are seen, but callers that know
+// things have changed (fx, a long-running process that has just moved or
+// deleted apps) can call Invalidate, InvalidateAll or Refresh.
+//
+type Scanner struct {
+	// SteamHomeOverride, if not empty, is used instead of the package-level
+	// SteamHomeOverride by this Scanner.  It should be set before the Scanner
+	// is first used.
+	SteamHomeOverride string
+	// DriveMounts, if not nil, is used instead of the package-level
+	// DriveMounts by this Scanner.
+	DriveMounts map[string]string
+
+	fsys FileSystem
+
+	mu               sync.Mutex
+	namesCacheForDir map[string]map[string]string
+}
+
+// NewScanner returns a Scanner that uses fsys, or OSFileSystem if fsys is nil.
+//
+func NewScanner(fsys FileSystem) *Scanner {
+	if fsys == nil {
+		fsys = OSFileSystem
+	}
+	return &Scanner{fsys: fsys}
+}
+
+// std is the Scanner used by this package’s functions.
+//
+var std = NewScanner(nil)
+
+// DefaultScanner returns the Scanner that this package’s functions use.
+//
+func DefaultScanner() *Scanner {
+	return std
+}
+
+// FileSystem returns the FileSystem that a Scanner uses.
+//
+func (s *Scanner) FileSystem() FileSystem {
+	return s.fsys
+}
+
+// Invalidate discards anything a Scanner has cached about a directory.
+//
+func (s *Scanner) Invalidate(dirPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.namesCacheForDir, filepath.Clean(dirPath))
+}
+
+// InvalidateAll discards everything a Scanner has cached.
+//
+func (s *Scanner) InvalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.namesCacheForDir = nil
+}
+
+// Refresh re-reads every directory a Scanner has cached details of, discarding
+// any that can no longer be read.  It returns the first error it encounters
+// (in sorted order of pathnames), having refreshed everything it could.
+//
+func (s *Scanner) Refresh() error {
+	s.mu.Lock()
+	dirs := make([]string, 0, len(s.namesCacheForDir))
+	for dirPath := range s.namesCacheForDir {
+		dirs = append(dirs, dirPath)
+	}
+	s.mu.Unlock()
+	sort.Strings(dirs)
+
+	var firstErr error
+	for _, dirPath := range dirs {
+		mapForDir, err := s.scanDirIgnoringCase(dirPath)
+		s.mu.Lock()
+		if err != nil {
+			delete(s.namesCacheForDir, dirPath)
+		} else if s.namesCacheForDir != nil {
+			s.namesCacheForDir[dirPath] = mapForDir
+		}
+		s.mu.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+/*--------------------- Finding names regardless of case ---------------------*/
+
+// On Linux, a Scanner caches the entry names in each "<SLF>/steamapps/common"
+// directory it encounters in namesCacheForDir, which maps each "…/common"
+// directory path to a second-level map from monocase(entryName) to entryName.
+//
+// On Windows and Mac, findIgnoringCase() never gets called (unless something is
+// badly amiss with the files in …/steamapps/ or …/music), so the cache stays
+// empty.
+
+// findIgnoringCase(dirPath, wrongName) uses the name-case-correction-map for dirPath
+// (which must be of the form "/…/steamapps/common/") to find the correct form of
+// a wrongly-cased name, building the maps as necessary.
+//
+// If the name is not in a cached map, findIgnoringCase re-reads the directory
+// once, in case the app was installed since the map was built.
+//
+func (s *Scanner) findIgnoringCase(dirPath, wrongName string) (string, error) {
+	dirPath = filepath.Clean(dirPath)
+	s.mu.Lock()
+	mapForDir := s.namesCacheForDir[dirPath]
+	s.mu.Unlock()
+
+	mappedName, haveMappedName := mapForDir[monocase(wrongName)]
+	if !haveMappedName {
+		var err error
+		mapForDir, err = s.scanDirIgnoringCase(dirPath)
+		if err != nil {
+			return "", err
+		}
+		s.mu.Lock()
+		if s.namesCacheForDir == nil {
+			s.namesCacheForDir = make(map[string]map[string]string)
+		}
+		s.namesCacheForDir[dirPath] = mapForDir
+		s.mu.Unlock()
+		mappedName, haveMappedName = mapForDir[monocase(wrongName)]
+	}
+	if !haveMappedName {
+		return "", cannot("find app, even ignoring case", "",
+			filepath.Join(dirPath, wrongName), os.ErrNotExist)
+	}
+	//D// fmt.Printf("#D# namesCacheForDir[%q][%q] = %q\n",
+	//D//	dirPath, monocase(wrongName), mappedName)
+	return filepath.Join(dirPath, mappedName), nil
+}
+
+// scanDirIgnoringCase is the directory scanner for findIgnoringCase.
+//
+func (s *Scanner) scanDirIgnoringCase(dirPath string) (map[string]string, error) {
+	ret := make(map[string]string)
+
+	names, err := s.readDirNames(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	//B// startTime := time.Now()
+	for _, n := range names {
+		ret[monocase(n)] = n
+	}
+	//B// duration := time.Since(startTime)
+	//B// fmt.Printf("#B# monocasing %d names in dir %q took %s\n",
+	//B//	len(names), dirPath, duration)
+	return ret, nil
+}
+
+// I considered making this faster by only upcasing ASCII a-z, since non-ASCII
+// letters are not found (or at least very rare) in app install directory names.
+// But a little benchmarking showed that using strings.ToUpper() took < 1ms with
+// over 500 titles, which is plenty good enough.
+
+// monocase(s) returns the uppercased form of s.
+//
+func monocase(s string) string {
+	return strings.ToUpper(s)
+}
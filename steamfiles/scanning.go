@@ -0,0 +1,202 @@
+// Support for concurrent, cancellable scanning of Steam library folders, backup
+// directories and install trees.
+
+package steamfiles
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultScanWorkers is how many files or directories the scanning functions
+// examine at once when ScanOptions.Workers is not set.  It is deliberately
+// modest: more than a few concurrent reads make spinning disks slower, not
+// faster, although NAS mounts and SSDs may benefit from more.
+//
+const DefaultScanWorkers = 4
+
+// A ScanProgress reports how much work a scan has done so far.
+//
+type ScanProgress struct {
+	Files int64 // How many files have been examined
+	Bytes int64 // The total size of those files
+}
+
+// A ScanProgressReporter is a callback that the …Context scanning functions
+// call each time they finish with a file (or, for install trees, a directory).
+// Calls are never concurrent, and the counts never go down, but the files may
+// be visited in any order.
+//
+type ScanProgressReporter func(ScanProgress)
+
+// ScanOptions controls the …Context scanning functions.  A nil *ScanOptions
+// means use the defaults.
+//
+type ScanOptions struct {
+	Workers  int                  // Maximum concurrent reads; <= 0 means DefaultScanWorkers
+	Progress ScanProgressReporter // Called as the scan proceeds, if not nil
+}
+
+/*-------------------------------- scanState ---------------------------------*/
+
+// A scanState holds what one call of a …Context function needs: its context,
+// its worker limit and its progress counts.
+//
+type scanState struct {
+	ctx        context.Context
+	workers    int
+	progress   ScanProgressReporter
+	progressMu sync.Mutex
+	counts     ScanProgress
+}
+
+func newScanState(ctx context.Context, opts *ScanOptions) *scanState {
+	s := &scanState{ctx: ctx, workers: DefaultScanWorkers}
+	if opts != nil {
+		if opts.Workers > 0 {
+			s.workers = opts.Workers
+		}
+		s.progress = opts.Progress
+	}
+	return s
+}
+
+// visited records that some files have been examined, and tells the caller’s
+// progress reporter (if any).
+//
+func (s *scanState) visited(files, bytes int64) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	s.counts.Files += files
+	s.counts.Bytes += bytes
+	if s.progress != nil {
+		s.progress(s.counts)
+	}
+}
+
+// forEach calls fn(i) for each i in [0, n), using up to s.workers goroutines.
+// It stops starting new calls once the context is done, and then returns the
+// context’s error.  Since fn may be called concurrently, it should store its
+// results by index, leaving the caller to combine them in order afterwards.
+//
+func (s *scanState) forEach(n int, fn func(i int)) error {
+	workers := s.workers
+	if workers > n {
+		workers = n
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for s.ctx.Err() == nil {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+	return s.ctx.Err()
+}
+
+/*-------------------------------- Tree walks --------------------------------*/
+
+// walkTreeParallel calls visitDir for root and every directory under it, using
+// up to s.workers goroutines.  visitDir returns the subdirectories to visit
+// next and whether to stop the whole walk early.
+//
+// If visitDir returns errors, walkTreeParallel carries on with the other
+// directories, then returns the error for the directory that a serial walk in
+// lexical order would have reached first; that way the result does not depend
+// on scheduling.  It returns the context’s error if the context is done before
+// the walk finishes, unless visitDir asked to stop.
+//
+func (s *scanState) walkTreeParallel(
+	root string, visitDir func(dirPath string) ([]string, bool, error),
+) (stopped bool, err error) {
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   = []string{root}
+		pending = 1 // Directories queued or being visited
+		errPath string
+		walkErr error
+	)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			mu.Lock()
+			cond.Broadcast()
+			mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	worker := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(queue) == 0 && pending > 0 && !stopped && s.ctx.Err() == nil {
+				cond.Wait()
+			}
+			if pending == 0 || stopped || s.ctx.Err() != nil {
+				return
+			}
+			dir := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+
+			mu.Unlock()
+			subdirs, stop, err := visitDir(dir)
+			mu.Lock()
+
+			if err != nil && (walkErr == nil || walkOrderLess(dir, errPath)) {
+				errPath, walkErr = dir, err
+			}
+			if stop {
+				stopped = true
+			}
+			queue = append(queue, subdirs...)
+			pending += len(subdirs) - 1
+			cond.Broadcast()
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(s.workers)
+	for w := 0; w < s.workers; w++ {
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case stopped:
+		return true, nil
+	case s.ctx.Err() != nil:
+		return false, s.ctx.Err()
+	}
+	return false, walkErr
+}
+
+// walkOrderLess reports whether a serial, lexically-ordered walk of a tree
+// would reach pathname a before pathname b.  (Plain string comparison gets this
+// wrong for names with characters that sort before the separator, such as
+// "a b" versus "a/b".)
+//
+func walkOrderLess(a, b string) bool {
+	toKey := func(p string) string {
+		return strings.ReplaceAll(filepath.ToSlash(p), "/", "\x00")
+	}
+	return toKey(a) < toKey(b)
+}
@@ -0,0 +1,59 @@
+// Functions for telling whether Steam is running.
+
+package steamfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procRoot is where SteamRunning looks for processes; tests change it.
+//
+var procRoot = "/proc"
+
+// steamProcessNames are the command names (as in /proc/<pid>/comm) of the
+// Steam client’s processes.
+//
+var steamProcessNames = map[string]bool{"steam": true, "steamwebhelper": true}
+
+// SteamRunning reports whether the Steam client seems to be running for the
+// current user, going by the command names of the user’s processes in /proc.
+//
+// It does not use the steam.pid files that Steam writes (and leaves behind when
+// it exits): there is one per flavour of Steam (native, Flatpak, Snap), and a
+// Flatpak Steam has its own PID namespace, so the PID it writes is not that of
+// any process we can see.  For the same reason SteamRunning cannot tell which
+// installation a Steam process belongs to, so steamHome is not used at present;
+// any Steam client counts.
+//
+// Programs that change the files in a Steam library should check this first,
+// because Steam rewrites manifests and libraryfolders.vdf as it pleases.
+//
+func SteamRunning(steamHome string) bool {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return false
+	}
+	uid := os.Getuid()
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue // Not a process, eg /proc/self or /proc/sys
+		}
+		procDir := filepath.Join(procRoot, e.Name())
+		comm, err := os.ReadFile(filepath.Join(procDir, "comm"))
+		if err != nil || !steamProcessNames[strings.TrimSpace(string(comm))] {
+			continue // Gone already, or not Steam
+		}
+		if info, err := os.Stat(procDir); err == nil {
+			st, ok := info.Sys().(*syscall.Stat_t)
+			if ok && int(st.Uid) != uid {
+				continue // Someone else’s Steam
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package steamfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeProc makes SteamRunning look in a temporary directory holding processes
+// with the given command names (PIDs 100, 101, …) until the test finishes.
+//
+func fakeProc(t *testing.T, comms ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for i, comm := range comms {
+		dir := filepath.Join(root, strconv.Itoa(100+i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = prev })
+	return root
+}
+
+// FakeSteamRunning makes SteamRunning report that Steam is (or is not) running
+// until the test finishes, for the tests in package steamfiles_test.
+//
+func FakeSteamRunning(t *testing.T, running bool) {
+	t.Helper()
+	if running {
+		fakeProc(t, "steam")
+	} else {
+		fakeProc(t)
+	}
+}
+
+func TestSteamRunning(t *testing.T) {
+	for _, tc := range []struct {
+		comms []string
+		want  bool
+	}{
+		{nil, false},
+		{[]string{"systemd", "bash"}, false},
+		{[]string{"bash", "steam"}, true},
+		{[]string{"steamwebhelper"}, true},
+		{[]string{"steam-move", "steam-backups", "steam-fsck"}, false},
+		{[]string{"Steam", "steamtinkerlau", "xsteam", "steam.sh"}, false},
+	} {
+		fakeProc(t, tc.comms...)
+		if got := SteamRunning("/home/me/.steam/steam"); got != tc.want {
+			t.Errorf("SteamRunning with processes %q = %v, want %v", tc.comms, got,
+				tc.want)
+		}
+	}
+}
+
+func TestSteamRunningIgnoresNonProcesses(t *testing.T) {
+	root := fakeProc(t, "bash")
+	for _, name := range []string{"self", "thread-self"} {
+		dir := filepath.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "comm"), []byte("steam\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if SteamRunning("/home/me/.steam/steam") {
+		t.Errorf("SteamRunning counted /proc/self as a process")
+	}
+}
+
+func TestSteamRunningWithoutProc(t *testing.T) {
+	fakeProc(t)
+	procRoot = filepath.Join(procRoot, "missing")
+	if SteamRunning("/home/me/.steam/steam") {
+		t.Errorf("SteamRunning reported Steam running without a /proc")
+	}
+}
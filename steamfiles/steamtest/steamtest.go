@@ -0,0 +1,729 @@
+// Package steamtest builds synthetic Steam installations, for testing code that
+// uses package steamfiles.
+//
+// A test describes an installation with a Home and the things added to it
+// (library folders, apps, install trees, backups and users), then has it
+// written out, either to a directory (typically a temporary one) or to an
+// in-memory fstest.MapFS:
+//
+//	h := steamtest.NewHome("/home/me/.steam/steam")
+//	h.InitialLibrary().AddApp(230070, "The Age of Decadence", "AgeOfDecadence").
+//		AddFile("AgeOfDecadence.x86_64", "#!", steamtest.DefaultTime)
+//	h.AddLibrary("/media/games/SteamLibrary").AddApp(201310, "X3: Albion Prelude", "x3 terran conflict")
+//	h.AddBackupsDir("/media/backups").AddBackup("The Age of Decadence", 230070).UseDisks(2)
+//	h.InstallFS(t) // or h.Install(t) to use a temporary directory
+//
+// Pathnames given to a Home and its parts are absolute pathnames within the
+// synthetic tree.  When the tree is written to a directory D, a pathname P
+// becomes D/P, and the VDF files that mention pathnames are written to match.
+//
+package steamtest // import "github.com/c12h/steam-stuff/steamfiles/steamtest"
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/c12h/steam-stuff/sVDF"
+	"github.com/c12h/steam-stuff/steamfiles"
+)
+
+type (
+	AppNum         = steamfiles.AppNum
+	DepotNum       = steamfiles.DepotNum
+	ManifestID     = steamfiles.ManifestID
+	WorkshopItemID = steamfiles.WorkshopItemID
+)
+
+// DefaultTime is the modification time given to files for which a test does
+// not specify one.
+//
+var DefaultTime = time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// A LibraryFoldersFormat selects which format of libraryfolders.vdf to write.
+//
+type LibraryFoldersFormat int
+
+const (
+	// NewLibraryFolders is the format Steam has used since mid-2021: an NVL
+	// for each SLF (including the initial one) with "path" and "apps".
+	NewLibraryFolders LibraryFoldersFormat = iota
+	// OldLibraryFolders is the older format: the pathnames of the other
+	// SLFs as string values "1", "2", etc.
+	OldLibraryFolders
+)
+
+/*=================================== Home ===================================*/
+
+// A Home describes a synthetic Steam installation.
+//
+type Home struct {
+	Path        string               // The Steam home directory (the initial SLF)
+	Format      LibraryFoldersFormat // Which format of libraryfolders.vdf to write
+	libraries   []*Library
+	backupsDirs []*BackupsDir
+	users       []*User
+	extraFiles  map[string]treeFile
+}
+
+// NewHome starts the description of a Steam installation whose home directory
+// is at path.
+//
+func NewHome(path string) *Home {
+	h := &Home{Path: path, extraFiles: make(map[string]treeFile)}
+	h.libraries = []*Library{{home: h, Path: path}}
+	return h
+}
+
+// InitialLibrary returns the Library for the Steam home directory itself.
+//
+func (h *Home) InitialLibrary() *Library {
+	return h.libraries[0]
+}
+
+// AddLibrary adds a further Steam Library Folder.
+//
+func (h *Home) AddLibrary(path string) *Library {
+	l := &Library{home: h, Path: path}
+	h.libraries = append(h.libraries, l)
+	return l
+}
+
+// AddBackupsDir adds a directory to hold Steam backups.
+//
+func (h *Home) AddBackupsDir(path string) *BackupsDir {
+	d := &BackupsDir{Path: path}
+	h.backupsDirs = append(h.backupsDirs, d)
+	return d
+}
+
+// AddUser adds a Steam user, with a userdata/<id>/config/localconfig.vdf file.
+//
+func (h *Home) AddUser(id uint32, personaName string) *User {
+	u := &User{ID: id, PersonaName: personaName}
+	h.users = append(h.users, u)
+	return u
+}
+
+// AddFile adds an arbitrary file anywhere in the tree, for cases the other
+// methods do not cover (fx, malformed VDF files).
+//
+func (h *Home) AddFile(path, contents string, modTime time.Time) *Home {
+	h.extraFiles[path] = treeFile{data: []byte(contents), modTime: modTime}
+	return h
+}
+
+/*================================= Library ==================================*/
+
+// A Library describes a Steam Library Folder.
+//
+type Library struct {
+	Path    string // The SLF (not its "steamapps" subdirectory)
+	Missing bool   // If true, list the SLF in libraryfolders.vdf but do not create it
+	home    *Home
+	apps    []*App
+}
+
+// AddApp adds an installed app, with an appmanifest_<AppNum>.acf file and an
+// (initially empty) directory steamapps/common/<installDir>.
+//
+func (l *Library) AddApp(appNum AppNum, name, installDir string) *App {
+	a := &App{
+		AppNumber:    appNum,
+		Name:         name,
+		InstallDir:   installDir,
+		ManifestTime: DefaultTime,
+		Fields:       map[string]string{"StateFlags": "4"},
+		files:        make(map[string]treeFile)}
+	l.apps = append(l.apps, a)
+	return a
+}
+
+// SteamAppsDir returns the pathname of the SLF’s "steamapps" directory.
+//
+func (l *Library) SteamAppsDir() string {
+	return filepath.Join(l.Path, "steamapps")
+}
+
+/*=================================== App ====================================*/
+
+// An App describes an installed app.
+//
+type App struct {
+	AppNumber    AppNum
+	Name         string
+	InstallDir   string
+	ManifestTime time.Time         // The appmanifest_<AppNum>.acf file’s mtime
+	Fields       map[string]string // Extra "AppState" entries (StateFlags="4" by default)
+	NoInstallDir bool              // If true, do not create common/<InstallDir>
+	depots       []appDepot
+	files        map[string]treeFile
+	workshop     map[WorkshopItemID]map[string]treeFile
+}
+
+type appDepot struct {
+	depot    DepotNum
+	manifest ManifestID
+	size     int64
+}
+
+// SetField sets an entry in the app’s manifest, such as "StateFlags" or
+// "LastPlayed".
+//
+func (a *App) SetField(name, value string) *App {
+	a.Fields[name] = value
+	return a
+}
+
+// SetManifestTime sets the modification time of the app’s manifest.
+//
+func (a *App) SetManifestTime(t time.Time) *App {
+	a.ManifestTime = t
+	return a
+}
+
+// AddDepot adds an entry to the manifest’s "InstalledDepots" section.
+//
+func (a *App) AddDepot(depot DepotNum, manifest ManifestID, size int64) *App {
+	a.depots = append(a.depots, appDepot{depot, manifest, size})
+	return a
+}
+
+// AddFile adds a file to the app’s install tree.  The pathname is relative to
+// common/<InstallDir> and uses '/' as separator.
+//
+func (a *App) AddFile(relPath, contents string, modTime time.Time) *App {
+	a.files[relPath] = treeFile{data: []byte(contents), modTime: modTime}
+	return a
+}
+
+// AddDir adds an (empty) directory to the app’s install tree.
+//
+func (a *App) AddDir(relPath string) *App {
+	a.files[relPath] = treeFile{isDir: true, modTime: DefaultTime}
+	return a
+}
+
+// AddWorkshopFile adds a file to one of the app’s Workshop items, creating the
+// item (and the app’s appworkshop_<AppNum>.acf file) if need be.  The pathname
+// is relative to workshop/content/<AppNum>/<id> and uses '/' as separator.
+// The item’s "timeupdated" is the newest of its files’ mtimes.
+//
+func (a *App) AddWorkshopFile(id WorkshopItemID, relPath, contents string,
+	modTime time.Time,
+) *App {
+	if a.workshop == nil {
+		a.workshop = make(map[WorkshopItemID]map[string]treeFile)
+	}
+	if a.workshop[id] == nil {
+		a.workshop[id] = make(map[string]treeFile)
+	}
+	a.workshop[id][relPath] = treeFile{data: []byte(contents), modTime: modTime}
+	return a
+}
+
+// sizeOnDisk returns the total size of the files added to the app.
+//
+func (a *App) sizeOnDisk() int64 {
+	var total int64
+	for _, f := range a.files {
+		total += int64(len(f.data))
+	}
+	return total
+}
+
+/*================================ Backups ===================================*/
+
+// A BackupsDir describes a directory holding Steam backups.
+//
+type BackupsDir struct {
+	Path    string
+	backups []*Backup
+}
+
+// AddBackup adds a backup of one or more apps, in the ‘single directory’
+// layout unless UseDisks is called.
+//
+func (d *BackupsDir) AddBackup(name string, apps ...AppNum) *Backup {
+	b := &Backup{Name: name, Apps: apps, SKUTime: DefaultTime}
+	d.backups = append(d.backups, b)
+	return b
+}
+
+// A Backup describes a Steam backup.
+//
+type Backup struct {
+	Name     string    // The backup’s directory name, also used as its "name"
+	Apps     []AppNum  // The apps in the backup
+	NumDisks int       // 0 for the single-directory layout, else how many Disk_<N>
+	SKUTime  time.Time // The sku.sis files’ mtime
+	depots   []backupDepot
+}
+
+type backupDepot struct {
+	depot    DepotNum
+	manifest ManifestID
+	nChunks  int
+}
+
+// UseDisks selects the Disk_1 … Disk_<n> layout.
+//
+func (b *Backup) UseDisks(n int) *Backup {
+	b.NumDisks = n
+	return b
+}
+
+// SetTime sets the modification time of the backup’s sku.sis files.
+//
+func (b *Backup) SetTime(t time.Time) *Backup {
+	b.SKUTime = t
+	return b
+}
+
+// AddDepot adds a depot to the backup, with one chunk store on each disk
+// holding nChunks (dummy) chunks in total.
+//
+func (b *Backup) AddDepot(depot DepotNum, manifest ManifestID, nChunks int) *Backup {
+	b.depots = append(b.depots, backupDepot{depot, manifest, nChunks})
+	return b
+}
+
+/*================================== Users ===================================*/
+
+// A User describes a Steam user with a userdata/<ID> directory.
+//
+type User struct {
+	ID          uint32
+	PersonaName string
+}
+
+/*============================ Writing the tree ==============================*/
+
+// A treeFile is a file (or directory) to be created.
+//
+type treeFile struct {
+	data    []byte
+	modTime time.Time
+	isDir   bool
+}
+
+// MapFS returns the synthetic installation as an in-memory file system, with
+// the tree’s pathnames minus their leading '/'.  (This is the mapping that
+// steamfiles.FromFS expects.)  It fails the test if the tree is inconsistent.
+//
+func (h *Home) MapFS(t testing.TB) fstest.MapFS {
+	t.Helper()
+	files, err := h.render("/")
+	if err != nil {
+		t.Fatalf("steamtest: cannot build synthetic Steam tree: %s", err)
+	}
+	ret := make(fstest.MapFS, len(files))
+	for path, f := range files {
+		mf := &fstest.MapFile{Data: f.data, ModTime: f.modTime, Mode: 0644}
+		if f.isDir {
+			mf.Mode = os.ModeDir | 0755
+		}
+		ret[strings.TrimPrefix(filepath.ToSlash(path), "/")] = mf
+	}
+	return ret
+}
+
+// FileSystem returns the synthetic installation as a steamfiles.FileSystem.
+//
+func (h *Home) FileSystem(t testing.TB) steamfiles.FileSystem {
+	t.Helper()
+	return steamfiles.FromFS(h.MapFS(t))
+}
+
+// Scanner returns a steamfiles.Scanner for the synthetic installation, held in
+// memory and used as its Steam home.  Unlike InstallFS, this leaves steamfiles’
+// package-level functions alone, so tests using it can run in parallel.
+//
+func (h *Home) Scanner(t testing.TB) *steamfiles.Scanner {
+	t.Helper()
+	s := steamfiles.NewScanner(h.FileSystem(t))
+	s.SteamHomeOverride = h.Path
+	return s
+}
+
+// WriteDir writes the synthetic installation to real files under root, which
+// should be an empty directory.
+//
+func (h *Home) WriteDir(root string) error {
+	files, err := h.render(root)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f := files[path]
+		if f.isDir {
+			err = os.MkdirAll(path, 0755)
+		} else {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = os.WriteFile(path, f.data, 0644)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Set the mtimes afterwards, deepest first, since creating files changes
+	// their directories’ mtimes.
+	for i := len(paths) - 1; i >= 0; i-- {
+		t := files[paths[i]].modTime
+		if err := os.Chtimes(paths[i], t, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Install writes the synthetic installation to a temporary directory and makes
+// steamfiles use it as the Steam home (via steamfiles.SteamHomeOverride) until
+// the test finishes.  It returns the temporary directory, so that the test can
+// find the real pathnames.
+//
+func (h *Home) Install(t testing.TB) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := h.WriteDir(root); err != nil {
+		t.Fatalf("steamtest: cannot write synthetic Steam tree: %s", err)
+	}
+	prevOverride := steamfiles.SteamHomeOverride
+	steamfiles.SteamHomeOverride = filepath.Join(root, h.Path)
+	t.Cleanup(func() { steamfiles.SteamHomeOverride = prevOverride })
+	return root
+}
+
+// InstallFS makes steamfiles use the synthetic installation, held in memory,
+// as its file system and Steam home until the test finishes.
+//
+func (h *Home) InstallFS(t testing.TB) {
+	t.Helper()
+	prevOverride := steamfiles.SteamHomeOverride
+	steamfiles.UseFileSystem(h.FileSystem(t))
+	steamfiles.SteamHomeOverride = h.Path
+	t.Cleanup(func() {
+		steamfiles.UseFileSystem(nil)
+		steamfiles.SteamHomeOverride = prevOverride
+	})
+}
+
+// render works out every file and directory in the tree, with pathnames
+// prefixed by root.
+//
+func (h *Home) render(root string) (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	at := func(path string) string { return filepath.Join(root, path) }
+	addDir := func(path string) {
+		for p := path; p != root && p != filepath.Dir(p); p = filepath.Dir(p) {
+			if _, have := files[p]; have {
+				break
+			}
+			files[p] = treeFile{isDir: true, modTime: DefaultTime}
+		}
+	}
+	addFile := func(path string, f treeFile) {
+		addDir(filepath.Dir(path))
+		files[path] = f
+	}
+	addVDF := func(path, topName string, topValue sVDF.NamesValuesList, t time.Time) error {
+		var buf bytes.Buffer
+		if err := sVDF.Write(&buf, topName, topValue); err != nil {
+			return err
+		}
+		addFile(path, treeFile{data: buf.Bytes(), modTime: t})
+		return nil
+	}
+
+	// Library folders, their apps and libraryfolders.vdf.
+	libraryFolders := sVDF.NamesValuesList{}
+	if h.Format == OldLibraryFolders {
+		libraryFolders["TimeNextStatsReport"] = "0"
+		libraryFolders["ContentStatsID"] = "0"
+	} else {
+		libraryFolders["contentstatsid"] = "0"
+	}
+	for i, l := range h.libraries {
+		appSizes := sVDF.NamesValuesList{}
+		for _, a := range l.apps {
+			appSizes[itoa(a.AppNumber)] = strconv.FormatInt(a.sizeOnDisk(), 10)
+		}
+		switch {
+		case h.Format == NewLibraryFolders:
+			libraryFolders[strconv.Itoa(i)] = sVDF.NamesValuesList{
+				"path":      at(l.Path),
+				"label":     "",
+				"contentid": "0",
+				"totalsize": "0",
+				"apps":      appSizes}
+		case i > 0:
+			libraryFolders[strconv.Itoa(i)] = at(l.Path)
+		}
+		if l.Missing {
+			continue
+		}
+		addDir(at(l.SteamAppsDir()))
+		for _, a := range l.apps {
+			if err := h.renderApp(l, a, at, addDir, addFile, addVDF); err != nil {
+				return nil, err
+			}
+		}
+	}
+	topName := "libraryfolders"
+	if h.Format == OldLibraryFolders {
+		topName = "LibraryFolders"
+	}
+	err := addVDF(filepath.Join(at(h.InitialLibrary().SteamAppsDir()), "libraryfolders.vdf"),
+		topName, libraryFolders, DefaultTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Backups.
+	for _, d := range h.backupsDirs {
+		addDir(at(d.Path))
+		for _, b := range d.backups {
+			if err := renderBackup(filepath.Join(at(d.Path), b.Name), b,
+				addFile, addVDF); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Users.
+	for _, u := range h.users {
+		configPath := filepath.Join(at(h.Path), "userdata",
+			strconv.FormatUint(uint64(u.ID), 10), "config", "localconfig.vdf")
+		err := addVDF(configPath, "UserLocalConfigStore", sVDF.NamesValuesList{
+			"friends": sVDF.NamesValuesList{"PersonaName": u.PersonaName}},
+			DefaultTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for path, f := range h.extraFiles {
+		addFile(at(path), f)
+	}
+	return files, nil
+}
+
+// renderApp adds an app’s manifest and install tree.
+//
+func (h *Home) renderApp(l *Library, a *App,
+	at func(string) string,
+	addDir func(string),
+	addFile func(string, treeFile),
+	addVDF func(string, string, sVDF.NamesValuesList, time.Time) error,
+) error {
+	appState := sVDF.NamesValuesList{
+		"appid":              itoa(a.AppNumber),
+		"name":               a.Name,
+		"installdir":         a.InstallDir,
+		"LastUpdated":        strconv.FormatInt(a.ManifestTime.Unix(), 10),
+		"SizeOnDisk":         strconv.FormatInt(a.sizeOnDisk(), 10),
+		"AutoUpdateBehavior": "0"}
+	for k, v := range a.Fields {
+		appState[k] = v
+	}
+	if len(a.depots) > 0 {
+		depots := sVDF.NamesValuesList{}
+		for _, d := range a.depots {
+			depots[itoa(d.depot)] = sVDF.NamesValuesList{
+				"manifest": strconv.FormatUint(uint64(d.manifest), 10),
+				"size":     strconv.FormatInt(d.size, 10)}
+		}
+		appState["InstalledDepots"] = depots
+	}
+	steamapps := at(l.SteamAppsDir())
+	err := addVDF(filepath.Join(steamapps, fmt.Sprintf("appmanifest_%d.acf", a.AppNumber)),
+		"AppState", appState, a.ManifestTime)
+	if err != nil {
+		return err
+	}
+
+	if err := renderWorkshop(steamapps, a, addFile, addVDF); err != nil {
+		return err
+	}
+
+	if a.NoInstallDir {
+		return nil
+	}
+	installDir := filepath.Join(steamapps, "common", a.InstallDir)
+	addDir(installDir)
+	for rel, f := range a.files {
+		path := filepath.Join(installDir, filepath.FromSlash(rel))
+		if f.isDir {
+			addDir(path)
+		} else {
+			addFile(path, f)
+		}
+	}
+	return nil
+}
+
+// renderWorkshop adds an app’s appworkshop_<AppNum>.acf file and Workshop
+// content, if it has any.
+//
+func renderWorkshop(steamapps string, a *App,
+	addFile func(string, treeFile),
+	addVDF func(string, string, sVDF.NamesValuesList, time.Time) error,
+) error {
+	if len(a.workshop) == 0 {
+		return nil
+	}
+	contentDir := filepath.Join(steamapps, "workshop", "content", itoa(a.AppNumber))
+	installed, details := sVDF.NamesValuesList{}, sVDF.NamesValuesList{}
+	var total int64
+	var newest time.Time
+	for id, files := range a.workshop {
+		idText := strconv.FormatUint(uint64(id), 10)
+		var size int64
+		var updated time.Time
+		for rel, f := range files {
+			addFile(filepath.Join(contentDir, idText, filepath.FromSlash(rel)), f)
+			size += int64(len(f.data))
+			if f.modTime.After(updated) {
+				updated = f.modTime
+			}
+		}
+		timeText := strconv.FormatInt(updated.Unix(), 10)
+		manifest := timeText // A dummy manifest ID that changes with the files
+		installed[idText] = sVDF.NamesValuesList{
+			"size":        strconv.FormatInt(size, 10),
+			"timeupdated": timeText,
+			"manifest":    manifest}
+		details[idText] = sVDF.NamesValuesList{
+			"manifest":     manifest,
+			"timeupdated":  timeText,
+			"timetouched":  timeText,
+			"subscribedby": "0"}
+		total += size
+		if updated.After(newest) {
+			newest = updated
+		}
+	}
+	return addVDF(filepath.Join(steamapps, "workshop",
+		fmt.Sprintf("appworkshop_%d.acf", a.AppNumber)),
+		"AppWorkshop", sVDF.NamesValuesList{
+			"appid":                  itoa(a.AppNumber),
+			"SizeOnDisk":             strconv.FormatInt(total, 10),
+			"NeedsUpdate":            "0",
+			"NeedsDownload":          "0",
+			"TimeLastUpdated":        strconv.FormatInt(newest.Unix(), 10),
+			"TimeLastAppRan":         "0",
+			"WorkshopItemsInstalled": installed,
+			"WorkshopItemDetails":    details},
+		newest)
+}
+
+// renderBackup adds a backup’s sku.sis files and chunk stores.
+//
+func renderBackup(backupPath string, b *Backup,
+	addFile func(string, treeFile),
+	addVDF func(string, string, sVDF.NamesValuesList, time.Time) error,
+) error {
+	nDisks := b.NumDisks
+	diskDir := func(disk int) string {
+		if b.NumDisks == 0 {
+			return backupPath
+		}
+		return filepath.Join(backupPath, fmt.Sprintf("Disk_%d", disk))
+	}
+	if nDisks == 0 {
+		nDisks = 1
+	}
+
+	apps, depots, manifests, chunkstores :=
+		sVDF.NamesValuesList{}, sVDF.NamesValuesList{},
+		sVDF.NamesValuesList{}, sVDF.NamesValuesList{}
+	for i, appNum := range b.Apps {
+		apps[strconv.Itoa(i)] = itoa(appNum)
+	}
+	for i, d := range b.depots {
+		depots[strconv.Itoa(i)] = itoa(d.depot)
+		manifests[itoa(d.depot)] = strconv.FormatUint(uint64(d.manifest), 10)
+		stores := sVDF.NamesValuesList{}
+		for disk := 1; disk <= nDisks; disk++ {
+			n := d.nChunks / nDisks
+			if disk <= d.nChunks%nDisks {
+				n += 1
+			}
+			csm, csd := chunkStoreFiles(d.depot, n)
+			name := filepath.Join(diskDir(disk),
+				fmt.Sprintf("%d_depotcache_%d", d.depot, disk))
+			addFile(name+".csm", treeFile{data: csm, modTime: b.SKUTime})
+			addFile(name+".csd", treeFile{data: csd, modTime: b.SKUTime})
+			stores[strconv.Itoa(disk)] = strconv.Itoa(len(csd))
+		}
+		chunkstores[itoa(d.depot)] = stores
+	}
+
+	for disk := 1; disk <= nDisks; disk++ {
+		err := addVDF(filepath.Join(diskDir(disk), "sku.sis"), "SKU",
+			sVDF.NamesValuesList{
+				"name":        b.Name,
+				"disks":       strconv.Itoa(nDisks),
+				"disk":        strconv.Itoa(disk),
+				"backup":      "1",
+				"contenttype": "3",
+				"apps":        apps,
+				"depots":      depots,
+				"manifests":   manifests,
+				"chunkstores": chunkstores},
+			b.SKUTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Each dummy chunk takes chunkStoredSize bytes in a .csd file, and would
+// unpack to chunkOriginalSize bytes.
+//
+const (
+	chunkStoredSize   = 16
+	chunkOriginalSize = 32
+)
+
+// chunkStoreFiles makes the contents of a consistent pair of .csm and .csd
+// files, in the format that steamfiles.OpenChunkStore reads.
+//
+func chunkStoreFiles(depot DepotNum, nChunks int) (csm, csd []byte) {
+	le := binary.LittleEndian
+	csm = make([]byte, 16+36*nChunks)
+	copy(csm, "SCFS")
+	le.PutUint32(csm[4:], 2)
+	le.PutUint32(csm[8:], uint32(depot))
+	le.PutUint32(csm[12:], uint32(nChunks))
+	for i := 0; i < nChunks; i++ {
+		rec := csm[16+36*i:]
+		sum := sha1.Sum([]byte(fmt.Sprintf("%d/%d", depot, i)))
+		copy(rec, sum[:])
+		le.PutUint64(rec[20:], uint64(i*chunkStoredSize))
+		le.PutUint32(rec[28:], chunkOriginalSize)
+		le.PutUint32(rec[32:], chunkStoredSize)
+	}
+	return csm, make([]byte, nChunks*chunkStoredSize)
+}
+
+func itoa(n interface{}) string {
+	return fmt.Sprintf("%d", n)
+}
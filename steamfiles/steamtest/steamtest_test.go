@@ -0,0 +1,142 @@
+package steamtest_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+func TestDiskLayoutBackup(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.AddBackupsDir("/backups").AddBackup("Ten", 10, 11).UseDisks(3).
+		AddDepot(101, 1234, 7).
+		AddDepot(111, 5678, 2)
+
+	fsys := h.MapFS(t)
+	for disk := 1; disk <= 3; disk++ {
+		d := "backups/Ten/Disk_" + string(rune('0'+disk))
+		names := []string{d + "/sku.sis"}
+		for _, depot := range []string{"101", "111"} {
+			stem := d + "/" + depot + "_depotcache_" + string(rune('0'+disk))
+			names = append(names, stem+".csm", stem+".csd")
+		}
+		for _, name := range names {
+			if _, ok := fsys[name]; !ok {
+				t.Errorf("the backup has no %s", name)
+			}
+		}
+	}
+	if _, ok := fsys["backups/Ten/Disk_4"]; ok {
+		t.Errorf("the backup has a Disk_4")
+	}
+
+	s := h.Scanner(t)
+	v, err := s.VerifyBackup("/backups/Ten")
+	if err != nil {
+		t.Fatalf("VerifyBackup: %s", err)
+	}
+	if !v.OK() || v.Disks != 3 || len(v.Depots) != 2 {
+		t.Errorf("VerifyBackup found %d disks, depots %v and defects %+v",
+			v.Disks, v.Depots, v.Defects)
+	}
+
+	backups := make(steamfiles.AppBackupForAppNum)
+	if err := s.ScanBackupsDir("/backups", backups, nil); err != nil {
+		t.Fatalf("ScanBackupsDir: %s", err)
+	}
+	for _, appNum := range []steamfiles.AppNum{10, 11} {
+		if b := backups[appNum]; b == nil || b.BackupName != "Ten" ||
+			b.BackupPath != "/backups/Ten" || !b.ModTime.Equal(steamtest.DefaultTime) {
+			t.Errorf("ScanBackupsDir found %+v for app %d", b, appNum)
+		}
+	}
+}
+
+func TestLibraryFoldersFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format  steamtest.LibraryFoldersFormat
+		topName string
+	}{
+		{steamtest.NewLibraryFolders, `"libraryfolders"`},
+		{steamtest.OldLibraryFolders, `"LibraryFolders"`},
+	} {
+		h := steamtest.NewHome("/home/me/.steam/steam")
+		h.Format = tc.format
+		h.InitialLibrary().AddApp(10, "Ten", "Ten")
+		h.AddLibrary("/media/games").AddApp(20, "Twenty", "Twenty")
+		h.AddLibrary("/mnt/more games")
+
+		f, ok := h.MapFS(t)["home/me/.steam/steam/steamapps/libraryfolders.vdf"]
+		if !ok {
+			t.Fatalf("format %d: no libraryfolders.vdf", tc.format)
+		}
+		if !strings.HasPrefix(string(f.Data), tc.topName) {
+			t.Errorf("format %d: libraryfolders.vdf starts %.20q, want %s",
+				tc.format, f.Data, tc.topName)
+		}
+
+		s := h.Scanner(t)
+		home, dirs, err := s.FindSteamLibraryDirs(func(path string, err error) {
+			t.Errorf("format %d: bad library %q: %s", tc.format, path, err)
+		})
+		if err != nil {
+			t.Fatalf("format %d: FindSteamLibraryDirs: %s", tc.format, err)
+		}
+		want := []string{
+			"/home/me/.steam/steam/steamapps",
+			"/media/games/steamapps",
+			"/mnt/more games/steamapps",
+		}
+		sort.Strings(dirs)
+		if home != "/home/me/.steam/steam" || strings.Join(dirs, "|") !=
+			strings.Join(want, "|") {
+			t.Errorf("format %d: FindSteamLibraryDirs = %q, %q; want %q",
+				tc.format, home, dirs, want)
+		}
+
+		apps := make(map[steamfiles.AppNum]*steamfiles.InstalledApp)
+		for _, dir := range dirs[:2] { // The third library has no apps
+			if err := s.ScanSteamLibDir(dir, apps, nil); err != nil {
+				t.Errorf("format %d: ScanSteamLibDir: %s", tc.format, err)
+			}
+		}
+		if apps[10] == nil || apps[20] == nil {
+			t.Errorf("format %d: apps 10 and 20 were not both loaded", tc.format)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("bin/game", "#!game", steamtest.DefaultTime)
+	root := h.Install(t)
+
+	home, dirs, err := steamfiles.FindSteamLibraryDirs(nil)
+	if err != nil {
+		t.Fatalf("FindSteamLibraryDirs: %s", err)
+	}
+	if want := filepath.Join(root, "home/me/.steam/steam"); home != want {
+		t.Errorf("the Steam home is %q, want %q", home, want)
+	}
+	apps := make(map[steamfiles.AppNum]*steamfiles.InstalledApp)
+	if err := steamfiles.ScanSteamLibDir(dirs[0], apps, nil); err != nil {
+		t.Fatalf("ScanSteamLibDir: %s", err)
+	}
+	if app := apps[10]; app == nil || app.InstallDir != "Ten" {
+		t.Fatalf("app 10 is %+v", app)
+	}
+	path := filepath.Join(dirs[0], "common", "Ten", "bin", "game")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(steamtest.DefaultTime) || info.Size() != 6 {
+		t.Errorf("%s has mtime %v and size %d", path, info.ModTime(), info.Size())
+	}
+}
@@ -0,0 +1,151 @@
+// Functions for planning which backups to get rid of.
+
+package steamfiles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A RetentionPolicy says which backups PlanTidy should keep.  A nil
+// *RetentionPolicy means use the defaults, which keep the newest backup of
+// each app.
+//
+type RetentionPolicy struct {
+	// KeepNewest is how many backups of each app to keep; <= 0 means 1.
+	KeepNewest int
+	// PreferSingleApp says to keep backups holding just one app ahead of
+	// those holding several, whatever their ages, as check-backups does
+	// when choosing between duplicate backups.
+	PreferSingleApp bool
+	// Unwanted lists apps none of whose backups should be kept.
+	Unwanted map[AppNum]bool
+	// Owned, if not nil, lists the apps the user still owns; backups of
+	// other apps are not kept.
+	Owned map[AppNum]bool
+}
+
+// A TidyItem is a backup in a TidyPlan.
+//
+type TidyItem struct {
+	Backup  *AppBackup `json:"-"`
+	Path    string     `json:"path"` // The backup directory (or archive)
+	Apps    []AppNum   `json:"apps"`
+	ModTime time.Time  `json:"mtime"`
+	Size    int64      `json:"size"`   // The total size of Paths
+	Paths   []string   `json:"paths"`  // Everything that makes up the backup, in removal order
+	Reason  string     `json:"reason"` // Why it is kept or not
+}
+
+// A TidyPlan is the result of PlanTidy.
+//
+type TidyPlan struct {
+	Keep   []*TidyItem `json:"keep"`
+	Delete []*TidyItem `json:"delete"`
+	Freed  int64       `json:"freed"` // The total size of Delete
+}
+
+// PlanTidy works out which of an Installation’s backups (all of
+// Installation.AllBackups, not just the preferred ones) a policy wants to
+// keep, and which can go.  A backup holding several apps is kept if any of
+// them wants it.  Each item’s Paths include, besides the backup itself, the
+// index of an archive backup and any archives of Proton prefixes kept beside
+// it (see CompatArchivePath).  Both lists are sorted by pathname.
+//
+// PlanTidy changes nothing; callers can pass each of Delete’s Paths, in order,
+// to MoveToTrash, stopping at the first failure so that no backup is left
+// half-removed in a way that spoils scans of its directory.
+//
+func PlanTidy(inst *Installation, policy *RetentionPolicy) (*TidyPlan, error) {
+	if policy == nil {
+		policy = &RetentionPolicy{}
+	}
+	keepNewest := policy.KeepNewest
+	if keepNewest <= 0 {
+		keepNewest = 1
+	}
+
+	// Rank each app’s backups, best first, and note why each backup is
+	// kept (by any of its apps) or not (by the first of its apps).
+	keepWhy := make(map[*AppBackup]string)
+	dropWhy := make(map[*AppBackup]string)
+	appNums := make([]AppNum, 0, len(inst.backupsForApp))
+	for appNum := range inst.backupsForApp {
+		appNums = append(appNums, appNum)
+	}
+	sort.Slice(appNums, func(i, j int) bool { return appNums[i] < appNums[j] })
+	for _, appNum := range appNums {
+		backups := append([]*AppBackup(nil), inst.BackupsOf(appNum)...)
+		sort.SliceStable(backups, func(i, j int) bool {
+			single1 := len(backups[i].AppNumbers) == 1
+			single2 := len(backups[j].AppNumbers) == 1
+			if policy.PreferSingleApp && single1 != single2 {
+				return single1
+			}
+			return backups[i].ModTime.After(backups[j].ModTime)
+		})
+		for rank, b := range backups {
+			var why string
+			switch {
+			case policy.Unwanted[appNum]:
+				why = fmt.Sprintf("app %d is unwanted", appNum)
+			case policy.Owned != nil && !policy.Owned[appNum]:
+				why = fmt.Sprintf("app %d is not owned", appNum)
+			case rank >= keepNewest:
+				why = fmt.Sprintf("app %d has better backups", appNum)
+			default:
+				if _, ok := keepWhy[b]; !ok {
+					keepWhy[b] = fmt.Sprintf("backup #%d of app %d", rank+1, appNum)
+				}
+				continue
+			}
+			if _, ok := dropWhy[b]; !ok {
+				dropWhy[b] = why
+			}
+		}
+	}
+
+	plan := &TidyPlan{}
+	scan := newScanState(context.Background(), nil)
+	for _, b := range inst.AllBackups {
+		item := &TidyItem{Backup: b, Path: b.BackupPath, Apps: b.AppNumbers,
+			ModTime: b.ModTime}
+		// An archive without its index is ignored by ScanBackupsDir, but
+		// not the other way round, so the index must go first.
+		if b.IsArchive() {
+			item.Paths = append(item.Paths, b.IndexPath)
+		}
+		item.Paths = append(item.Paths, b.BackupPath)
+		for _, appNum := range b.AppNumbers {
+			p := CompatArchivePath(b, appNum)
+			if _, err := inst.scanner.fsys.Lstat(p); err == nil {
+				item.Paths = append(item.Paths, p)
+			}
+		}
+		for _, p := range item.Paths {
+			size, err := inst.scanner.treeSize(scan, p)
+			if err != nil {
+				return nil, err
+			}
+			item.Size += size
+		}
+
+		if why, ok := keepWhy[b]; ok {
+			item.Reason = why
+			plan.Keep = append(plan.Keep, item)
+		} else {
+			item.Reason = dropWhy[b]
+			plan.Delete = append(plan.Delete, item)
+			plan.Freed += item.Size
+		}
+	}
+	for _, items := range [][]*TidyItem{plan.Keep, plan.Delete} {
+		sort.Slice(items, func(i, j int) bool {
+			return strings.ToLower(items[i].Path) < strings.ToLower(items[j].Path)
+		})
+	}
+	return plan, nil
+}
@@ -0,0 +1,91 @@
+package steamfiles_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c12h/steam-stuff/steamfiles"
+	"github.com/c12h/steam-stuff/steamfiles/steamtest"
+)
+
+func TestPlanTidyAndTrash(t *testing.T) {
+	h := steamtest.NewHome("/home/me/.steam/steam")
+	h.InitialLibrary().AddApp(10, "Ten", "Ten").
+		AddFile("game", "#!game", steamtest.DefaultTime)
+	bd := h.AddBackupsDir("/backups")
+	bd.AddBackup("Ten 2020", 10).SetTime(steamtest.DefaultTime.AddDate(-1, 0, 0))
+	bd.AddBackup("Ten 2021", 10).UseDisks(2)
+	root := h.Install(t)
+	backupsDir := filepath.Join(root, "backups")
+	trash := useTrash(t)
+
+	// The archive backup is the newest, so it is the one to keep.
+	inst := load(t, &steamfiles.LoadOptions{NoBackups: true})
+	archive, err := steamfiles.WriteArchiveBackup(context.Background(), inst, 10,
+		backupsDir, nil)
+	if err != nil {
+		t.Fatalf("WriteArchiveBackup: %s", err)
+	}
+	if !archive.ModTime.After(steamtest.DefaultTime) {
+		t.Fatalf("the archive backup’s ModTime %v is not after %v", archive.ModTime,
+			steamtest.DefaultTime)
+	}
+
+	inst = load(t, &steamfiles.LoadOptions{BackupsDirs: []string{backupsDir}})
+	plan, err := steamfiles.PlanTidy(inst, &steamfiles.RetentionPolicy{KeepNewest: 1})
+	if err != nil {
+		t.Fatalf("PlanTidy: %s", err)
+	}
+	if len(plan.Keep) != 1 || plan.Keep[0].Path != archive.BackupPath {
+		t.Fatalf("PlanTidy keeps %v, want only %q", plan.Keep, archive.BackupPath)
+	}
+	if paths := plan.Keep[0].Paths; len(paths) < 2 || paths[0] != archive.IndexPath ||
+		paths[1] != archive.BackupPath {
+		t.Errorf("the archive backup’s Paths are %q, want the index first", paths)
+	}
+	if len(plan.Delete) != 2 {
+		t.Fatalf("PlanTidy deletes %d backups, want 2", len(plan.Delete))
+	}
+	var freed int64
+	for i, name := range []string{"Ten 2020", "Ten 2021"} {
+		item := plan.Delete[i]
+		if item.Path != filepath.Join(backupsDir, name) {
+			t.Errorf("Delete[%d] is %q, want %q", i, item.Path, name)
+		}
+		if item.Reason == "" || item.Size <= 0 {
+			t.Errorf("Delete[%d] has reason %q and size %d", i, item.Reason, item.Size)
+		}
+		freed += item.Size
+	}
+	if plan.Freed != freed {
+		t.Errorf("Freed = %d, want %d", plan.Freed, freed)
+	}
+
+	for _, item := range plan.Delete {
+		for _, p := range item.Paths {
+			dest, err := steamfiles.MoveToTrash(p)
+			if err != nil {
+				t.Fatalf("MoveToTrash: %s", err)
+			}
+			if !strings.HasPrefix(dest, trash+"/files/") {
+				t.Errorf("%q went to %q, not the home trash %q", p, dest, trash)
+			}
+			info := readFile(t,
+				filepath.Join(trash, "info", filepath.Base(dest)+".trashinfo"))
+			if !strings.Contains(info, "Path="+strings.ReplaceAll(p, " ", "%20")+"\n") {
+				t.Errorf("the .trashinfo for %q is %q", p, info)
+			}
+			if exists(p) || !exists(dest) {
+				t.Errorf("%q was not moved to %q", p, dest)
+			}
+		}
+	}
+
+	inst = load(t, &steamfiles.LoadOptions{BackupsDirs: []string{backupsDir}})
+	if len(inst.AllBackups) != 1 || inst.Backups[10].BackupPath != archive.BackupPath {
+		t.Errorf("after tidying, the backups are %v; want only the archive",
+			inst.AllBackups)
+	}
+}
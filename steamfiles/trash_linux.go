@@ -0,0 +1,146 @@
+package steamfiles
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// MoveToTrash moves a file or directory to the user’s trash, as the
+// freedesktop.org Trash specification describes, so that it can be got back
+// with a desktop’s file manager.  Things on the same file system as the user’s
+// home trash ($XDG_DATA_HOME/Trash, normally ~/.local/share/Trash) go there;
+// things elsewhere go in the .Trash-<uid> directory at the top of their own
+// file system, since moving them to the home trash would mean copying them.
+// MoveToTrash returns where the thing went.
+//
+// Like the other functions that change files, MoveToTrash always uses the real
+// file system.
+//
+func MoveToTrash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", cannot("find", "", path, err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", cannot("examine", "", path, err)
+	}
+	id, ok := fileIDOf(info)
+	if !ok {
+		return "", cannot("get device number for", "", path, os.ErrInvalid)
+	}
+
+	trashDir, topDir, err := trashDirFor(path, id.Device)
+	if err != nil {
+		return "", err
+	}
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", cannot("create", "trash directory", dir, err)
+		}
+	}
+
+	// The .trashinfo file names the original pathname, relative to the top
+	// directory for a per-file-system trash, percent-encoded.
+	origPath := path
+	if topDir != "" {
+		if rel, err := filepath.Rel(topDir, path); err == nil {
+			origPath = rel
+		}
+	}
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: origPath}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+
+	// Creating the .trashinfo file exclusively reserves the name.
+	base := filepath.Base(path)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d", base, n)
+		}
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		fh, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", cannot("create", "file", infoPath, err)
+		}
+		_, err = fh.WriteString(contents)
+		if closeErr := fh.Close(); err == nil {
+			err = closeErr
+		}
+		dest := filepath.Join(filesDir, name)
+		if err == nil {
+			if _, statErr := os.Lstat(dest); statErr == nil {
+				os.Remove(infoPath)
+				continue // A stray file with no .trashinfo
+			}
+			err = os.Rename(path, dest)
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", cannot("move to trash", "", path, err)
+		}
+		return dest, nil
+	}
+}
+
+// trashDirFor returns the trash directory to use for things on the file
+// system with device number dev, and (unless that is the home trash) the top
+// directory of that file system.
+//
+func trashDirFor(path string, dev uint64) (trashDir, topDir string, err error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", cannotFind("the home directory", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	homeTrash := filepath.Join(dataHome, "Trash")
+	// The home trash may not exist yet, so check the nearest directory that
+	// does.
+	for dir := homeTrash; ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil {
+			if id, ok := fileIDOf(info); ok && id.Device == dev {
+				return homeTrash, "", nil
+			}
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	// Find the top of path’s file system: the highest directory above it
+	// on the same device.
+	topDir = filepath.Dir(path)
+	for topDir != filepath.Dir(topDir) {
+		info, err := os.Stat(filepath.Dir(topDir))
+		if err != nil {
+			break
+		}
+		if id, ok := fileIDOf(info); !ok || id.Device != dev {
+			break
+		}
+		topDir = filepath.Dir(topDir)
+	}
+
+	uid := strconv.Itoa(os.Getuid())
+	// An administrator-provided $topdir/.Trash must be a sticky directory,
+	// not a symlink; otherwise use $topdir/.Trash-<uid>.
+	shared := filepath.Join(topDir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() &&
+		info.Mode()&os.ModeSticky != 0 {
+		return filepath.Join(shared, uid), topDir, nil
+	}
+	return filepath.Join(topDir, ".Trash-"+uid), topDir, nil
+}
@@ -13,6 +13,12 @@ import (
 //
 type AppNum int32
 
+// Steam identifies depots (the units in which it delivers an app’s files) by
+// positive integers from the same number space as AppNums.  An app’s depots
+// usually have numbers a little larger than its AppNum.
+//
+type DepotNum int32
+
 // parseAppNum gets an AppNum from a string, with lots of error checking.
 //
 func parseAppNum(text, path string) (AppNum, error) {
@@ -28,3 +34,17 @@ func parseAppNum(text, path string) (AppNum, error) {
 	}
 	return AppNum(appNum), nil
 }
+
+// parseDepotNum gets a DepotNum from a string, with the same checks as
+// parseAppNum.
+//
+func parseDepotNum(text, path string) (DepotNum, error) {
+	depotNum, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fileError(path, "", "has depot ID %q, need integer", text)
+	}
+	if depotNum > math.MaxInt32 || depotNum <= 0 {
+		return 0, fileError(path, "", "has bad depot ID %d", depotNum)
+	}
+	return DepotNum(depotNum), nil
+}
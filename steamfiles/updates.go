@@ -0,0 +1,127 @@
+// Functions etc for spotting apps that Steam is part-way through downloading or
+// updating.
+
+package steamfiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// appUpdatingStates are the StateFlags bits that show Steam is working on (or
+// wants to work on) an app’s files.
+//
+const appUpdatingStates = AppStateUpdateRequired | AppStateUpdateRunning |
+	AppStateUpdatePaused | AppStateUpdateStarted | AppStateReconfiguring |
+	AppStateValidating | AppStateAddingFiles | AppStatePreallocating |
+	AppStateDownloading | AppStateStaging | AppStateCommitting |
+	AppStateUpdateStopping
+
+// UpdatePending reports whether an app’s manifest shows that an update is
+// needed or under way: either its StateFlags say so, or its "BytesDownloaded"
+// or "BytesStaged" values fall short of "BytesToDownload" or "BytesToStage".
+// Backing up or moving such an app gives a mix of old and new files.
+//
+func (app *InstalledApp) UpdatePending() bool {
+	return app.StateFlags&appUpdatingStates != 0 ||
+		app.BytesDownloaded < app.BytesToDownload ||
+		app.BytesStaged < app.BytesToStage
+}
+
+// An AppUpdate describes an update that Steam has not finished, from an app’s
+// manifest and the steamapps/downloading/<AppNum> and steamapps/temp/<AppNum>
+// directories, where Steam keeps downloaded and staged files until it moves
+// them into place.
+//
+type AppUpdate struct {
+	App             *InstalledApp `json:"-"`
+	AppNumber       AppNum        `json:"appid"`
+	AppName         string        `json:"name"`
+	Library         string        `json:"library"` // The "steamapps" directory
+	StateFlags      AppStateFlags `json:"state_flags"`
+	State           string        `json:"state"` // StateFlags as text
+	BytesToDownload int64         `json:"bytes_to_download"`
+	BytesDownloaded int64         `json:"bytes_downloaded"`
+	BytesToStage    int64         `json:"bytes_to_stage"`
+	BytesStaged     int64         `json:"bytes_staged"`
+	DownloadingDir  string        `json:"downloading_dir,omitempty"` // "" if there is none
+	DownloadingSize int64         `json:"downloading_size"`          // Size of its files
+	TempDir         string        `json:"temp_dir,omitempty"`        // "" if there is none
+	TempSize        int64         `json:"temp_size"`                 // Size of its files
+}
+
+// FindPendingUpdates returns the apps in an Installation that Steam is part-way
+// through downloading or updating, as shown by their manifests (see
+// InstalledApp.UpdatePending) or by a downloading/<AppNum> or temp/<AppNum>
+// directory in their library, sorted by AppNum.  Progress reports (via opts)
+// count the files whose sizes are added up.
+//
+func FindPendingUpdates(ctx context.Context, inst *Installation, opts *ScanOptions,
+) ([]*AppUpdate, error) {
+	return std.FindPendingUpdates(ctx, inst, opts)
+}
+
+// FindPendingUpdates is the Scanner method behind the FindPendingUpdates
+// function.
+//
+func (s *Scanner) FindPendingUpdates(ctx context.Context, inst *Installation,
+	opts *ScanOptions,
+) ([]*AppUpdate, error) {
+	var ret []*AppUpdate
+	for _, app := range inst.SortedApps() {
+		u := &AppUpdate{
+			App:             app,
+			AppNumber:       app.AppNumber,
+			AppName:         app.AppName,
+			Library:         app.LibraryFolders[0],
+			StateFlags:      app.StateFlags,
+			State:           app.StateFlags.String(),
+			BytesToDownload: app.BytesToDownload,
+			BytesDownloaded: app.BytesDownloaded,
+			BytesToStage:    app.BytesToStage,
+			BytesStaged:     app.BytesStaged,
+		}
+		appText := strconv.Itoa(int(app.AppNumber))
+		for _, d := range []struct {
+			sub string
+			ptr *string
+		}{
+			{"downloading", &u.DownloadingDir},
+			{"temp", &u.TempDir},
+		} {
+			dir := filepath.Join(u.Library, d.sub, appText)
+			info, err := s.fsys.Lstat(dir)
+			if err == nil && info.IsDir() {
+				*d.ptr = dir
+			} else if err != nil && !os.IsNotExist(err) {
+				return nil, cannot("examine", "directory", dir, err)
+			}
+		}
+		if app.UpdatePending() || u.DownloadingDir != "" || u.TempDir != "" {
+			ret = append(ret, u)
+		}
+	}
+
+	scan := newScanState(ctx, opts)
+	errors := make([]error, len(ret))
+	err := scan.forEach(len(ret), func(i int) {
+		u := ret[i]
+		if u.DownloadingDir != "" {
+			u.DownloadingSize, errors[i] = s.treeSize(scan, u.DownloadingDir)
+		}
+		if u.TempDir != "" && errors[i] == nil {
+			u.TempSize, errors[i] = s.treeSize(scan, u.TempDir)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errors {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
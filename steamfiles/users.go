@@ -0,0 +1,89 @@
+// Functions etc for finding the Steam users who have used an installation.
+
+package steamfiles
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// A User is a Steam account that has been used with a Steam installation, as
+// shown by a subdirectory of <SteamHome>/userdata.
+//
+type User struct {
+	ID          uint32 // The account number, which names the userdata subdirectory
+	Path        string // The user’s userdata subdirectory
+	PersonaName string // The user’s display name, or "" if not known
+	Err         error  // Why PersonaName could not be read, if it could not
+}
+
+// steamID64Base is added to an account number to get a 64-bit SteamID for an
+// individual account in the public universe.
+//
+const steamID64Base = 76561197960265728
+
+// SteamID64 returns the user’s 64-bit SteamID, the form used in Steam
+// Community URLs.
+//
+func (u *User) SteamID64() uint64 {
+	return steamID64Base + uint64(u.ID)
+}
+
+var reUserDir = regexp.MustCompile(`^[0-9]+$`)
+
+// FindUsers returns the users with a directory in <steamHome>/userdata, sorted
+// by ID.  Each user’s PersonaName comes from their config/localconfig.vdf file;
+// a user without that file is not an error, and a user with an unparseable one
+// is returned with the error in User.Err, so that one bad file does not hide
+// the other users.  If there is no userdata directory, FindUsers returns no
+// users.
+//
+func FindUsers(steamHome string) ([]*User, error) {
+	return std.FindUsers(steamHome)
+}
+
+// FindUsers is the Scanner method behind the FindUsers function.
+//
+func (s *Scanner) FindUsers(steamHome string) ([]*User, error) {
+	userdataDir := filepath.Join(steamHome, "userdata")
+	if _, err := s.fsys.Stat(userdataDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, cannot("examine", "directory", userdataDir, err)
+	}
+	names, err := s.readDirNames(userdataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*User
+	for _, n := range names {
+		if !reUserDir.MatchString(n) {
+			continue
+		}
+		id, err := strconv.ParseUint(n, 10, 32)
+		if err != nil || id == 0 {
+			continue // Not an account number (fx, "0" or "anonymous")
+		}
+		u := &User{ID: uint32(id), Path: filepath.Join(userdataDir, n)}
+		configPath := filepath.Join(u.Path, "config", "localconfig.vdf")
+		if _, err := s.fsys.Lstat(configPath); err == nil {
+			configInfo, err := sVDF.FromFS(s.fsys, configPath,
+				"UserLocalConfigStore")
+			if err != nil {
+				u.Err = err
+			} else {
+				u.PersonaName, _ = configInfo.Lookup("friends", "PersonaName")
+			}
+		}
+		ret = append(ret, u)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret, nil
+}
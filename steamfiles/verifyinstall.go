@@ -0,0 +1,251 @@
+// Functions etc for checking an installed app’s files against the depot
+// manifests for its installed depots.
+
+package steamfiles
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// An InstallProblemKind says what is wrong with a file in an installed app.
+// Like BackupDefectKind, the values are short, stable strings.
+//
+type InstallProblemKind string
+
+const (
+	InstallNoManifest  InstallProblemKind = "no-manifest"  // Depot manifest not found
+	InstallBadManifest InstallProblemKind = "bad-manifest" // Depot manifest unusable
+	InstallMissing     InstallProblemKind = "missing"      // File in manifest not on disk
+	InstallExtra       InstallProblemKind = "extra"        // File on disk not in any manifest
+	InstallWrongType   InstallProblemKind = "wrong-type"   // Eg, a directory instead of a file
+	InstallWrongSize   InstallProblemKind = "wrong-size"   // Size differs from manifest
+	InstallWrongHash   InstallProblemKind = "wrong-hash"   // SHA-1 hash differs from manifest
+)
+
+// An InstallProblem describes one thing wrong with an installed app.
+//
+type InstallProblem struct {
+	Kind   InstallProblemKind `json:"kind"`
+	Path   string             `json:"path"`            // Relative to the install dir
+	Depot  DepotNum           `json:"depot,omitempty"` // Which depot, if known
+	Detail string             `json:"detail"`          // A human-readable explanation
+}
+
+// An InstallVerification is what VerifyInstall reports about an installed app.
+//
+type InstallVerification struct {
+	AppNumber    AppNum           `json:"appid"`
+	InstallPath  string           `json:"install_path"`  // Where the app’s files are
+	FilesChecked int              `json:"files_checked"` // How many manifest entries were checked
+	Problems     []InstallProblem `json:"problems"`
+}
+
+// OK reports whether VerifyInstall found no problems.
+//
+func (v *InstallVerification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *InstallVerification) addProblem(kind InstallProblemKind,
+	path string, depot DepotNum, format string, args ...interface{},
+) {
+	v.Problems = append(v.Problems, InstallProblem{
+		Kind:   kind,
+		Path:   path,
+		Depot:  depot,
+		Detail: fmt.Sprintf(format, args...)})
+}
+
+// VerifyInstall compares the files under <SLF>/steamapps/common/<installdir>
+// with the depot manifests for the app’s InstalledDepots, rather like Steam’s
+// ‘verify integrity of game files’ but without any network access.  It reports
+// files that are missing, extra, the wrong size or the wrong SHA-1 hash.
+//
+// The depot manifests are looked for in <SLF>/steamapps/depotcache, then in
+// <SteamHome>/depotcache.  If any of them cannot be found or read, VerifyInstall
+// reports that as a problem and does not look for extra files, since it cannot
+// tell which files are extra.
+//
+// Files that Valve marks as user configuration files are only checked for
+// existence, since games are expected to change them.
+//
+// VerifyInstall uses the first of app.LibraryFolders, and copes with incorrect
+// casing of the install dir the same way AppNewerThan does.  It returns an
+// error only if it cannot find or read the install dir.
+//
+func VerifyInstall(app *InstalledApp) (*InstallVerification, error) {
+	return std.VerifyInstall(app)
+}
+
+// VerifyInstall is the Scanner method behind the VerifyInstall function.
+//
+func (s *Scanner) VerifyInstall(app *InstalledApp) (*InstallVerification, error) {
+	if len(app.LibraryFolders) == 0 {
+		return nil, cannotFind(fmt.Sprintf("library folder for app %d",
+			app.AppNumber), nil)
+	}
+	steamLibDir := app.LibraryFolders[0]
+	appDir, err := s.findAppDir(steamLibDir, app.InstallDir)
+	if err != nil {
+		return nil, err
+	}
+	ret := &InstallVerification{AppNumber: app.AppNumber, InstallPath: appDir}
+
+	// Gather the files from all the depots.  If depots overlap, the one with
+	// the higher DepotNum wins, which is a guess at what Steam does.
+	depotcacheDirs := []string{filepath.Join(steamLibDir, "depotcache")}
+	if steamHome, err := s.FindSteamHome(); err == nil {
+		depotcacheDirs = append(depotcacheDirs,
+			filepath.Join(steamHome, "depotcache"))
+	}
+	depotNums := make([]DepotNum, 0, len(app.InstalledDepots))
+	for depotNum := range app.InstalledDepots {
+		depotNums = append(depotNums, depotNum)
+	}
+	sort.Slice(depotNums, func(i, j int) bool { return depotNums[i] < depotNums[j] })
+
+	type wantedFile struct {
+		DepotFile
+		depot DepotNum
+	}
+	wanted := make(map[string]*wantedFile)
+	haveAllManifests := true
+	for _, depotNum := range depotNums {
+		manifestID := app.InstalledDepots[depotNum].Manifest
+		manifestPath := ""
+		for _, dir := range depotcacheDirs {
+			p := DepotManifestPath(dir, depotNum, manifestID)
+			if _, err := s.fsys.Lstat(p); err == nil {
+				manifestPath = p
+				break
+			}
+		}
+		if manifestPath == "" {
+			haveAllManifests = false
+			ret.addProblem(InstallNoManifest, "", depotNum,
+				"no %d_%d.manifest in %q", depotNum, manifestID,
+				depotcacheDirs)
+			continue
+		}
+		manifest, err := s.ReadDepotManifest(manifestPath)
+		if err != nil {
+			haveAllManifests = false
+			ret.addProblem(InstallBadManifest, "", depotNum, "%s", err)
+			continue
+		}
+		if manifest.FilenamesEncrypted {
+			haveAllManifests = false
+			ret.addProblem(InstallBadManifest, "", depotNum,
+				"%q has encrypted file names", manifestPath)
+			continue
+		}
+		for _, df := range manifest.Files {
+			wanted[df.Name] = &wantedFile{df, depotNum}
+		}
+	}
+
+	// Check each file listed in the manifests.
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		wf := wanted[name]
+		ret.FilesChecked += 1
+		filePath := filepath.Join(appDir, filepath.FromSlash(name))
+		info, err := s.fsys.Lstat(filePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, cannot("examine", "", filePath, err)
+			}
+			ret.addProblem(InstallMissing, name, wf.depot, "not found")
+			continue
+		}
+		switch {
+		case wf.IsDir():
+			if !info.IsDir() {
+				ret.addProblem(InstallWrongType, name, wf.depot,
+					"should be a directory")
+			}
+		case wf.IsSymlink():
+			if info.Mode()&os.ModeSymlink == 0 {
+				ret.addProblem(InstallWrongType, name, wf.depot,
+					"should be a symlink")
+			}
+		case !isRegFile(info):
+			ret.addProblem(InstallWrongType, name, wf.depot,
+				"should be a regular file")
+		case wf.Flags&(DepotFileUserConfig|DepotFileVersionedUserConfig) != 0:
+			// Games may change these, so existence is enough.
+		case info.Size() != wf.Size:
+			ret.addProblem(InstallWrongSize, name, wf.depot,
+				"has %d bytes, should have %d", info.Size(), wf.Size)
+		default:
+			sum, err := s.fileSHA1(filePath)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(sum, wf.SHA1[:]) {
+				ret.addProblem(InstallWrongHash, name, wf.depot,
+					"SHA-1 is %x, should be %x", sum, wf.SHA1)
+			}
+		}
+	}
+
+	// Look for files that no manifest mentions.  Manifests do not always
+	// list the directories that files are in, so allow for those.
+	if haveAllManifests {
+		impliedDirs := make(map[string]bool)
+		for _, name := range names {
+			for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+				impliedDirs[dir] = true
+			}
+		}
+		err = s.walkTree(appDir, func(p string, d fs.DirEntry) error {
+			rel, err := filepath.Rel(appDir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if _, isWanted := wanted[rel]; !isWanted && !impliedDirs[rel] {
+				ret.addProblem(InstallExtra, rel, 0, "not in any depot manifest")
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(ret.Problems, func(i, j int) bool {
+		return ret.Problems[i].Path < ret.Problems[j].Path
+	})
+	return ret, nil
+}
+
+// fileSHA1 returns the SHA-1 hash of a file’s contents.
+//
+func (s *Scanner) fileSHA1(path string) ([]byte, error) {
+	fh, err := s.fsys.Open(path)
+	if err != nil {
+		return nil, cannot("open", "", path, err)
+	}
+	defer fh.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return nil, cannot("read", "", path, err)
+	}
+	return h.Sum(nil), nil
+}
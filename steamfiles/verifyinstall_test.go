@@ -0,0 +1,157 @@
+package steamfiles
+
+import (
+	"crypto/sha1"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// depotManifestFile makes a .manifest file for depot 101, manifest 1234,
+// listing the given files (each with its size and SHA-1 hash) and dirs.
+// Files whose names start with "cfg" are flagged as user configuration.
+//
+func depotManifestFile(files map[string]string, dirs ...string) []byte {
+	var list []byte
+	for name, contents := range files {
+		sum := sha1.Sum([]byte(contents))
+		var flags DepotFileFlags
+		if len(name) >= 3 && name[:3] == "cfg" {
+			flags = DepotFileUserConfig
+		}
+		list = append(list, pbBytes(1, cat(pbBytes(1, []byte(name)),
+			pbVarint(2, uint64(len(contents))), pbVarint(3, uint64(flags)),
+			pbBytes(5, sum[:])))...)
+	}
+	for _, name := range dirs {
+		list = append(list, pbBytes(1, cat(pbBytes(1, []byte(name)),
+			pbVarint(3, uint64(DepotFileDirectory))))...)
+	}
+	meta := cat(pbVarint(1, 101), pbVarint(2, 1234))
+	return cat(manifestSection(manifestPayloadMagic, list),
+		manifestSection(manifestMetadataMagic, meta))
+}
+
+const (
+	verifyLib  = "/media/games/steamapps"
+	verifyHome = "/home/me/.steam/steam"
+)
+
+// verifyFS returns an install of app 10 (in verifyLib/common/Ten) that matches
+// its depot manifest, which is in verifyLib/depotcache.
+//
+func verifyFS() fstest.MapFS {
+	file := func(text string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(text), Mode: 0644}
+	}
+	return fstest.MapFS{
+		"media/games/steamapps/depotcache/101_1234.manifest": file(string(
+			depotManifestFile(map[string]string{
+				`bin\game`:   "0123456789",
+				"readme.txt": "hello",
+				"cfg.ini":    "volume=3",
+			}, "bin", "saves"))),
+		"media/games/steamapps/common/Ten/bin/game":   file("0123456789"),
+		"media/games/steamapps/common/Ten/readme.txt": file("hello"),
+		"media/games/steamapps/common/Ten/cfg.ini":    file("volume=3"),
+		"media/games/steamapps/common/Ten/saves":      {Mode: fs.ModeDir | 0755},
+		"home/me/.steam/steam/steamapps":              {Mode: fs.ModeDir | 0755},
+	}
+}
+
+func TestVerifyInstall(t *testing.T) {
+	const ten = "media/games/steamapps/common/Ten/"
+	const music = "media/games/steamapps/music/Ten/"
+	for _, tc := range []struct {
+		name       string
+		change     func(fstest.MapFS)
+		installDir string
+		want       InstallProblemKind // "" for none
+		path       string
+	}{
+		{"good", nil, "Ten", "", ""},
+		{"wrongly cased install dir", nil, "ten", "", ""},
+		{"in music", func(fsys fstest.MapFS) {
+			for name, f := range fsys {
+				if len(name) > len(ten) && name[:len(ten)] == ten {
+					fsys[music+name[len(ten):]] = f
+					delete(fsys, name)
+				}
+			}
+		}, "Ten", "", ""},
+		{"manifest in the home depotcache", func(fsys fstest.MapFS) {
+			const name = "depotcache/101_1234.manifest"
+			fsys["home/me/.steam/steam/"+name] = fsys["media/games/steamapps/"+name]
+			delete(fsys, "media/games/steamapps/"+name)
+		}, "Ten", "", ""},
+		{"changed user config", func(fsys fstest.MapFS) {
+			fsys[ten+"cfg.ini"].Data = []byte("volume=11")
+		}, "Ten", "", ""},
+		{"missing file", func(fsys fstest.MapFS) {
+			delete(fsys, ten+"readme.txt")
+		}, "Ten", InstallMissing, "readme.txt"},
+		{"wrong size", func(fsys fstest.MapFS) {
+			fsys[ten+"readme.txt"].Data = []byte("hello!")
+		}, "Ten", InstallWrongSize, "readme.txt"},
+		{"wrong hash", func(fsys fstest.MapFS) {
+			fsys[ten+"bin/game"].Data = []byte("0123456780")
+		}, "Ten", InstallWrongHash, "bin/game"},
+		{"extra file", func(fsys fstest.MapFS) {
+			fsys[ten+"bin/cheat.dll"] = &fstest.MapFile{Data: []byte("!")}
+		}, "Ten", InstallExtra, "bin/cheat.dll"},
+		{"file not directory", func(fsys fstest.MapFS) {
+			fsys[ten+"saves"] = &fstest.MapFile{Data: []byte("!")}
+		}, "Ten", InstallWrongType, "saves"},
+		{"directory not file", func(fsys fstest.MapFS) {
+			fsys[ten+"readme.txt"] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+		}, "Ten", InstallWrongType, "readme.txt"},
+		{"no manifest", func(fsys fstest.MapFS) {
+			delete(fsys, "media/games/steamapps/depotcache/101_1234.manifest")
+			fsys[ten+"bin/cheat.dll"] = &fstest.MapFile{Data: []byte("!")}
+		}, "Ten", InstallNoManifest, ""},
+		{"bad manifest", func(fsys fstest.MapFS) {
+			fsys["media/games/steamapps/depotcache/101_1234.manifest"].Data =
+				[]byte("garbage")
+		}, "Ten", InstallBadManifest, ""},
+	} {
+		fsys := verifyFS()
+		if tc.change != nil {
+			tc.change(fsys)
+		}
+		s := NewScanner(FromFS(fsys))
+		s.SteamHomeOverride = verifyHome
+		app := &InstalledApp{AppNumber: 10, InstallDir: tc.installDir,
+			LibraryFolders:  []string{verifyLib},
+			InstalledDepots: map[DepotNum]InstalledDepot{101: {Manifest: 1234}}}
+		v, err := s.VerifyInstall(app)
+		if err != nil {
+			t.Errorf("%s: VerifyInstall: %s", tc.name, err)
+			continue
+		}
+		if tc.want == "" {
+			if !v.OK() || v.FilesChecked != 5 {
+				t.Errorf("%s: checked %d files and found %+v; want 5 and none",
+					tc.name, v.FilesChecked, v.Problems)
+			}
+			continue
+		}
+		if len(v.Problems) != 1 || v.Problems[0].Kind != tc.want ||
+			v.Problems[0].Path != tc.path {
+			t.Errorf("%s: found %+v, want just %s %q", tc.name, v.Problems,
+				tc.want, tc.path)
+		}
+	}
+}
+
+func TestVerifyInstallWithoutInstallDir(t *testing.T) {
+	s := NewScanner(FromFS(verifyFS()))
+	s.SteamHomeOverride = verifyHome
+	for _, app := range []*InstalledApp{
+		{AppNumber: 10, InstallDir: "Eleven", LibraryFolders: []string{verifyLib}},
+		{AppNumber: 10, InstallDir: "Ten"},
+	} {
+		if v, err := s.VerifyInstall(app); err == nil {
+			t.Errorf("VerifyInstall(%+v) gave %+v, want an error", app, v)
+		}
+	}
+}
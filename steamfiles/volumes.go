@@ -0,0 +1,173 @@
+// Functions etc for finding out which file systems Steam libraries and backups
+// are on, and how big and how full those are.
+
+package steamfiles
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// A FileID identifies a file or directory by the device holding it and its
+// inode number.  Unlike pathnames, FileIDs are the same however a directory is
+// reached: via symlinks, bind mounts or neither.
+//
+type FileID struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+}
+
+// A DiskSpace describes the file system holding a directory.
+//
+type DiskSpace struct {
+	Path      string `json:"path"`      // The directory
+	ID        FileID `json:"id"`        // The directory’s identity
+	Capacity  int64  `json:"capacity"`  // The file system’s size in bytes
+	Free      int64  `json:"free"`      // Bytes free, including any reserved for root
+	Available int64  `json:"available"` // Bytes that unprivileged users can write
+}
+
+// Used returns the number of bytes in use on a file system.
+//
+func (d *DiskSpace) Used() int64 {
+	return d.Capacity - d.Free
+}
+
+// FileIdentity returns the FileID of a file or directory, following symlinks.
+// It fails if the FileSystem in use does not give device and inode numbers.
+//
+func FileIdentity(path string) (FileID, error) {
+	return std.FileIdentity(path)
+}
+
+// FileIdentity is the Scanner method behind the FileIdentity function.
+//
+func (s *Scanner) FileIdentity(path string) (FileID, error) {
+	info, err := s.fsys.Stat(path)
+	if err != nil {
+		return FileID{}, cannot("examine", "", path, err)
+	}
+	id, ok := fileIDOf(info)
+	if !ok {
+		return FileID{}, cannot("get device and inode numbers for", "", path,
+			fs.ErrInvalid)
+	}
+	return id, nil
+}
+
+// StatDisk returns the size and free space of the file system holding a
+// directory.  It fails if the FileSystem in use cannot tell.
+//
+func StatDisk(path string) (*DiskSpace, error) {
+	return std.StatDisk(path)
+}
+
+// StatDisk is the Scanner method behind the StatDisk function.
+//
+func (s *Scanner) StatDisk(path string) (*DiskSpace, error) {
+	sfs, ok := s.fsys.(interface {
+		Statfs(name string) (capacity, free, available int64, err error)
+	})
+	if !ok {
+		return nil, cannot("get free space for", "", path, fs.ErrInvalid)
+	}
+	id, err := s.FileIdentity(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &DiskSpace{Path: path, ID: id}
+	ret.Capacity, ret.Free, ret.Available, err = sfs.Statfs(path)
+	if err != nil {
+		return nil, cannot("get free space for", "", path, err)
+	}
+	return ret, nil
+}
+
+// UniqueDirs returns a list of directories without any that are the same as an
+// earlier one, as far as symlinks and (where the FileSystem in use gives
+// FileIDs) bind mounts can tell.
+//
+func UniqueDirs(paths []string) []string {
+	return std.UniqueDirs(paths)
+}
+
+// UniqueDirs is the Scanner method behind the UniqueDirs function.
+//
+func (s *Scanner) UniqueDirs(paths []string) []string {
+	var ret []string
+outer:
+	for _, p := range paths {
+		for _, q := range ret {
+			if s.sameDir(p, q) {
+				continue outer
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// A Volume is a file system holding some of an Installation’s libraries or
+// backups directories.
+//
+type Volume struct {
+	DiskSpace              // For the first of its directories
+	Libraries   []*Library `json:"-"`
+	LibraryDirs []string   `json:"libraries"`    // Their "steamapps" directories
+	BackupsDirs []string   `json:"backups_dirs"` // In the order of inst.BackupsDirs
+}
+
+// Volumes returns the file systems holding an Installation’s libraries and
+// backups directories, in the order those are listed.  Directories for which
+// StatDisk fails (fx, on a FileSystem that cannot tell) get a Volume each,
+// with only Path filled in of its DiskSpace.
+//
+func (inst *Installation) Volumes() []*Volume {
+	var ret []*Volume
+	byDevice := make(map[uint64]*Volume)
+	volumeFor := func(path string) *Volume {
+		ds, err := inst.scanner.StatDisk(path)
+		if err != nil {
+			v := &Volume{DiskSpace: DiskSpace{Path: path}}
+			ret = append(ret, v)
+			return v
+		}
+		v := byDevice[ds.ID.Device]
+		if v == nil {
+			v = &Volume{DiskSpace: *ds}
+			byDevice[ds.ID.Device] = v
+			ret = append(ret, v)
+		}
+		return v
+	}
+	for _, lib := range inst.Libraries {
+		v := volumeFor(lib.Path)
+		v.Libraries = append(v.Libraries, lib)
+		v.LibraryDirs = append(v.LibraryDirs, lib.Path)
+	}
+	for _, dir := range inst.BackupsDirs {
+		v := volumeFor(dir)
+		v.BackupsDirs = append(v.BackupsDirs, dir)
+	}
+	return ret
+}
+
+// sameDir reports whether two pathnames refer to the same directory, as far
+// as can be told by following symlinks and (if the FileSystem in use gives
+// them) comparing FileIDs.
+//
+func (s *Scanner) sameDir(a, b string) bool {
+	if ra, err := s.evalSymlinks(a); err == nil {
+		a = ra
+	}
+	if rb, err := s.evalSymlinks(b); err == nil {
+		b = rb
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	idA, errA := s.FileIdentity(a)
+	idB, errB := s.FileIdentity(b)
+	return errA == nil && errB == nil && idA == idB
+}
+
@@ -0,0 +1,154 @@
+// Functions for following the Windows pathnames in the files of a Steam
+// installation that Windows uses, from the directories where its drives are
+// mounted (fx, on a dual-boot machine).
+
+package steamfiles
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// DriveMounts, if not nil, maps the drive letters ("C", "D" and so on) of a
+// Windows Steam installation to the directories where those drives are
+// mounted, so that this package can follow the Windows pathnames (fx,
+// `D:\SteamLibrary`) in its libraryfolders.vdf file.  Drives not listed are
+// skipped, except that the one holding the Steam home directory itself can
+// usually be worked out (see FindSteamLibraryDirs).
+//
+// To read a Windows Steam installation, set SteamHomeOverride (or $STEAM_DIR)
+// to where its Steam directory is mounted, fx "/mnt/windows/Program Files
+// (x86)/Steam".
+//
+var DriveMounts map[string]string
+
+var reWindowsPath = regexp.MustCompile(`^([A-Za-z]):[\\/]`)
+
+// IsWindowsPath reports whether a pathname is an absolute Windows one, like
+// `D:\SteamLibrary`.
+//
+func IsWindowsPath(path string) bool {
+	return reWindowsPath.MatchString(path)
+}
+
+// ParseDriveMounts parses a list of drive mappings like
+// "C=/mnt/windows,D=/media/games", as a command-line option might give them,
+// for DriveMounts.  A colon after a drive letter is allowed.
+//
+func ParseDriveMounts(text string) (map[string]string, error) {
+	ret := make(map[string]string)
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("bad drive mapping %q: want <letter>=<directory>",
+				item)
+		}
+		letter := strings.TrimSuffix(strings.TrimSpace(item[:eq]), ":")
+		dir := strings.TrimSpace(item[eq+1:])
+		if len(letter) != 1 || !reWindowsPath.MatchString(letter+`:\`) || dir == "" {
+			return nil, fmt.Errorf("bad drive mapping %q: want <letter>=<directory>",
+				item)
+		}
+		ret[strings.ToUpper(letter)] = filepath.Clean(dir)
+	}
+	return ret, nil
+}
+
+// driveMounts returns the drive mappings a Scanner should use: its own
+// DriveMounts if set, otherwise the package-level one, plus (if the Steam
+// home directory’s drive is not mapped) one worked out from a
+// libraryfolders.vdf file, which may be nil.
+//
+func (s *Scanner) driveMounts(steamHome string, libraryFoldersInfo *sVDF.File,
+) map[string]string {
+	configured := s.DriveMounts
+	if configured == nil {
+		configured = DriveMounts
+	}
+	ret := make(map[string]string, len(configured)+1)
+	for letter, dir := range configured {
+		ret[strings.ToUpper(strings.TrimSuffix(letter, ":"))] = dir
+	}
+
+	// In the newer format of libraryfolders.vdf, SLF "0" is the Steam home
+	// directory, so if its pathname (fx, `C:\Program Files (x86)\Steam`)
+	// matches the end of the one in use here (fx, "/mnt/windows/Program
+	// Files (x86)/Steam"), the rest gives the drive’s mount point.
+	if libraryFoldersInfo == nil || !libraryFoldersInfo.HaveString("0", "path") {
+		return ret
+	}
+	winHome, _ := libraryFoldersInfo.Lookup("0", "path")
+	match := reWindowsPath.FindStringSubmatch(winHome)
+	if match == nil {
+		return ret
+	}
+	letter := strings.ToUpper(match[1])
+	if _, ok := ret[letter]; ok {
+		return ret
+	}
+	winParts := splitWindowsPath(winHome[len(match[0]):])
+	mount := filepath.Clean(steamHome)
+	for i := len(winParts) - 1; i >= 0; i-- {
+		if !strings.EqualFold(filepath.Base(mount), winParts[i]) {
+			return ret
+		}
+		mount = filepath.Dir(mount)
+	}
+	ret[letter] = mount
+	return ret
+}
+
+// splitWindowsPath splits a relative Windows pathname into its components.
+//
+func splitWindowsPath(path string) []string {
+	var ret []string
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '\\' || r == '/'
+	}) {
+		if part != "." {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// localPath converts a pathname from a Steam file to one that can be used
+// here.  Windows pathnames are mapped via a set of drive mappings, and their
+// components are matched ignoring case (as Windows does) if need be; other
+// pathnames are returned unchanged.
+//
+func (s *Scanner) localPath(path string, mounts map[string]string) (string, error) {
+	match := reWindowsPath.FindStringSubmatch(path)
+	if match == nil {
+		return path, nil
+	}
+	letter := strings.ToUpper(match[1])
+	ret, ok := mounts[letter]
+	if !ok {
+		return "", cannotFind(fmt.Sprintf("where drive %s: is mounted (for %s)",
+			letter, path), nil)
+	}
+	for _, part := range splitWindowsPath(path[len(match[0]):]) {
+		next := filepath.Join(ret, part)
+		if _, err := s.fsys.Stat(next); err != nil {
+			if names, err := s.readDirNames(ret); err == nil {
+				for _, name := range names {
+					if strings.EqualFold(name, part) {
+						next = filepath.Join(ret, name)
+						break
+					}
+				}
+			}
+		}
+		ret = next
+	}
+	return ret, nil
+}
@@ -0,0 +1,188 @@
+package steamfiles
+
+import (
+	"io/fs"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+func TestParseDriveMounts(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want map[string]string // nil for an error
+	}{
+		{"", map[string]string{}},
+		{"C=/mnt/windows", map[string]string{"C": "/mnt/windows"}},
+		{" c: = /mnt/windows/ , D=/media/games,", map[string]string{
+			"C": "/mnt/windows", "D": "/media/games"}},
+		{"d=/a,D=/b", map[string]string{"D": "/b"}},
+		{"C", nil},
+		{"C=", nil},
+		{"=/mnt", nil},
+		{"CD=/mnt", nil},
+		{"1=/mnt", nil},
+		{"C=/mnt,oops", nil},
+	} {
+		got, err := ParseDriveMounts(tc.text)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("ParseDriveMounts(%q) = %v, want an error", tc.text, got)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tc.want) {
+			t.Errorf("ParseDriveMounts(%q) = %v, %v; want %v", tc.text, got, err,
+				tc.want)
+			continue
+		}
+		for letter, dir := range tc.want {
+			if got[letter] != dir {
+				t.Errorf("ParseDriveMounts(%q) = %v, want %v", tc.text, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// libraryFoldersVDF returns the text of a libraryfolders.vdf file in the newer
+// format listing SLFs with the given pathnames (already escaped), except that
+// a pathname of "" means no "path" entry.
+//
+func libraryFoldersVDF(paths ...string) string {
+	text := "\"libraryfolders\"\n{\n"
+	for i, p := range paths {
+		text += "\t\"" + strconv.Itoa(i) + "\"\n\t{\n"
+		if p != "" {
+			text += "\t\t\"path\"\t\t\"" + p + "\"\n"
+		}
+		text += "\t}\n"
+	}
+	return text + "}\n"
+}
+
+// windowsLibraryFolders returns a parsed libraryfolders.vdf file whose SLF "0"
+// has the given path (or none, if it is "").
+//
+func windowsLibraryFolders(t *testing.T, homePath string) *sVDF.File {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"libraryfolders.vdf": {Data: []byte(libraryFoldersVDF(homePath))}}
+	info, err := sVDF.FromFS(fsys, "libraryfolders.vdf", "libraryfolders")
+	if err != nil {
+		t.Fatalf("cannot parse test libraryfolders.vdf: %s", err)
+	}
+	return info
+}
+
+func TestDriveMounts(t *testing.T) {
+	const steamHome = "/mnt/windows/Program Files (x86)/Steam"
+	for _, tc := range []struct {
+		name       string
+		configured map[string]string
+		homePath   string // SLF "0" in libraryfolders.vdf; "-" for no file
+		want       map[string]string
+	}{
+		{"nothing", nil, "-", map[string]string{}},
+		{"configured", map[string]string{"d:": "/media/d", "E": "/media/e"}, "-",
+			map[string]string{"D": "/media/d", "E": "/media/e"}},
+		{"worked out", nil, `C:\\Program Files (x86)\\Steam`,
+			map[string]string{"C": "/mnt/windows"}},
+		{"worked out ignoring case", map[string]string{"D": "/media/d"},
+			`c:\\PROGRAM FILES (X86)\\steam\\`,
+			map[string]string{"C": "/mnt/windows", "D": "/media/d"}},
+		{"worked out with slashes", nil, `C:/Program Files (x86)/Steam`,
+			map[string]string{"C": "/mnt/windows"}},
+		{"configured beats worked out", map[string]string{"C": "/media/c"},
+			`C:\\Program Files (x86)\\Steam`, map[string]string{"C": "/media/c"}},
+		{"home does not match", nil, `C:\\Games\\Steam`, map[string]string{}},
+		{"home too long", nil, `C:\\Windows\\Program Files (x86)\\Steam\\x`,
+			map[string]string{}},
+		{"Linux home", nil, "/home/me/.steam/steam", map[string]string{}},
+		{"no home path", nil, "", map[string]string{}},
+	} {
+		s := NewScanner(FromFS(fstest.MapFS{}))
+		s.DriveMounts = tc.configured
+		var info *sVDF.File
+		if tc.homePath != "-" {
+			info = windowsLibraryFolders(t, tc.homePath)
+		}
+		got := s.driveMounts(steamHome, info)
+		ok := len(got) == len(tc.want)
+		for letter, dir := range tc.want {
+			ok = ok && got[letter] == dir
+		}
+		if !ok {
+			t.Errorf("%s: driveMounts gave %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := &fstest.MapFile{Mode: fs.ModeDir | 0755}
+	s := NewScanner(FromFS(fstest.MapFS{
+		"media/d/SteamLibrary/steamapps":        dir,
+		"media/d/Other Library/SteamApps":       dir,
+		"mnt/windows/Program Files (x86)/Steam": dir,
+	}))
+	mounts := map[string]string{"C": "/mnt/windows", "D": "/media/d"}
+	for _, tc := range []struct {
+		path, want string // want is "" for an error
+	}{
+		{"/home/me/SteamLibrary", "/home/me/SteamLibrary"},
+		{`D:\SteamLibrary`, "/media/d/SteamLibrary"},
+		{`d:\steamlibrary\STEAMAPPS`, "/media/d/SteamLibrary/steamapps"},
+		{`D:/other library\steamapps`, "/media/d/Other Library/SteamApps"},
+		{`D:\.\SteamLibrary\`, "/media/d/SteamLibrary"},
+		{`C:\program files (x86)\steam`, "/mnt/windows/Program Files (x86)/Steam"},
+		{`D:\Missing\steamapps`, "/media/d/Missing/steamapps"},
+		{`E:\SteamLibrary`, ""},
+	} {
+		got, err := s.localPath(tc.path, mounts)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("localPath(%q) = %q, want an error", tc.path, got)
+			}
+		} else if err != nil || got != tc.want {
+			t.Errorf("localPath(%q) = %q, %v; want %q", tc.path, got, err, tc.want)
+		}
+	}
+}
+
+func TestFindSteamLibraryDirsWindows(t *testing.T) {
+	const steamHome = "/mnt/windows/Program Files (x86)/Steam"
+	dir := &fstest.MapFile{Mode: fs.ModeDir | 0755}
+	s := NewScanner(FromFS(fstest.MapFS{
+		"mnt/windows/Program Files (x86)/Steam/steamapps/libraryfolders.vdf": {
+			Data: []byte(libraryFoldersVDF(`C:\\Program Files (x86)\\Steam`,
+				`c:\\games\\steam library`, `D:\\SteamLibrary`,
+				`E:\\SteamLibrary`))},
+		"mnt/windows/Games/Steam Library/steamapps": dir,
+		"media/d/SteamLibrary/steamapps":            dir,
+	}))
+	s.SteamHomeOverride = steamHome
+	s.DriveMounts = map[string]string{"D": "/media/d"}
+	var bad []string
+	home, dirs, err := s.FindSteamLibraryDirs(func(slf string, err error) {
+		bad = append(bad, slf)
+	})
+	if err != nil {
+		t.Fatalf("FindSteamLibraryDirs: %s", err)
+	}
+	want := []string{steamHome + "/steamapps",
+		"/mnt/windows/Games/Steam Library/steamapps",
+		"/media/d/SteamLibrary/steamapps"}
+	ok := home == steamHome && len(dirs) == len(want)
+	for i := 0; ok && i < len(dirs); i++ {
+		ok = dirs[i] == want[i]
+	}
+	if !ok {
+		t.Errorf("FindSteamLibraryDirs gave %q, %q; want %q, %q", home, dirs,
+			steamHome, want)
+	}
+	if len(bad) != 1 || bad[0] != `E:\SteamLibrary` {
+		t.Errorf("FindSteamLibraryDirs reported bad SLFs %q, want just E:", bad)
+	}
+}
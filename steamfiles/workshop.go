@@ -0,0 +1,325 @@
+// Functions etc for Steam Workshop content: appworkshop_<AppNum>.acf files and
+// the items under workshop/content/<AppNum>.
+
+package steamfiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/c12h/steam-stuff/sVDF"
+)
+
+// Steam identifies Workshop items (mods, maps and so on) by positive integers,
+// which are too big for 32 bits.
+//
+type WorkshopItemID uint64
+
+// An AppWorkshop holds details of the Workshop items that a Steam library holds
+// for an app, taken from its steamapps/workshop/appworkshop_<AppNum>.acf file.
+//
+// Steam backups do not include Workshop content, so it is not restored along
+// with the app.
+//
+type AppWorkshop struct {
+	AppNumber       AppNum          // The app the items are for
+	Path            string          // The appworkshop_<AppNum>.acf file
+	Library         string          // The "steamapps" directory holding it
+	ModTime         time.Time       // When the file was last modified
+	SizeOnDisk      int64           // How many bytes Steam thinks the items take
+	NeedsUpdate     bool            // Whether Steam wants to update some items
+	NeedsDownload   bool            // Whether Steam wants to download some items
+	TimeLastUpdated time.Time       // When Steam last updated the items (zero if unknown)
+	TimeLastAppRan  time.Time       // When the app last ran (zero if unknown)
+	Items           []*WorkshopItem // The items, sorted by ID
+}
+
+// A WorkshopItem is one entry in the "WorkshopItemsInstalled" or
+// "WorkshopItemDetails" section of an appworkshop_<AppNum>.acf file (or both;
+// details from the first take priority).
+//
+type WorkshopItem struct {
+	ID                WorkshopItemID
+	Installed         bool       // Whether it is in "WorkshopItemsInstalled"
+	Size              int64      // How many bytes it takes
+	Manifest          ManifestID // The version installed
+	TimeUpdated       time.Time  // When that version was published
+	TimeTouched       time.Time  // When Steam last checked it (zero if unknown)
+	SubscribedBy      uint32     // The account number of the subscriber, if known
+	LatestManifest    ManifestID // The newest version, if known
+	LatestTimeUpdated time.Time  // When that was published (zero if unknown)
+}
+
+// ContentDir returns the directory that holds an app’s Workshop items, each in
+// a subdirectory named for its WorkshopItemID.  It may not exist.
+//
+func (w *AppWorkshop) ContentDir() string {
+	return filepath.Join(w.Library, "workshop", "content",
+		strconv.Itoa(int(w.AppNumber)))
+}
+
+// ItemDir returns the directory that holds one of an app’s Workshop items.
+//
+func (w *AppWorkshop) ItemDir(item *WorkshopItem) string {
+	return filepath.Join(w.ContentDir(),
+		strconv.FormatUint(uint64(item.ID), 10))
+}
+
+// Size returns the number of bytes the items take, according to Steam: the
+// "SizeOnDisk" value if there is one, or else the total of the items’ sizes.
+//
+func (w *AppWorkshop) Size() int64 {
+	if w.SizeOnDisk > 0 {
+		return w.SizeOnDisk
+	}
+	var total int64
+	for _, item := range w.Items {
+		if item.Installed {
+			total += item.Size
+		}
+	}
+	return total
+}
+
+// AppWorkshopForAppNum holds the AppWorkshop values for some apps.
+//
+type AppWorkshopForAppNum map[AppNum]*AppWorkshop
+
+var reAppWorkshopFile = regexp.MustCompile(`^appworkshop_(\d+)\.acf$`)
+
+// ReadAppWorkshop parses an appworkshop_<AppNum>.acf file.
+//
+func ReadAppWorkshop(path string) (*AppWorkshop, error) {
+	return std.ReadAppWorkshop(path)
+}
+
+// ReadAppWorkshop is the Scanner method behind the ReadAppWorkshop function.
+//
+func (s *Scanner) ReadAppWorkshop(path string) (*AppWorkshop, error) {
+	wsInfo, err := sVDF.FromFS(s.fsys, path, "AppWorkshop")
+	if err != nil {
+		return nil, err
+	}
+	idText, err := wsInfo.Lookup("appid")
+	if err != nil {
+		return nil, cannot("get app ID from", "", path, err)
+	}
+	appNum, err := parseAppNum(idText, path)
+	if err != nil {
+		return nil, err
+	}
+	if match := reAppWorkshopFile.FindStringSubmatch(filepath.Base(path)); match != nil &&
+		match[1] != idText {
+		return nil, fileError(path, "appid",
+			"wrong appid %d for file name", appNum)
+	}
+
+	ret := &AppWorkshop{
+		AppNumber:       appNum,
+		Path:            path,
+		Library:         filepath.Dir(filepath.Dir(path)),
+		ModTime:         wsInfo.ModTime,
+		TimeLastUpdated: manifestTime(wsInfo, "TimeLastUpdated"),
+		TimeLastAppRan:  manifestTime(wsInfo, "TimeLastAppRan"),
+	}
+	if text, err := wsInfo.Lookup("SizeOnDisk"); err == nil {
+		ret.SizeOnDisk, _ = strconv.ParseInt(text, 10, 64)
+	}
+	if text, err := wsInfo.Lookup("NeedsUpdate"); err == nil {
+		ret.NeedsUpdate = text != "" && text != "0"
+	}
+	if text, err := wsInfo.Lookup("NeedsDownload"); err == nil {
+		ret.NeedsDownload = text != "" && text != "0"
+	}
+
+	items := make(map[WorkshopItemID]*WorkshopItem)
+	for _, section := range []string{"WorkshopItemsInstalled", "WorkshopItemDetails"} {
+		if !wsInfo.HaveNVL(section) {
+			continue
+		}
+		nvl, err := wsInfo.LookupNVL(section)
+		if err != nil {
+			return nil, cannot("get "+strconv.Quote(section)+" from", "", path, err)
+		}
+		for _, idText := range nvl.Names() {
+			id, err := strconv.ParseUint(idText, 10, 64)
+			if err != nil || id == 0 {
+				return nil, fileError(path, section,
+					"bad Workshop item ID %q", idText)
+			}
+			item := items[WorkshopItemID(id)]
+			if item == nil {
+				item = &WorkshopItem{ID: WorkshopItemID(id)}
+				items[item.ID] = item
+			}
+			if err := parseWorkshopItem(wsInfo, section, idText, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, item := range items {
+		ret.Items = append(ret.Items, item)
+	}
+	sort.Slice(ret.Items, func(i, j int) bool {
+		return ret.Items[i].ID < ret.Items[j].ID
+	})
+	return ret, nil
+}
+
+// parseWorkshopItem fills in the fields of a WorkshopItem from one section of
+// an appworkshop_<AppNum>.acf file, leaving any that are already set.  Like
+// the optional fields of manifests, bad values are ignored, except for the
+// manifest IDs.
+//
+func parseWorkshopItem(wsInfo *sVDF.File, section, idText string,
+	item *WorkshopItem,
+) error {
+	get := func(name string) string {
+		text, _ := wsInfo.Lookup(section, idText, name)
+		return text
+	}
+	getTime := func(name string) time.Time {
+		secs, err := strconv.ParseInt(get(name), 10, 64)
+		if err != nil || secs <= 0 {
+			return time.Time{}
+		}
+		return time.Unix(secs, 0)
+	}
+	getManifest := func(name string) (ManifestID, error) {
+		text := get(name)
+		if text == "" {
+			return 0, nil
+		}
+		id, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return 0, fileError(wsInfo.Path, name,
+				"bad manifest ID %q for Workshop item %s", text, idText)
+		}
+		return ManifestID(id), nil
+	}
+
+	if section == "WorkshopItemsInstalled" {
+		item.Installed = true
+	}
+	if item.Size == 0 {
+		item.Size, _ = strconv.ParseInt(get("size"), 10, 64)
+	}
+	if item.Manifest == 0 {
+		m, err := getManifest("manifest")
+		if err != nil {
+			return err
+		}
+		item.Manifest = m
+	}
+	if item.TimeUpdated.IsZero() {
+		item.TimeUpdated = getTime("timeupdated")
+	}
+	if item.TimeTouched.IsZero() {
+		item.TimeTouched = getTime("timetouched")
+	}
+	if item.SubscribedBy == 0 {
+		n, _ := strconv.ParseUint(get("subscribedby"), 10, 32)
+		item.SubscribedBy = uint32(n)
+	}
+	if item.LatestManifest == 0 {
+		m, err := getManifest("latest_manifest")
+		if err != nil {
+			return err
+		}
+		item.LatestManifest = m
+	}
+	if item.LatestTimeUpdated.IsZero() {
+		item.LatestTimeUpdated = getTime("latest_timeupdated")
+	}
+	return nil
+}
+
+// ReadAppWorkshops parses all the appworkshop_<AppNum>.acf files in a Steam
+// library directory, returning them sorted by AppNum.  A library without a
+// "workshop" subdirectory has none.
+//
+func ReadAppWorkshops(steamLibDir string) ([]*AppWorkshop, error) {
+	return std.ReadAppWorkshops(steamLibDir)
+}
+
+// ReadAppWorkshops is the Scanner method behind the ReadAppWorkshops function.
+//
+func (s *Scanner) ReadAppWorkshops(steamLibDir string) ([]*AppWorkshop, error) {
+	return s.readAppWorkshops(steamLibDir, nil)
+}
+
+// readAppWorkshops is ReadAppWorkshops, except that if report is not nil, it
+// skips any appworkshop_<AppNum>.acf file it cannot parse and passes the
+// error to report.
+//
+func (s *Scanner) readAppWorkshops(steamLibDir string, report LoadProblemReporter,
+) ([]*AppWorkshop, error) {
+	dir := filepath.Join(steamLibDir, "workshop")
+	entries, err := s.fsys.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, cannot("read", "directory", dir, err)
+	}
+	var ret []*AppWorkshop
+	for _, e := range entries {
+		if e.IsDir() || !reAppWorkshopFile.MatchString(e.Name()) {
+			continue
+		}
+		w, err := s.ReadAppWorkshop(filepath.Join(dir, e.Name()))
+		if err != nil && report != nil {
+			report(err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		w.Library = steamLibDir
+		ret = append(ret, w)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].AppNumber < ret[j].AppNumber
+	})
+	return ret, nil
+}
+
+// WorkshopNewerThan reports whether an app’s Workshop content has changed since
+// some time t (fx, when a backup was written): whether Steam updated any item
+// after t, or any file under the app’s Workshop content directory is newer than
+// t.  Like AppNewerThanContext, it examines directories concurrently (as opts
+// allows), reports progress and gives up if ctx is done.
+//
+func WorkshopNewerThan(ctx context.Context, w *AppWorkshop, t time.Time,
+	opts *ScanOptions,
+) (bool, error) {
+	return std.WorkshopNewerThan(ctx, w, t, opts)
+}
+
+// WorkshopNewerThan is the Scanner method behind the WorkshopNewerThan
+// function.
+//
+func (s *Scanner) WorkshopNewerThan(ctx context.Context, w *AppWorkshop,
+	t time.Time, opts *ScanOptions,
+) (bool, error) {
+	for _, item := range w.Items {
+		if item.Installed && item.TimeUpdated.After(t) {
+			return true, nil
+		}
+	}
+	contentDir := w.ContentDir()
+	if _, err := s.fsys.Lstat(contentDir); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, cannot("examine", "directory", contentDir, err)
+	}
+	scan := newScanState(ctx, opts)
+	return scan.walkTreeParallel(contentDir, func(dirPath string) ([]string, bool, error) {
+		return s.dirNewerThan(scan, dirPath, t)
+	})
+}